@@ -0,0 +1,77 @@
+/*
+Copyright 2021 AstroKube.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ImageRewritePolicySpec defines the desired state of ImageRewritePolicy
+type ImageRewritePolicySpec struct {
+	// NamespaceSelector selects the Namespaces of the Pods whose images are
+	// rewritten. All the Namespaces are selected when it is empty.
+	//+kubebuilder:validation:Optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// Rules to rewrite the images. The rule with the longest matching from
+	// prefix is applied.
+	//+kubebuilder:validation:Required
+	//+kubebuilder:validation:MinItems=1
+	Rules []ImageRewriteRule `json:"rules"`
+}
+
+// ImageRewriteRule rewrites the images in a registry or repository prefix to
+// another prefix
+type ImageRewriteRule struct {
+	// From is the registry or repository prefix of the images to rewrite, like
+	// docker.io or docker.io/bitnami. Images without registry are matched as
+	// the container runtime resolves them, so docker.io matches nginx. A
+	// trailing /* is allowed, like docker.io/*.
+	//+kubebuilder:validation:Required
+	//+kubebuilder:validation:MinLength=1
+	From string `json:"from"`
+
+	// To is the prefix the images are rewritten to, like
+	// 123.dkr.ecr.eu-west-1.amazonaws.com/dockerhub. A trailing /* is allowed.
+	//+kubebuilder:validation:Required
+	//+kubebuilder:validation:MinLength=1
+	To string `json:"to"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+
+// ImageRewritePolicy is the Schema for the imagerewritepolicies API
+type ImageRewritePolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ImageRewritePolicySpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ImageRewritePolicyList contains a list of ImageRewritePolicy
+type ImageRewritePolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ImageRewritePolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ImageRewritePolicy{}, &ImageRewritePolicyList{})
+}
@@ -17,6 +17,10 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"reflect"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -27,6 +31,108 @@ type RegistryCredentialsSpec struct {
 
 	// Foo is an example field of RegistryCredentials. Edit registrycredentials_types.go to remove/update
 	ImageSelector ImageSelector `json:"imageSelector,omitempty"`
+
+	// Mirrors of the registry, like pull-through caches, that receive the
+	// same credentials and match the images of the Pods
+	//+kubebuilder:validation:Optional
+	Mirrors []Mirror `json:"mirrors,omitempty"`
+
+	// PinDigests resolves the tags of the images matched by the
+	// RegistryCredentials to their digests when Pods are created
+	//+kubebuilder:validation:Optional
+	PinDigests *PinDigests `json:"pinDigests,omitempty"`
+
+	// HealthCheck verifies that the credentials can pull an image after
+	// every refresh and periodically, and reports it in the Pullable
+	// condition
+	//+kubebuilder:validation:Optional
+	HealthCheck *HealthCheck `json:"healthCheck,omitempty"`
+
+	// VerifySignatures verifies the cosign signatures of the images matched
+	// by the RegistryCredentials when Pods are created in the Namespaces
+	// labeled with registry.astrokube.com/verify-signatures=true
+	//+kubebuilder:validation:Optional
+	VerifySignatures *VerifySignatures `json:"verifySignatures,omitempty"`
+}
+
+// SignatureAction defines how Pods are admitted when the signature of an image
+// is missing or invalid
+type SignatureAction string
+
+const (
+	// SignatureActionDeny denies the Pods
+	SignatureActionDeny SignatureAction = "Deny"
+	// SignatureActionWarn admits the Pods with an admission warning
+	SignatureActionWarn SignatureAction = "Warn"
+)
+
+// VerifySignatures configures the verification of the cosign signatures of
+// the images
+type VerifySignatures struct {
+	// PEM encoded ECDSA public keys, like the cosign.pub generated by cosign
+	// generate-key-pair. Images must be signed with one of them.
+	//+kubebuilder:validation:Required
+	//+kubebuilder:validation:MinItems=1
+	PublicKeys []string `json:"publicKeys"`
+
+	// Action defines whether Pods are denied (Deny) or admitted with a
+	// warning (Warn) when the signature of an image is missing or invalid.
+	// Defaults to Deny.
+	//+kubebuilder:validation:Optional
+	//+kubebuilder:validation:Enum=Deny;Warn
+	Action SignatureAction `json:"action,omitempty"`
+
+	// FailurePolicy defines whether Pods are admitted with a warning (Ignore)
+	// or denied (Fail) when the signatures can't be verified, like when the
+	// registry can't be reached. Defaults to Ignore.
+	//+kubebuilder:validation:Optional
+	//+kubebuilder:validation:Enum=Ignore;Fail
+	FailurePolicy FailurePolicy `json:"failurePolicy,omitempty"`
+}
+
+// HealthCheck configures the image requested to verify the credentials
+type HealthCheck struct {
+	// Image whose manifest is requested with the credentials, like
+	// 123456789012.dkr.ecr.eu-west-1.amazonaws.com/app:latest
+	//+kubebuilder:validation:Required
+	//+kubebuilder:validation:MinLength=1
+	Image string `json:"image"`
+
+	// Interval between checks. Defaults to 5m.
+	//+kubebuilder:validation:Optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+}
+
+// FailurePolicy defines how Pods are admitted when a check of their images
+// can't be completed
+type FailurePolicy string
+
+const (
+	// FailurePolicyIgnore admits the Pods as they are
+	FailurePolicyIgnore FailurePolicy = "Ignore"
+	// FailurePolicyFail denies the Pods
+	FailurePolicyFail FailurePolicy = "Fail"
+)
+
+// PinDigests configures the resolution of the image tags to digests
+type PinDigests struct {
+	// FailurePolicy defines whether Pods are created with their tags (Ignore)
+	// or denied (Fail) when a tag can't be resolved. Defaults to Ignore.
+	//+kubebuilder:validation:Optional
+	//+kubebuilder:validation:Enum=Ignore;Fail
+	FailurePolicy FailurePolicy `json:"failurePolicy,omitempty"`
+}
+
+// Mirror is a host or a prefix serving the images of the registry
+type Mirror struct {
+	// Host or prefix of the mirror, like harbor.example.com/dockerhub-proxy
+	//+kubebuilder:validation:Required
+	Prefix string `json:"prefix"`
+
+	// Prefix of the upstream images that are rewritten to the mirror in the
+	// Pods, like docker.io. Images aren't rewritten when empty.
+	//+kubebuilder:validation:Optional
+	Upstream string `json:"upstream,omitempty"`
 }
 
 type ImageSelector struct {
@@ -40,6 +146,53 @@ type ImageSelector struct {
 type RegistryProvider struct {
 	//+kubebuilder:validation:Optional
 	AWSElasticContainerRegistry *AWSElasticContainerRegistry `json:"awsElasticContainerRegistry,omitempty"`
+
+	//+kubebuilder:validation:Optional
+	Exec *ExecProvider `json:"exec,omitempty"`
+
+	//+kubebuilder:validation:Optional
+	WebhookProvider *WebhookProvider `json:"webhookProvider,omitempty"`
+
+	//+kubebuilder:validation:Optional
+	Vault *VaultProvider `json:"vault,omitempty"`
+
+	//+kubebuilder:validation:Optional
+	Harbor *HarborProvider `json:"harbor,omitempty"`
+
+	//+kubebuilder:validation:Optional
+	GitHubContainerRegistry *GitHubContainerRegistry `json:"githubContainerRegistry,omitempty"`
+
+	//+kubebuilder:validation:Optional
+	GitLab *GitLabProvider `json:"gitlab,omitempty"`
+
+	//+kubebuilder:validation:Optional
+	DockerHub *DockerHubProvider `json:"dockerHub,omitempty"`
+
+	//+kubebuilder:validation:Optional
+	Quay *QuayProvider `json:"quay,omitempty"`
+
+	//+kubebuilder:validation:Optional
+	AlibabaContainerRegistry *AlibabaContainerRegistry `json:"alibabaContainerRegistry,omitempty"`
+
+	//+kubebuilder:validation:Optional
+	OracleContainerRegistry *OracleContainerRegistry `json:"oracleContainerRegistry,omitempty"`
+}
+
+// Names returns the JSON names of the providers that are set, like
+// awsElasticContainerRegistry
+func (p RegistryProvider) Names() []string {
+	names := []string{}
+	value := reflect.ValueOf(p)
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Field(i)
+		if field.Kind() != reflect.Ptr || field.IsNil() {
+			continue
+		}
+		name := strings.Split(value.Type().Field(i).Tag.Get("json"), ",")[0]
+		names = append(names, name)
+	}
+
+	return names
 }
 
 type AWSElasticContainerRegistry struct {
@@ -53,6 +206,362 @@ type AWSElasticContainerRegistry struct {
 	SecretAccessKey string `json:"secretAccessKey,omitempty"`
 }
 
+// ExecProvider runs a kubelet credential provider plugin from the plugin
+// directory of the operator
+type ExecProvider struct {
+	// Name of the plugin binary in the plugin directory
+	//+kubebuilder:validation:Required
+	Name string `json:"name"`
+
+	// Registry host sent to the plugin in the CredentialProviderRequest
+	//+kubebuilder:validation:Required
+	Registry string `json:"registry"`
+
+	// APIVersion of the CredentialProvider API understood by the plugin
+	//+kubebuilder:validation:Optional
+	//+kubebuilder:validation:Enum=credentialprovider.kubelet.k8s.io/v1;credentialprovider.kubelet.k8s.io/v1beta1;credentialprovider.kubelet.k8s.io/v1alpha1
+	APIVersion string `json:"apiVersion,omitempty"`
+
+	//+kubebuilder:validation:Optional
+	Args []string `json:"args,omitempty"`
+
+	//+kubebuilder:validation:Optional
+	Env []ExecEnvVar `json:"env,omitempty"`
+}
+
+type ExecEnvVar struct {
+	//+kubebuilder:validation:Required
+	Name string `json:"name"`
+
+	//+kubebuilder:validation:Required
+	Value string `json:"value"`
+}
+
+// WebhookProvider gets the credentials from an HTTPS endpoint
+type WebhookProvider struct {
+	// URL of the HTTPS endpoint
+	//+kubebuilder:validation:Required
+	//+kubebuilder:validation:Pattern=`^https://`
+	URL string `json:"url"`
+
+	// Registry host sent in the request
+	//+kubebuilder:validation:Required
+	Registry string `json:"registry"`
+
+	// PEM encoded CA bundle to verify the endpoint. The system CAs are used
+	// when empty.
+	//+kubebuilder:validation:Optional
+	CABundle []byte `json:"caBundle,omitempty"`
+
+	// Key of a Secret with the bearer token sent in the Authorization header
+	//+kubebuilder:validation:Optional
+	BearerTokenSecretRef *corev1.SecretKeySelector `json:"bearerTokenSecretRef,omitempty"`
+
+	// Secret of type kubernetes.io/tls with the client certificate for mTLS
+	//+kubebuilder:validation:Optional
+	ClientCertificateSecretRef *corev1.LocalObjectReference `json:"clientCertificateSecretRef,omitempty"`
+}
+
+// VaultProvider reads the credentials from HashiCorp Vault, authenticating with
+// the Kubernetes auth method
+type VaultProvider struct {
+	// Address of the Vault server, like https://vault.example.com:8200. It must
+	// be one of the addresses allowed by the operator.
+	//+kubebuilder:validation:Required
+	//+kubebuilder:validation:Pattern=`^https://`
+	Address string `json:"address"`
+
+	// Vault Enterprise namespace
+	//+kubebuilder:validation:Optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// PEM encoded CA bundle to verify the server. The system CAs are used when
+	// empty.
+	//+kubebuilder:validation:Optional
+	CABundle []byte `json:"caBundle,omitempty"`
+
+	// Mount path of the Kubernetes auth method. Defaults to kubernetes.
+	//+kubebuilder:validation:Optional
+	AuthPath string `json:"authPath,omitempty"`
+
+	// Role of the Kubernetes auth method
+	//+kubebuilder:validation:Required
+	Role string `json:"role"`
+
+	// Name of the service account of the namespace whose token is used to
+	// login. Defaults to default.
+	//+kubebuilder:validation:Optional
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+
+	// Path of the secret, like secret/data/registry for KV v2 or the path of a
+	// secrets engine plugin
+	//+kubebuilder:validation:Required
+	Path string `json:"path"`
+
+	//+kubebuilder:validation:Optional
+	Fields VaultFields `json:"fields,omitempty"`
+
+	// Registry host, used when the secret doesn't have the registry field
+	//+kubebuilder:validation:Optional
+	Registry string `json:"registry,omitempty"`
+}
+
+// VaultFields are the fields of the Vault secret with the credentials
+type VaultFields struct {
+	// Defaults to username
+	//+kubebuilder:validation:Optional
+	Username string `json:"username,omitempty"`
+
+	// Defaults to password
+	//+kubebuilder:validation:Optional
+	Password string `json:"password,omitempty"`
+
+	// Defaults to registry
+	//+kubebuilder:validation:Optional
+	Registry string `json:"registry,omitempty"`
+}
+
+// HarborProvider creates and rotates a robot account with pull access to a
+// Harbor project
+type HarborProvider struct {
+	// URL of Harbor, like https://harbor.example.com
+	//+kubebuilder:validation:Required
+	//+kubebuilder:validation:Pattern=`^https://`
+	URL string `json:"url"`
+
+	// Project the robot account can pull from
+	//+kubebuilder:validation:Required
+	Project string `json:"project"`
+
+	// Secret with the username and password keys of an admin or a maintainer of
+	// the project
+	//+kubebuilder:validation:Required
+	CredentialsSecretRef corev1.LocalObjectReference `json:"credentialsSecretRef"`
+
+	// PEM encoded CA bundle to verify Harbor. The system CAs are used when
+	// empty.
+	//+kubebuilder:validation:Optional
+	CABundle []byte `json:"caBundle,omitempty"`
+
+	// Lifetime of the robot accounts in days. Defaults to 30.
+	//+kubebuilder:validation:Optional
+	//+kubebuilder:validation:Minimum=1
+	DurationDays int32 `json:"durationDays,omitempty"`
+
+	// Interval between rotations of the robot account. Defaults to half of its
+	// lifetime.
+	//+kubebuilder:validation:Optional
+	RotationInterval *metav1.Duration `json:"rotationInterval,omitempty"`
+
+	// Registry host. Defaults to the host of the URL.
+	//+kubebuilder:validation:Optional
+	Registry string `json:"registry,omitempty"`
+}
+
+// GitHubContainerRegistry authenticates to the GitHub Container Registry with
+// the installation access token of a GitHub App
+type GitHubContainerRegistry struct {
+	// ID of the GitHub App
+	//+kubebuilder:validation:Required
+	//+kubebuilder:validation:Minimum=1
+	AppID int64 `json:"appId"`
+
+	// ID of the installation of the GitHub App in the organization
+	//+kubebuilder:validation:Required
+	//+kubebuilder:validation:Minimum=1
+	InstallationID int64 `json:"installationId"`
+
+	// Key of a Secret with the PEM encoded private key of the GitHub App
+	//+kubebuilder:validation:Required
+	PrivateKeySecretRef corev1.SecretKeySelector `json:"privateKeySecretRef"`
+
+	// Base URL of the GitHub API. Defaults to https://api.github.com, and is
+	// like https://github.example.com/api/v3 for GitHub Enterprise Server.
+	//+kubebuilder:validation:Optional
+	APIURL string `json:"apiUrl,omitempty"`
+
+	// PEM encoded CA bundle to verify the GitHub API. The system CAs are used
+	// when empty.
+	//+kubebuilder:validation:Optional
+	CABundle []byte `json:"caBundle,omitempty"`
+
+	// Registry host. Defaults to ghcr.io.
+	//+kubebuilder:validation:Optional
+	Registry string `json:"registry,omitempty"`
+}
+
+// GitLabProvider authenticates to a GitLab container registry with a static
+// deploy token, or with deploy tokens created and rotated for a project or a
+// group
+type GitLabProvider struct {
+	// Base URL of the GitLab API. Defaults to https://gitlab.com/api/v4.
+	//+kubebuilder:validation:Optional
+	APIURL string `json:"apiUrl,omitempty"`
+
+	// PEM encoded CA bundle to verify the GitLab API. The system CAs are used
+	// when empty.
+	//+kubebuilder:validation:Optional
+	CABundle []byte `json:"caBundle,omitempty"`
+
+	// Registry host. Defaults to registry.gitlab.com.
+	//+kubebuilder:validation:Optional
+	Registry string `json:"registry,omitempty"`
+
+	// Secret with the username and token keys of a static deploy token
+	//+kubebuilder:validation:Optional
+	DeployTokenSecretRef *corev1.LocalObjectReference `json:"deployTokenSecretRef,omitempty"`
+
+	// ID or path of the project the deploy tokens are created for
+	//+kubebuilder:validation:Optional
+	Project string `json:"project,omitempty"`
+
+	// ID or path of the group the deploy tokens are created for
+	//+kubebuilder:validation:Optional
+	Group string `json:"group,omitempty"`
+
+	// Key of a Secret with the access token of a maintainer of the project or
+	// the group, used to create the deploy tokens
+	//+kubebuilder:validation:Optional
+	AccessTokenSecretRef *corev1.SecretKeySelector `json:"accessTokenSecretRef,omitempty"`
+
+	// Lifetime of the created deploy tokens in days. Defaults to 30.
+	//+kubebuilder:validation:Optional
+	//+kubebuilder:validation:Minimum=1
+	DurationDays int32 `json:"durationDays,omitempty"`
+
+	// Interval between rotations of the created deploy tokens. Defaults to
+	// half of their lifetime.
+	//+kubebuilder:validation:Optional
+	RotationInterval *metav1.Duration `json:"rotationInterval,omitempty"`
+}
+
+// DockerHubProvider authenticates to Docker Hub with a personal access token
+type DockerHubProvider struct {
+	// Secret with the username and token keys of the personal access token
+	//+kubebuilder:validation:Required
+	CredentialsSecretRef corev1.LocalObjectReference `json:"credentialsSecretRef"`
+
+	// URL of the token endpoint used to validate the personal access token.
+	// Defaults to https://auth.docker.io/token.
+	//+kubebuilder:validation:Optional
+	AuthURL string `json:"authUrl,omitempty"`
+
+	// URL of the registry API used to get the pull rate limit. Defaults to
+	// https://registry-1.docker.io.
+	//+kubebuilder:validation:Optional
+	RegistryURL string `json:"registryUrl,omitempty"`
+
+	// PEM encoded CA bundle to verify the token endpoint and the registry
+	// API. The system CAs are used when empty.
+	//+kubebuilder:validation:Optional
+	CABundle []byte `json:"caBundle,omitempty"`
+}
+
+// QuayProvider authenticates to Quay and the Red Hat registries with a robot
+// account, or with the auth entries of a pull secret
+type QuayProvider struct {
+	// Secret with the username and token keys of a Quay robot account
+	//+kubebuilder:validation:Optional
+	RobotAccountSecretRef *corev1.LocalObjectReference `json:"robotAccountSecretRef,omitempty"`
+
+	// Registry host of the robot account. Defaults to quay.io.
+	//+kubebuilder:validation:Optional
+	Registry string `json:"registry,omitempty"`
+
+	// Key of a Secret with a pull secret, like the Red Hat pull secret of
+	// OpenShift, whose auth entries are split by host
+	//+kubebuilder:validation:Optional
+	PullSecretRef *corev1.SecretKeySelector `json:"pullSecretRef,omitempty"`
+
+	// Hosts of the pull secret that are propagated, with wildcards in their
+	// domain segments like *.redhat.io. All of them are propagated when empty.
+	//+kubebuilder:validation:Optional
+	Hosts []string `json:"hosts,omitempty"`
+}
+
+// AlibabaContainerRegistry authenticates to Alibaba Cloud Container Registry
+// with temporary tokens requested with an AccessKey
+type AlibabaContainerRegistry struct {
+	// Region of the registry, like cn-hangzhou
+	//+kubebuilder:validation:Required
+	Region string `json:"region"`
+
+	// ID of the Enterprise Edition instance. The Personal Edition is used when
+	// empty.
+	//+kubebuilder:validation:Optional
+	InstanceID string `json:"instanceId,omitempty"`
+
+	// Secret with the accessKeyId and accessKeySecret keys of the AccessKey
+	//+kubebuilder:validation:Required
+	AccessKeySecretRef corev1.LocalObjectReference `json:"accessKeySecretRef"`
+
+	// URL of the Container Registry API. Defaults to
+	// https://cr.<region>.aliyuncs.com.
+	//+kubebuilder:validation:Optional
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// PEM encoded CA bundle to verify the Container Registry API. The system
+	// CAs are used when empty.
+	//+kubebuilder:validation:Optional
+	CABundle []byte `json:"caBundle,omitempty"`
+
+	// Registry host. Defaults to registry.<region>.aliyuncs.com for the
+	// Personal Edition, and is required for the Enterprise Edition.
+	//+kubebuilder:validation:Optional
+	Registry string `json:"registry,omitempty"`
+}
+
+// OracleContainerRegistry authenticates to Oracle Cloud Infrastructure
+// Registry with the auth token of a user
+type OracleContainerRegistry struct {
+	// Region of the registry, by identifier like us-ashburn-1 or key like iad
+	//+kubebuilder:validation:Required
+	Region string `json:"region"`
+
+	// Object Storage namespace of the tenancy
+	//+kubebuilder:validation:Required
+	TenancyNamespace string `json:"tenancyNamespace"`
+
+	// Username, including the identity provider if federated, like
+	// oracleidentitycloudservice/user@example.com
+	//+kubebuilder:validation:Required
+	Username string `json:"username"`
+
+	// Key of a Secret with the auth token of the user
+	//+kubebuilder:validation:Required
+	AuthTokenSecretRef corev1.SecretKeySelector `json:"authTokenSecretRef"`
+
+	// URL of the registry used to validate the auth token. Defaults to
+	// https://<region>.ocir.io.
+	//+kubebuilder:validation:Optional
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// PEM encoded CA bundle to verify the registry. The system CAs are used
+	// when empty.
+	//+kubebuilder:validation:Optional
+	CABundle []byte `json:"caBundle,omitempty"`
+
+	// Registry host. Defaults to <region>.ocir.io.
+	//+kubebuilder:validation:Optional
+	Registry string `json:"registry,omitempty"`
+}
+
+// PullRateLimit is the pull quota of the credentials reported by the registry
+type PullRateLimit struct {
+	// Number of pulls allowed in the window
+	Limit int64 `json:"limit"`
+
+	// Number of pulls remaining in the window
+	Remaining int64 `json:"remaining"`
+
+	// Duration of the window
+	//+kubebuilder:validation:Optional
+	Window *metav1.Duration `json:"window,omitempty"`
+
+	// Time when the rate limit was observed
+	ObservedTime metav1.Time `json:"observedTime"`
+}
+
 // RegistryCredentialsStatus defines the observed state of RegistryCredentials
 type RegistryCredentialsStatus struct {
 	//+kubebuilder:validation:Optional
@@ -66,8 +575,43 @@ type RegistryCredentialsStatus struct {
 
 	//+kubebuilder:validation:Optional
 	AuthenticatedTime *metav1.Time `json:"authenticatedTime,omitempty"`
+
+	// Pull quota of the credentials, for providers reporting it
+	//+kubebuilder:validation:Optional
+	PullRateLimit *PullRateLimit `json:"pullRateLimit,omitempty"`
+
+	// Conditions of the RegistryCredentials, like Pullable when a health
+	// check is configured
+	//+kubebuilder:validation:Optional
+	//+listType=map
+	//+listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+
+	// Credentials issued by the providers, like robot accounts, that are
+	// revoked when they are replaced or the RegistryCredentials is deleted
+	//+kubebuilder:validation:Optional
+	IssuedCredentials []IssuedCredentials `json:"issuedCredentials,omitempty"`
+}
+
+// IssuedCredentials are credentials issued by a provider that must be revoked
+type IssuedCredentials struct {
+	// Provider that issued the credentials, used to revoke them even if the
+	// provider of the RegistryCredentials changes
+	//+kubebuilder:validation:Required
+	Provider RegistryProvider `json:"provider"`
+
+	// Annotations identifying the credentials in the provider, like the ID of
+	// the robot account
+	//+kubebuilder:validation:Required
+	Annotations map[string]string `json:"annotations"`
 }
 
+const (
+	// ConditionPullable reports whether the credentials can pull the image
+	// of the health check
+	ConditionPullable = "Pullable"
+)
+
 type RegistryCredentialsState string
 
 var (
@@ -81,6 +625,7 @@ var (
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
 //+kubebuilder:printcolumn:name="Status",type=string,JSONPath=`.status.state`
+//+kubebuilder:printcolumn:name="Pullable",type=string,JSONPath=`.status.conditions[?(@.type=="Pullable")].status`,priority=1
 
 // RegistryCredentials is the Schema for the registrycredentials API
 type RegistryCredentials struct {
@@ -17,12 +17,15 @@ limitations under the License.
 package v1alpha1
 
 import (
-	"errors"
+	"fmt"
+	"strings"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
+
+	"github.com/astrokube/registry-controller/pkg/cosign"
 )
 
 // log is for logging in this package.
@@ -53,22 +56,30 @@ var _ webhook.Validator = &RegistryCredentials{}
 func (r *RegistryCredentials) ValidateCreate() error {
 	registrycredentialslog.Info("validate create", "name", r.Name)
 
-	if r.Spec.Provider.AWSElasticContainerRegistry == nil {
-		return errors.New("You must set a provider")
+	if err := r.validateProvider(); err != nil {
+		return err
 	}
 
-	return nil
+	if err := r.validateMirrors(); err != nil {
+		return err
+	}
+
+	return r.validateSignatures()
 }
 
 // ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
 func (r *RegistryCredentials) ValidateUpdate(old runtime.Object) error {
 	registrycredentialslog.Info("validate update", "name", r.Name)
 
-	if r.Spec.Provider.AWSElasticContainerRegistry == nil {
-		return ErrProviderNotSet
+	if err := r.validateProvider(); err != nil {
+		return err
 	}
 
-	return nil
+	if err := r.validateMirrors(); err != nil {
+		return err
+	}
+
+	return r.validateSignatures()
 }
 
 // ValidateDelete implements webhook.Validator so a webhook will be registered for the type
@@ -77,3 +88,49 @@ func (r *RegistryCredentials) ValidateDelete() error {
 
 	return nil
 }
+
+// ProviderValidator validates the provider of the RegistryCredentials. The API
+// can't depend on the providers, so it is set on startup to the validator of
+// the providers registry.
+var ProviderValidator func(r *RegistryCredentials) error
+
+func (r *RegistryCredentials) validateProvider() error {
+	if ProviderValidator != nil {
+		return ProviderValidator(r)
+	}
+	if len(r.Spec.Provider.Names()) == 0 {
+		return ErrProviderNotSet
+	}
+
+	return nil
+}
+
+// validateMirrors checks that the mirrors and their upstreams are image
+// prefixes, like harbor.example.com/dockerhub-proxy, and not URLs
+func (r *RegistryCredentials) validateMirrors() error {
+	for i, mirror := range r.Spec.Mirrors {
+		for field, prefix := range map[string]string{"prefix": mirror.Prefix, "upstream": mirror.Upstream} {
+			if prefix == "" && field == "upstream" {
+				continue
+			}
+			if prefix == "" || strings.Contains(prefix, "://") || strings.HasSuffix(prefix, "/") || strings.ContainsAny(prefix, "@ ") {
+				return fmt.Errorf("mirrors[%d].%s must be a host or an image prefix like harbor.example.com/proxy, got %q", i, field, prefix)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateSignatures checks that the public keys of the signature verification
+// are PEM encoded ECDSA keys
+func (r *RegistryCredentials) validateSignatures() error {
+	if r.Spec.VerifySignatures == nil {
+		return nil
+	}
+	if _, err := cosign.ParsePublicKeys(r.Spec.VerifySignatures.PublicKeys); err != nil {
+		return fmt.Errorf("verifySignatures.publicKeys: %w", err)
+	}
+
+	return nil
+}
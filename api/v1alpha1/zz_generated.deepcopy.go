@@ -21,9 +21,32 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AlibabaContainerRegistry) DeepCopyInto(out *AlibabaContainerRegistry) {
+	*out = *in
+	out.AccessKeySecretRef = in.AccessKeySecretRef
+	if in.CABundle != nil {
+		in, out := &in.CABundle, &out.CABundle
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AlibabaContainerRegistry.
+func (in *AlibabaContainerRegistry) DeepCopy() *AlibabaContainerRegistry {
+	if in == nil {
+		return nil
+	}
+	out := new(AlibabaContainerRegistry)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AWSElasticContainerRegistry) DeepCopyInto(out *AWSElasticContainerRegistry) {
 	*out = *in
@@ -39,6 +62,267 @@ func (in *AWSElasticContainerRegistry) DeepCopy() *AWSElasticContainerRegistry {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DockerHubProvider) DeepCopyInto(out *DockerHubProvider) {
+	*out = *in
+	out.CredentialsSecretRef = in.CredentialsSecretRef
+	if in.CABundle != nil {
+		in, out := &in.CABundle, &out.CABundle
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DockerHubProvider.
+func (in *DockerHubProvider) DeepCopy() *DockerHubProvider {
+	if in == nil {
+		return nil
+	}
+	out := new(DockerHubProvider)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExecEnvVar) DeepCopyInto(out *ExecEnvVar) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExecEnvVar.
+func (in *ExecEnvVar) DeepCopy() *ExecEnvVar {
+	if in == nil {
+		return nil
+	}
+	out := new(ExecEnvVar)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExecProvider) DeepCopyInto(out *ExecProvider) {
+	*out = *in
+	if in.Args != nil {
+		in, out := &in.Args, &out.Args
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Env != nil {
+		in, out := &in.Env, &out.Env
+		*out = make([]ExecEnvVar, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExecProvider.
+func (in *ExecProvider) DeepCopy() *ExecProvider {
+	if in == nil {
+		return nil
+	}
+	out := new(ExecProvider)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GitHubContainerRegistry) DeepCopyInto(out *GitHubContainerRegistry) {
+	*out = *in
+	in.PrivateKeySecretRef.DeepCopyInto(&out.PrivateKeySecretRef)
+	if in.CABundle != nil {
+		in, out := &in.CABundle, &out.CABundle
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GitHubContainerRegistry.
+func (in *GitHubContainerRegistry) DeepCopy() *GitHubContainerRegistry {
+	if in == nil {
+		return nil
+	}
+	out := new(GitHubContainerRegistry)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GitLabProvider) DeepCopyInto(out *GitLabProvider) {
+	*out = *in
+	if in.CABundle != nil {
+		in, out := &in.CABundle, &out.CABundle
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+	if in.DeployTokenSecretRef != nil {
+		in, out := &in.DeployTokenSecretRef, &out.DeployTokenSecretRef
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
+	if in.AccessTokenSecretRef != nil {
+		in, out := &in.AccessTokenSecretRef, &out.AccessTokenSecretRef
+		*out = new(v1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RotationInterval != nil {
+		in, out := &in.RotationInterval, &out.RotationInterval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GitLabProvider.
+func (in *GitLabProvider) DeepCopy() *GitLabProvider {
+	if in == nil {
+		return nil
+	}
+	out := new(GitLabProvider)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HealthCheck) DeepCopyInto(out *HealthCheck) {
+	*out = *in
+	if in.Interval != nil {
+		in, out := &in.Interval, &out.Interval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HealthCheck.
+func (in *HealthCheck) DeepCopy() *HealthCheck {
+	if in == nil {
+		return nil
+	}
+	out := new(HealthCheck)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HarborProvider) DeepCopyInto(out *HarborProvider) {
+	*out = *in
+	out.CredentialsSecretRef = in.CredentialsSecretRef
+	if in.CABundle != nil {
+		in, out := &in.CABundle, &out.CABundle
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+	if in.RotationInterval != nil {
+		in, out := &in.RotationInterval, &out.RotationInterval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HarborProvider.
+func (in *HarborProvider) DeepCopy() *HarborProvider {
+	if in == nil {
+		return nil
+	}
+	out := new(HarborProvider)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ImageRewritePolicy) DeepCopyInto(out *ImageRewritePolicy) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImageRewritePolicy.
+func (in *ImageRewritePolicy) DeepCopy() *ImageRewritePolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(ImageRewritePolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ImageRewritePolicy) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ImageRewritePolicyList) DeepCopyInto(out *ImageRewritePolicyList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ImageRewritePolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImageRewritePolicyList.
+func (in *ImageRewritePolicyList) DeepCopy() *ImageRewritePolicyList {
+	if in == nil {
+		return nil
+	}
+	out := new(ImageRewritePolicyList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ImageRewritePolicyList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ImageRewritePolicySpec) DeepCopyInto(out *ImageRewritePolicySpec) {
+	*out = *in
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Rules != nil {
+		in, out := &in.Rules, &out.Rules
+		*out = make([]ImageRewriteRule, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImageRewritePolicySpec.
+func (in *ImageRewritePolicySpec) DeepCopy() *ImageRewritePolicySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ImageRewritePolicySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ImageRewriteRule) DeepCopyInto(out *ImageRewriteRule) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImageRewriteRule.
+func (in *ImageRewriteRule) DeepCopy() *ImageRewriteRule {
+	if in == nil {
+		return nil
+	}
+	out := new(ImageRewriteRule)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ImageSelector) DeepCopyInto(out *ImageSelector) {
 	*out = *in
@@ -64,6 +348,131 @@ func (in *ImageSelector) DeepCopy() *ImageSelector {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IssuedCredentials) DeepCopyInto(out *IssuedCredentials) {
+	*out = *in
+	in.Provider.DeepCopyInto(&out.Provider)
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IssuedCredentials.
+func (in *IssuedCredentials) DeepCopy() *IssuedCredentials {
+	if in == nil {
+		return nil
+	}
+	out := new(IssuedCredentials)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Mirror) DeepCopyInto(out *Mirror) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Mirror.
+func (in *Mirror) DeepCopy() *Mirror {
+	if in == nil {
+		return nil
+	}
+	out := new(Mirror)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OracleContainerRegistry) DeepCopyInto(out *OracleContainerRegistry) {
+	*out = *in
+	in.AuthTokenSecretRef.DeepCopyInto(&out.AuthTokenSecretRef)
+	if in.CABundle != nil {
+		in, out := &in.CABundle, &out.CABundle
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OracleContainerRegistry.
+func (in *OracleContainerRegistry) DeepCopy() *OracleContainerRegistry {
+	if in == nil {
+		return nil
+	}
+	out := new(OracleContainerRegistry)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PinDigests) DeepCopyInto(out *PinDigests) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PinDigests.
+func (in *PinDigests) DeepCopy() *PinDigests {
+	if in == nil {
+		return nil
+	}
+	out := new(PinDigests)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PullRateLimit) DeepCopyInto(out *PullRateLimit) {
+	*out = *in
+	if in.Window != nil {
+		in, out := &in.Window, &out.Window
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	in.ObservedTime.DeepCopyInto(&out.ObservedTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PullRateLimit.
+func (in *PullRateLimit) DeepCopy() *PullRateLimit {
+	if in == nil {
+		return nil
+	}
+	out := new(PullRateLimit)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *QuayProvider) DeepCopyInto(out *QuayProvider) {
+	*out = *in
+	if in.RobotAccountSecretRef != nil {
+		in, out := &in.RobotAccountSecretRef, &out.RobotAccountSecretRef
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
+	if in.PullSecretRef != nil {
+		in, out := &in.PullSecretRef, &out.PullSecretRef
+		*out = new(v1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Hosts != nil {
+		in, out := &in.Hosts, &out.Hosts
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QuayProvider.
+func (in *QuayProvider) DeepCopy() *QuayProvider {
+	if in == nil {
+		return nil
+	}
+	out := new(QuayProvider)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RegistryCredentials) DeepCopyInto(out *RegistryCredentials) {
 	*out = *in
@@ -128,6 +537,26 @@ func (in *RegistryCredentialsSpec) DeepCopyInto(out *RegistryCredentialsSpec) {
 	*out = *in
 	in.Provider.DeepCopyInto(&out.Provider)
 	in.ImageSelector.DeepCopyInto(&out.ImageSelector)
+	if in.Mirrors != nil {
+		in, out := &in.Mirrors, &out.Mirrors
+		*out = make([]Mirror, len(*in))
+		copy(*out, *in)
+	}
+	if in.PinDigests != nil {
+		in, out := &in.PinDigests, &out.PinDigests
+		*out = new(PinDigests)
+		**out = **in
+	}
+	if in.HealthCheck != nil {
+		in, out := &in.HealthCheck, &out.HealthCheck
+		*out = new(HealthCheck)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.VerifySignatures != nil {
+		in, out := &in.VerifySignatures, &out.VerifySignatures
+		*out = new(VerifySignatures)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RegistryCredentialsSpec.
@@ -151,6 +580,25 @@ func (in *RegistryCredentialsStatus) DeepCopyInto(out *RegistryCredentialsStatus
 		in, out := &in.AuthenticatedTime, &out.AuthenticatedTime
 		*out = (*in).DeepCopy()
 	}
+	if in.PullRateLimit != nil {
+		in, out := &in.PullRateLimit, &out.PullRateLimit
+		*out = new(PullRateLimit)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.IssuedCredentials != nil {
+		in, out := &in.IssuedCredentials, &out.IssuedCredentials
+		*out = make([]IssuedCredentials, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RegistryCredentialsStatus.
@@ -171,6 +619,56 @@ func (in *RegistryProvider) DeepCopyInto(out *RegistryProvider) {
 		*out = new(AWSElasticContainerRegistry)
 		**out = **in
 	}
+	if in.Exec != nil {
+		in, out := &in.Exec, &out.Exec
+		*out = new(ExecProvider)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.WebhookProvider != nil {
+		in, out := &in.WebhookProvider, &out.WebhookProvider
+		*out = new(WebhookProvider)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Vault != nil {
+		in, out := &in.Vault, &out.Vault
+		*out = new(VaultProvider)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Harbor != nil {
+		in, out := &in.Harbor, &out.Harbor
+		*out = new(HarborProvider)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.GitHubContainerRegistry != nil {
+		in, out := &in.GitHubContainerRegistry, &out.GitHubContainerRegistry
+		*out = new(GitHubContainerRegistry)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.GitLab != nil {
+		in, out := &in.GitLab, &out.GitLab
+		*out = new(GitLabProvider)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DockerHub != nil {
+		in, out := &in.DockerHub, &out.DockerHub
+		*out = new(DockerHubProvider)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Quay != nil {
+		in, out := &in.Quay, &out.Quay
+		*out = new(QuayProvider)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AlibabaContainerRegistry != nil {
+		in, out := &in.AlibabaContainerRegistry, &out.AlibabaContainerRegistry
+		*out = new(AlibabaContainerRegistry)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.OracleContainerRegistry != nil {
+		in, out := &in.OracleContainerRegistry, &out.OracleContainerRegistry
+		*out = new(OracleContainerRegistry)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RegistryProvider.
@@ -182,3 +680,89 @@ func (in *RegistryProvider) DeepCopy() *RegistryProvider {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultFields) DeepCopyInto(out *VaultFields) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultFields.
+func (in *VaultFields) DeepCopy() *VaultFields {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultFields)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultProvider) DeepCopyInto(out *VaultProvider) {
+	*out = *in
+	if in.CABundle != nil {
+		in, out := &in.CABundle, &out.CABundle
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+	out.Fields = in.Fields
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultProvider.
+func (in *VaultProvider) DeepCopy() *VaultProvider {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultProvider)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VerifySignatures) DeepCopyInto(out *VerifySignatures) {
+	*out = *in
+	if in.PublicKeys != nil {
+		in, out := &in.PublicKeys, &out.PublicKeys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VerifySignatures.
+func (in *VerifySignatures) DeepCopy() *VerifySignatures {
+	if in == nil {
+		return nil
+	}
+	out := new(VerifySignatures)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WebhookProvider) DeepCopyInto(out *WebhookProvider) {
+	*out = *in
+	if in.CABundle != nil {
+		in, out := &in.CABundle, &out.CABundle
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+	if in.BearerTokenSecretRef != nil {
+		in, out := &in.BearerTokenSecretRef, &out.BearerTokenSecretRef
+		*out = new(v1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ClientCertificateSecretRef != nil {
+		in, out := &in.ClientCertificateSecretRef, &out.ClientCertificateSecretRef
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WebhookProvider.
+func (in *WebhookProvider) DeepCopy() *WebhookProvider {
+	if in == nil {
+		return nil
+	}
+	out := new(WebhookProvider)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,243 @@
+/*
+Copyright 2021 AstroKube.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	registryv1alpha1 "github.com/astrokube/registry-controller/api/v1alpha1"
+	"github.com/astrokube/registry-controller/pkg/metrics"
+	"github.com/astrokube/registry-controller/pkg/registry"
+	"github.com/astrokube/registry-controller/pkg/tracing"
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultHealthCheckInterval is the default duration between the health checks
+// of a RegistryCredentials
+const DefaultHealthCheckInterval = 5 * time.Minute
+
+// DefaultHealthCheckTimeout is the maximum duration of a health check
+const DefaultHealthCheckTimeout = 10 * time.Second
+
+// defaultRegistryClient is used by the reconcilers that don't set a registry
+// client
+var defaultRegistryClient = registry.NewClient(nil)
+
+// HealthCheckReconciler periodically verifies that the credentials of the
+// RegistryCredentials with a health check can pull its image. The
+// RegistryCredentialsReconciler also runs the health check after every
+// refresh, before reporting the Authenticated state.
+type HealthCheckReconciler struct {
+	client.Client
+	Recorder record.EventRecorder
+	// Registry is the client used to request the manifests. Defaults to a
+	// client using the default HTTP client.
+	Registry *registry.Client
+}
+
+// Reconcile runs the health check of the RegistryCredentials and schedules the
+// next one
+func (r *HealthCheckReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "HealthCheck.Reconcile", trace.WithAttributes(
+		attribute.String("namespace", req.Namespace),
+		attribute.String("name", req.Name),
+	))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	l := log.FromContext(ctx)
+	registryCredentials := &registryv1alpha1.RegistryCredentials{}
+	if err := r.Get(ctx, req.NamespacedName, registryCredentials); err != nil {
+		if client.IgnoreNotFound(err) == nil {
+			metrics.Pullable.DeleteLabelValues(req.Namespace, req.Name)
+			return ctrl.Result{}, nil
+		}
+		l.Error(err, "Unable to get RegistryCredentials")
+		return ctrl.Result{}, err
+	}
+	if !registryCredentials.ObjectMeta.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	original := registryCredentials.DeepCopy()
+	if registryCredentials.Spec.HealthCheck == nil {
+		metrics.Pullable.DeleteLabelValues(req.Namespace, req.Name)
+		meta.RemoveStatusCondition(&registryCredentials.Status.Conditions, registryv1alpha1.ConditionPullable)
+		return ctrl.Result{}, r.patchStatus(ctx, l, original, registryCredentials)
+	}
+	requeueAfter := healthCheckInterval(registryCredentials.Spec.HealthCheck)
+
+	// The credentials are checked by the RegistryCredentialsReconciler while
+	// they are being refreshed
+	if registryCredentials.Status.State != registryv1alpha1.RegistryCredentialsAuthenticated {
+		return ctrl.Result{RequeueAfter: requeueAfter}, nil
+	}
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, req.NamespacedName, secret); err != nil {
+		if client.IgnoreNotFound(err) == nil {
+			return ctrl.Result{RequeueAfter: requeueAfter}, nil
+		}
+		l.Error(err, "Unable to get Secret")
+		return ctrl.Result{}, err
+	}
+
+	checkHealth(ctx, l, r.Registry, r.Recorder, registryCredentials, secret)
+	if err := r.patchStatus(ctx, l, original, registryCredentials); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *HealthCheckReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("healthcheck").
+		For(&registryv1alpha1.RegistryCredentials{}).
+		WithEventFilter(predicate.GenerationChangedPredicate{}).
+		Complete(r)
+}
+
+// patchStatus patches the status of the RegistryCredentials if it changed
+func (r *HealthCheckReconciler) patchStatus(ctx context.Context, log logr.Logger, original, registryCredentials *registryv1alpha1.RegistryCredentials) error {
+	if equality.Semantic.DeepEqual(original.Status, registryCredentials.Status) {
+		return nil
+	}
+	if err := r.Status().Patch(ctx, registryCredentials, client.MergeFrom(original)); err != nil {
+		log.Error(err, "Unable to set status")
+		return err
+	}
+
+	return nil
+}
+
+// healthCheckInterval returns the duration between the health checks
+func healthCheckInterval(healthCheck *registryv1alpha1.HealthCheck) time.Duration {
+	if healthCheck.Interval == nil || healthCheck.Interval.Duration <= 0 {
+		return DefaultHealthCheckInterval
+	}
+
+	return healthCheck.Interval.Duration
+}
+
+// checkHealth requests the manifest of the image of the health check with the
+// credentials of the Secret, and reports the result in the Pullable condition
+// of the RegistryCredentials and in the metrics. Transitions of the condition
+// are recorded as events.
+func checkHealth(ctx context.Context, log logr.Logger, registryClient *registry.Client, recorder record.EventRecorder, registryCredentials *registryv1alpha1.RegistryCredentials, secret *corev1.Secret) {
+	ctx, span := tracing.Tracer().Start(ctx, "checkHealth")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, DefaultHealthCheckTimeout)
+	defer cancel()
+
+	if registryClient == nil {
+		registryClient = defaultRegistryClient
+	}
+	image := registryCredentials.Spec.HealthCheck.Image
+	condition := pullableCondition(ctx, registryClient, image, secret.Data[corev1.DockerConfigJsonKey])
+	condition.ObservedGeneration = registryCredentials.ObjectMeta.Generation
+	span.SetAttributes(attribute.String("reason", condition.Reason))
+
+	var previous *metav1.Condition
+	if existing := meta.FindStatusCondition(registryCredentials.Status.Conditions, registryv1alpha1.ConditionPullable); existing != nil {
+		previous = existing.DeepCopy()
+	}
+	meta.SetStatusCondition(&registryCredentials.Status.Conditions, condition)
+
+	pullable := 0.0
+	if condition.Status == metav1.ConditionTrue {
+		pullable = 1
+	}
+	metrics.Pullable.WithLabelValues(registryCredentials.ObjectMeta.Namespace, registryCredentials.ObjectMeta.Name).Set(pullable)
+
+	if previous != nil && previous.Status == condition.Status && previous.Reason == condition.Reason {
+		return
+	}
+	if condition.Status == metav1.ConditionTrue {
+		if previous != nil {
+			recorder.Event(registryCredentials, corev1.EventTypeNormal, "Pullable", condition.Message)
+		}
+		return
+	}
+	log.Info("Health check failed", "image", image, "reason", condition.Reason, "message", condition.Message)
+	recorder.Event(registryCredentials, corev1.EventTypeWarning, "NotPullable", condition.Message)
+}
+
+// pullableCondition requests the manifest of the image with the auth found in
+// the dockerconfigjson. Errors other than missing images and rejected
+// credentials leave the condition Unknown.
+func pullableCondition(ctx context.Context, registryClient *registry.Client, image string, dockerConfig []byte) metav1.Condition {
+	condition := metav1.Condition{
+		Type:   registryv1alpha1.ConditionPullable,
+		Status: metav1.ConditionFalse,
+	}
+
+	ref, err := registry.ParseReference(image)
+	if err != nil {
+		condition.Reason = "InvalidImage"
+		condition.Message = fmt.Sprintf("Invalid image %q: %v", image, err)
+		return condition
+	}
+	auth, err := registry.AuthFor(dockerConfig, ref)
+	if err != nil {
+		condition.Reason = "InvalidSecret"
+		condition.Message = fmt.Sprintf("Unable to read the credentials of the Secret: %v", err)
+		return condition
+	}
+	if auth == "" {
+		condition.Reason = "CredentialsNotFound"
+		condition.Message = fmt.Sprintf("The Secret has no credentials for the registry of the image %q", image)
+		return condition
+	}
+
+	_, _, err = registryClient.GetManifest(ctx, ref, auth)
+	switch {
+	case err == nil:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "ManifestPulled"
+		condition.Message = fmt.Sprintf("Pulled the manifest of the image %q", image)
+	case registry.IsNotFound(err):
+		condition.Reason = "ImageNotFound"
+		condition.Message = fmt.Sprintf("The image %q doesn't exist", image)
+	case registry.IsUnauthorized(err):
+		condition.Reason = "Unauthorized"
+		condition.Message = fmt.Sprintf("The credentials can't pull the image %q: %v", image, err)
+	default:
+		condition.Status = metav1.ConditionUnknown
+		condition.Reason = "RegistryError"
+		condition.Message = fmt.Sprintf("Unable to request the manifest of the image %q: %v", image, err)
+	}
+
+	return condition
+}
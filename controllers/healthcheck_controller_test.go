@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	registryv1alpha1 "github.com/astrokube/registry-controller/api/v1alpha1"
+	"github.com/astrokube/registry-controller/pkg/metrics"
+	"github.com/astrokube/registry-controller/pkg/registry"
+	"github.com/astrokube/registry-controller/pkg/registry/registrytest"
+)
+
+var _ = Describe("HealthCheck controller", func() {
+	const namespace = "default"
+
+	var server *registrytest.Server
+	key := types.NamespacedName{Name: "private", Namespace: namespace}
+
+	BeforeEach(func() {
+		server = registrytest.NewServer("user", "password")
+		server.PushImage("team/app", "1.0")
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	newHealthCheckReconciler := func(healthCheck *registryv1alpha1.HealthCheck, dockerConfig []byte) *HealthCheckReconciler {
+		testScheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(testScheme)).To(Succeed())
+		Expect(registryv1alpha1.AddToScheme(testScheme)).To(Succeed())
+
+		registryCredentials := &registryv1alpha1.RegistryCredentials{
+			ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+			Spec:       registryv1alpha1.RegistryCredentialsSpec{HealthCheck: healthCheck},
+			Status: registryv1alpha1.RegistryCredentialsStatus{
+				State: registryv1alpha1.RegistryCredentialsAuthenticated,
+				Conditions: []metav1.Condition{{
+					Type:               registryv1alpha1.ConditionPullable,
+					Status:             metav1.ConditionTrue,
+					Reason:             "ManifestPulled",
+					LastTransitionTime: metav1.Now(),
+				}},
+			},
+		}
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data:       map[string][]byte{corev1.DockerConfigJsonKey: dockerConfig},
+		}
+
+		return &HealthCheckReconciler{
+			Client:   fake.NewClientBuilder().WithScheme(testScheme).WithObjects(registryCredentials, secret).Build(),
+			Recorder: record.NewFakeRecorder(10),
+			Registry: registry.NewClient(server.Client()),
+		}
+	}
+
+	reconcile := func(r *HealthCheckReconciler) (ctrl.Result, *metav1.Condition) {
+		result, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+
+		registryCredentials := &registryv1alpha1.RegistryCredentials{}
+		Expect(r.Get(context.Background(), key, registryCredentials)).To(Succeed())
+
+		return result, meta.FindStatusCondition(registryCredentials.Status.Conditions, registryv1alpha1.ConditionPullable)
+	}
+
+	Context("When the image can be pulled", func() {
+		It("Should set the Pullable condition and requeue after the interval", func() {
+			r := newHealthCheckReconciler(&registryv1alpha1.HealthCheck{
+				Image:    server.Host() + "/team/app:1.0",
+				Interval: &metav1.Duration{Duration: time.Minute},
+			}, server.DockerConfigJSON())
+
+			result, condition := reconcile(r)
+			Expect(result.RequeueAfter).To(Equal(time.Minute))
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+			Expect(server.Requests("team/app", "1.0")).To(Equal(1))
+			Expect(testutil.ToFloat64(metrics.Pullable.WithLabelValues(namespace, key.Name))).To(Equal(1.0))
+			Expect(r.Recorder.(*record.FakeRecorder).Events).NotTo(Receive())
+		})
+	})
+
+	Context("When the image doesn't exist", func() {
+		It("Should set the Pullable condition to False", func() {
+			r := newHealthCheckReconciler(&registryv1alpha1.HealthCheck{Image: server.Host() + "/team/app:missing"}, server.DockerConfigJSON())
+
+			result, condition := reconcile(r)
+			Expect(result.RequeueAfter).To(Equal(DefaultHealthCheckInterval))
+			Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+			Expect(condition.Reason).To(Equal("ImageNotFound"))
+			Expect(testutil.ToFloat64(metrics.Pullable.WithLabelValues(namespace, key.Name))).To(BeZero())
+			Expect(r.Recorder.(*record.FakeRecorder).Events).To(Receive(ContainSubstring("NotPullable")))
+		})
+	})
+
+	Context("When the credentials are rejected", func() {
+		It("Should set the Pullable condition to False", func() {
+			r := newHealthCheckReconciler(
+				&registryv1alpha1.HealthCheck{Image: server.Host() + "/team/app:1.0"},
+				[]byte(`{"auths":{"`+server.Host()+`":{"auth":"aW52YWxpZDppbnZhbGlk"}}}`),
+			)
+
+			_, condition := reconcile(r)
+			Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+			Expect(condition.Reason).To(Equal("Unauthorized"))
+		})
+	})
+
+	Context("When the registry can't be reached", func() {
+		It("Should set the Pullable condition to Unknown", func() {
+			r := newHealthCheckReconciler(&registryv1alpha1.HealthCheck{Image: server.Host() + "/team/app:1.0"}, server.DockerConfigJSON())
+			server.Close()
+
+			_, condition := reconcile(r)
+			Expect(condition.Status).To(Equal(metav1.ConditionUnknown))
+			Expect(condition.Reason).To(Equal("RegistryError"))
+		})
+	})
+
+	Context("When the health check is removed", func() {
+		It("Should remove the Pullable condition", func() {
+			r := newHealthCheckReconciler(nil, server.DockerConfigJSON())
+
+			result, condition := reconcile(r)
+			Expect(result.RequeueAfter).To(BeZero())
+			Expect(condition).To(BeNil())
+		})
+	})
+})
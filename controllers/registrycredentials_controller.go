@@ -18,34 +18,59 @@ package controllers
 
 import (
 	"context"
-	"fmt"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	"github.com/astrokube/registry-controller/api/v1alpha1"
 	registryv1alpha1 "github.com/astrokube/registry-controller/api/v1alpha1"
+	"github.com/astrokube/registry-controller/pkg/metrics"
 	"github.com/astrokube/registry-controller/pkg/providers"
+	"github.com/astrokube/registry-controller/pkg/registry"
+	"github.com/astrokube/registry-controller/pkg/tracing"
 	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// DefaultProviderTimeout is the default maximum duration of the calls to the
+// providers
+const DefaultProviderTimeout = 30 * time.Second
+
+// DefaultRefreshInterval is the maximum duration between authentications. Tokens
+// expiring earlier are refreshed before their expiration.
+const DefaultRefreshInterval = 30 * time.Minute
+
+// RevokeFinalizer is added to RegistryCredentials whose provider issues
+// credentials that must be revoked on deletion
+const RevokeFinalizer = "registry.astrokube.com/revoke-credentials"
+
 // RegistryCredentialsReconciler reconciles a RegistryCredentials object
 type RegistryCredentialsReconciler struct {
 	client.Client
 	Recorder record.EventRecorder
 	Scheme   *runtime.Scheme
+	// ProviderTimeout is the maximum duration of every call to a provider.
+	// Defaults to DefaultProviderTimeout.
+	ProviderTimeout time.Duration
+	// Registry is the client used to run the health checks. Defaults to a
+	// client using the default HTTP client.
+	Registry *registry.Client
 }
 
 //+kubebuilder:rbac:groups=core,resources=secrets;events,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=serviceaccounts/token,verbs=create
 //+kubebuilder:rbac:groups=registry.astrokube.com,resources=registrycredentials,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=registry.astrokube.com,resources=registrycredentials/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=registry.astrokube.com,resources=registrycredentials/finalizers,verbs=update
@@ -59,7 +84,16 @@ type RegistryCredentialsReconciler struct {
 //
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.8.3/pkg/reconcile
-func (r *RegistryCredentialsReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+func (r *RegistryCredentialsReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "RegistryCredentials.Reconcile", trace.WithAttributes(
+		attribute.String("namespace", req.Namespace),
+		attribute.String("name", req.Name),
+	))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
 	l := log.FromContext(ctx)
 	registryCredentials := &registryv1alpha1.RegistryCredentials{}
 
@@ -68,6 +102,7 @@ func (r *RegistryCredentialsReconciler) Reconcile(ctx context.Context, req ctrl.
 	// Skip if registryCredentials doesn't exists
 	if err := r.Get(ctx, req.NamespacedName, registryCredentials); err != nil {
 		if client.IgnoreNotFound(err) == nil {
+			deleteMetrics(req.NamespacedName)
 			return ctrl.Result{}, nil
 		}
 		l.Error(err, "Unable to get RegistryCredentials")
@@ -76,20 +111,37 @@ func (r *RegistryCredentialsReconciler) Reconcile(ctx context.Context, req ctrl.
 
 	// registryCredentials is not going to be deleted
 	if registryCredentials.ObjectMeta.DeletionTimestamp.IsZero() {
-		if err := r.authenticate(l, registryCredentials); err != nil {
+		token, err := r.authenticate(ctx, l, registryCredentials)
+		if err != nil {
 			return ctrl.Result{}, err
 		}
-		// TODO: Receive this values as parameter
-		r, _ := time.ParseDuration("30m")
+		requeueAfter := DefaultRefreshInterval
+		if token != nil {
+			requeueAfter = token.RefreshAfter(time.Now(), DefaultRefreshInterval)
+		}
 		return ctrl.Result{
-			RequeueAfter: r,
+			RequeueAfter: requeueAfter,
 		}, nil
 	}
+	deleteMetrics(req.NamespacedName)
+
 	// Set Terminating status
-	if err := r.setStatus(l, registryCredentials, registryv1alpha1.RegistryCredentialsTerminating); err != nil {
+	if err := r.setStatus(ctx, l, registryCredentials, registryv1alpha1.RegistryCredentialsTerminating); err != nil {
 		return ctrl.Result{}, err
 	}
 
+	// Revoke the issued credentials before releasing the object
+	if controllerutil.ContainsFinalizer(registryCredentials, RevokeFinalizer) {
+		if err := r.revoke(ctx, l, registryCredentials); err != nil {
+			return ctrl.Result{}, err
+		}
+		controllerutil.RemoveFinalizer(registryCredentials, RevokeFinalizer)
+		if err := r.Update(ctx, registryCredentials); err != nil {
+			l.Error(err, "Unable to remove finalizer")
+			return ctrl.Result{}, err
+		}
+	}
+
 	return ctrl.Result{}, nil
 }
 
@@ -102,16 +154,14 @@ func (r *RegistryCredentialsReconciler) SetupWithManager(mgr ctrl.Manager) error
 				// Skip if triggered by status update
 				oldGeneration := e.ObjectOld.GetGeneration()
 				newGeneration := e.ObjectNew.GetGeneration()
-				return oldGeneration != newGeneration
+				return oldGeneration != newGeneration || !e.ObjectNew.GetDeletionTimestamp().IsZero()
 			},
 		}).
 		Complete(r)
 }
 
-func (r *RegistryCredentialsReconciler) setStatus(log logr.Logger, registryCredentials *registryv1alpha1.RegistryCredentials, state registryv1alpha1.RegistryCredentialsState) error {
-	ctx := context.Background()
-
-	if state != v1alpha1.RegistryCredentialsErrored {
+func (r *RegistryCredentialsReconciler) setStatus(ctx context.Context, log logr.Logger, registryCredentials *registryv1alpha1.RegistryCredentials, state registryv1alpha1.RegistryCredentialsState) error {
+	if state != v1alpha1.RegistryCredentialsErrored && state != v1alpha1.RegistryCredentialsUnauthorized {
 		registryCredentials.Status.ErrorMessage = ""
 	}
 	registryCredentials.Status.State = state
@@ -123,89 +173,292 @@ func (r *RegistryCredentialsReconciler) setStatus(log logr.Logger, registryCrede
 	return nil
 }
 
-func (r *RegistryCredentialsReconciler) authenticate(log logr.Logger, registryCredentials *registryv1alpha1.RegistryCredentials) error {
-	authenticator, err := r.getAuthenticator(log, registryCredentials)
+func (r *RegistryCredentialsReconciler) authenticate(ctx context.Context, log logr.Logger, registryCredentials *registryv1alpha1.RegistryCredentials) (*providers.Result, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "authenticate")
+	defer span.End()
+
+	provider, err := providers.Get(registryCredentials)
 	if err != nil {
-		log.Error(err, "Unable to get authenticator")
-		if err := r.setError(log, registryCredentials, err); err != nil {
-			return err
+		log.Error(err, "Unable to get provider")
+		if err := r.setError(ctx, log, registryCredentials, err); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	authenticator, err := provider.Factory(r.Client, registryCredentials)
+	if err != nil {
+		log.Error(err, "Unable to get authenticator", "provider", provider.DisplayName)
+		if err := r.setError(ctx, log, registryCredentials, err); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	// Add the finalizer before issuing credentials that must be revoked, and
+	// remove it once there are no issued credentials left to revoke
+	_, revoking := authenticator.(providers.Revoker)
+	switch finalized := controllerutil.ContainsFinalizer(registryCredentials, RevokeFinalizer); {
+	case revoking && !finalized:
+		controllerutil.AddFinalizer(registryCredentials, RevokeFinalizer)
+		if err := r.Update(ctx, registryCredentials); err != nil {
+			log.Error(err, "Unable to add finalizer")
+			return nil, err
+		}
+	case !revoking && finalized && len(registryCredentials.Status.IssuedCredentials) == 0:
+		controllerutil.RemoveFinalizer(registryCredentials, RevokeFinalizer)
+		if err := r.Update(ctx, registryCredentials); err != nil {
+			log.Error(err, "Unable to remove finalizer")
+			return nil, err
 		}
-		return nil
 	}
 	// Set Authenticated status
-	if err := r.setStatus(log, registryCredentials, registryv1alpha1.RegistryCredentialsAuthenticating); err != nil {
+	if err := r.setStatus(ctx, log, registryCredentials, registryv1alpha1.RegistryCredentialsAuthenticating); err != nil {
 		log.Error(err, "Unable to set status")
-		return err
+		return nil, err
 	}
 
-	intent := authenticator.GetToken(log, registryCredentials)
+	log.Info("Authenticating", "provider", provider.DisplayName)
+	result, err := r.getToken(ctx, log, provider.Name, authenticator, registryCredentials)
 
-	switch intent.State {
+	switch state := providers.GetState(err); state {
 	case v1alpha1.RegistryCredentialsErrored:
-		if err := r.setError(log, registryCredentials, intent.Error); err != nil {
+		if err := r.setError(ctx, log, registryCredentials, err); err != nil {
 			log.Error(err, "Unable to set error")
-			return err
+			return nil, err
 		}
 
-		return nil
+		return nil, nil
 	case v1alpha1.RegistryCredentialsAuthenticated:
-		secret := r.getSecret(registryCredentials, *intent)
-		err = r.createOrUpdateSecret(log, &secret)
+		// Record the issued credentials in the status before writing them, so
+		// they are revoked even if the Secret is deleted
+		_, ok := authenticator.(providers.Revoker)
+		if ok && recordIssuedCredentials(registryCredentials, result.Annotations) {
+			if err := r.Status().Update(ctx, registryCredentials); err != nil {
+				log.Error(err, "Unable to record the issued credentials")
+				return nil, err
+			}
+		}
+		secret, err := r.getSecret(registryCredentials, *result)
+		if err == nil {
+			err = r.createOrUpdateSecret(ctx, log, &secret)
+		}
 		if err != nil {
-			if err := r.setError(log, registryCredentials, err); err != nil {
+			if err := r.setError(ctx, log, registryCredentials, err); err != nil {
 				log.Error(err, "Unable to set error")
-				return err
+				return nil, err
 			}
 
-			return nil
+			return nil, nil
+		}
+		r.revokeReplaced(ctx, log, registryCredentials, result.Annotations)
+
+		key := client.ObjectKeyFromObject(registryCredentials)
+		if result.ExpiresAt != nil {
+			metrics.TokenExpiry.Set(key, *result.ExpiresAt)
+		}
+		setPullRateLimit(key, registryCredentials, result.PullRateLimit)
+		if registryCredentials.Spec.HealthCheck != nil {
+			checkHealth(ctx, log, r.Registry, r.Recorder, registryCredentials, &secret)
 		}
 
 		// Set Authenticated status
-		if err := r.setStatus(log, registryCredentials, registryv1alpha1.RegistryCredentialsAuthenticated); err != nil {
+		if err := r.setStatus(ctx, log, registryCredentials, registryv1alpha1.RegistryCredentialsAuthenticated); err != nil {
 			log.Error(err, "Unable to set status")
-			return err
+			return nil, err
 		}
-		return nil
+		return result, nil
 	default:
-		if err := r.setStatus(log, registryCredentials, intent.State); err != nil {
+		// Keep the reason why the provider rejected the credentials
+		registryCredentials.Status.ErrorMessage = err.Error()
+		if err := r.setStatus(ctx, log, registryCredentials, state); err != nil {
 			log.Error(err, "Unable to set status")
-			return err
+			return nil, err
 		}
 
-		return nil
+		return nil, nil
 	}
 }
 
-func (r *RegistryCredentialsReconciler) getAuthenticator(log logr.Logger, registryCredentials *registryv1alpha1.RegistryCredentials) (providers.Authenticator, error) {
-	if registryCredentials.Spec.Provider.AWSElasticContainerRegistry != nil {
-		return providers.NewAWSElasticContainerRegistryAuthenticator(registryCredentials.Spec.Provider.AWSElasticContainerRegistry), nil
+// getToken calls the authenticator bounded by the provider timeout.
+func (r *RegistryCredentialsReconciler) getToken(ctx context.Context, log logr.Logger, provider string, authenticator providers.Authenticator, registryCredentials *registryv1alpha1.RegistryCredentials) (*providers.Result, error) {
+	timeout := r.ProviderTimeout
+	if timeout <= 0 {
+		timeout = DefaultProviderTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ctx, span := tracing.Tracer().Start(ctx, "Authenticator.GetToken", trace.WithAttributes(
+		attribute.String("provider", provider),
+	))
+	defer span.End()
+
+	start := time.Now()
+	result, err := authenticator.GetToken(ctx, log, registryCredentials)
+	if err != nil && ctx.Err() == context.DeadlineExceeded && !providers.IsTimeout(err) {
+		err = &providers.TimeoutError{Err: err}
 	}
+	state := providers.GetState(err)
+
+	span.SetAttributes(attribute.String("state", string(state)))
+	tracing.RecordError(span, err)
+	metrics.AuthenticationDuration.WithLabelValues(provider).Observe(time.Since(start).Seconds())
+	metrics.Authentications.WithLabelValues(provider, string(state)).Inc()
 
-	return nil, fmt.Errorf("Provider not implemented")
+	return result, err
 }
 
-func (r *RegistryCredentialsReconciler) getSecret(registryCredentials *v1alpha1.RegistryCredentials, intent providers.AuthenticationIntent) corev1.Secret {
-	dockerConfig := fmt.Sprintf("{\"auths\":{\"%v\":{\"auth\":\"%v\"}}}", intent.Registry, intent.Token)
+// recordIssuedCredentials adds the credentials identified by the annotations
+// to the issued credentials of the status, with the provider that issued them,
+// and returns whether they weren't recorded yet
+func recordIssuedCredentials(registryCredentials *registryv1alpha1.RegistryCredentials, annotations map[string]string) bool {
+	if len(annotations) == 0 {
+		return false
+	}
+	for _, issued := range registryCredentials.Status.IssuedCredentials {
+		if !replaced(issued.Annotations, annotations) {
+			return false
+		}
+	}
+
+	issued := registryv1alpha1.IssuedCredentials{
+		Provider:    *registryCredentials.Spec.Provider.DeepCopy(),
+		Annotations: map[string]string{},
+	}
+	for key, value := range annotations {
+		issued.Annotations[key] = value
+	}
+	registryCredentials.Status.IssuedCredentials = append(registryCredentials.Status.IssuedCredentials, issued)
+
+	return true
+}
+
+// replaced returns whether the credentials identified by the old annotations
+// were replaced by the ones identified by the new annotations
+func replaced(old, new map[string]string) bool {
+	for key, value := range old {
+		if new[key] != value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// revokeReplaced revokes the issued credentials replaced by the current ones.
+// Failures are only reported, as the current credentials are already in use,
+// and the credentials are revoked again on the next rotation or on deletion.
+func (r *RegistryCredentialsReconciler) revokeReplaced(ctx context.Context, log logr.Logger, registryCredentials *registryv1alpha1.RegistryCredentials, current map[string]string) {
+	remaining := []registryv1alpha1.IssuedCredentials{}
+	for _, issued := range registryCredentials.Status.IssuedCredentials {
+		if !replaced(issued.Annotations, current) {
+			remaining = append(remaining, issued)
+			continue
+		}
+		if err := r.revokeIssued(ctx, log, registryCredentials, issued); err != nil {
+			remaining = append(remaining, issued)
+		}
+	}
+	registryCredentials.Status.IssuedCredentials = remaining
+}
+
+// revoke revokes all the issued credentials of the RegistryCredentials
+func (r *RegistryCredentialsReconciler) revoke(ctx context.Context, log logr.Logger, registryCredentials *registryv1alpha1.RegistryCredentials) error {
+	remaining := []registryv1alpha1.IssuedCredentials{}
+	var revokeErr error
+	for _, issued := range registryCredentials.Status.IssuedCredentials {
+		if err := r.revokeIssued(ctx, log, registryCredentials, issued); err != nil {
+			remaining = append(remaining, issued)
+			revokeErr = err
+		}
+	}
+	if revokeErr != nil {
+		// Keep only the credentials that weren't revoked for the next attempt
+		registryCredentials.Status.IssuedCredentials = remaining
+		if err := r.Status().Update(ctx, registryCredentials); err != nil {
+			log.Error(err, "Unable to set status")
+		}
+	}
+
+	return revokeErr
+}
+
+// revokeIssued revokes the credentials with the provider that issued them, even
+// if the RegistryCredentials has another provider now. Credentials that can't
+// ever be revoked, because the provider isn't available or its credentials
+// were deleted, are reported and released, so they don't block the deletion.
+func (r *RegistryCredentialsReconciler) revokeIssued(ctx context.Context, log logr.Logger, registryCredentials *registryv1alpha1.RegistryCredentials, issued registryv1alpha1.IssuedCredentials) error {
+	issuer := registryCredentials.DeepCopy()
+	issuer.Spec.Provider = *issued.Provider.DeepCopy()
+	authenticator, err := providers.NewAuthenticator(r.Client, issuer)
+	if err != nil {
+		r.releaseIssued(log, registryCredentials, err)
+		return nil
+	}
+	revoker, ok := authenticator.(providers.Revoker)
+	if !ok {
+		return nil
+	}
+
+	if err := revoker.Revoke(ctx, log, issuer, issued.Annotations); err != nil {
+		if providers.IsMissingCredentials(err) {
+			r.releaseIssued(log, registryCredentials, err)
+			return nil
+		}
+		log.Error(err, "Unable to revoke credentials")
+		r.Recorder.Eventf(registryCredentials, corev1.EventTypeWarning, "RevokeFailed", "Unable to revoke credentials: %v", err)
+		return err
+	}
+	r.Recorder.Event(registryCredentials, corev1.EventTypeNormal, "Revoked", "Revoked credentials")
+
+	return nil
+}
+
+// releaseIssued reports the issued credentials that can't be revoked
+func (r *RegistryCredentialsReconciler) releaseIssued(log logr.Logger, registryCredentials *registryv1alpha1.RegistryCredentials, err error) {
+	log.Error(err, "Unable to revoke credentials, releasing them")
+	r.Recorder.Eventf(registryCredentials, corev1.EventTypeWarning, "RevokeFailed", "Unable to revoke credentials, they must be revoked manually: %v", err)
+}
+
+func (r *RegistryCredentialsReconciler) getSecret(registryCredentials *v1alpha1.RegistryCredentials, result providers.Result) (corev1.Secret, error) {
+	mirrors := []string{}
+	for _, mirror := range registryCredentials.Spec.Mirrors {
+		mirrors = append(mirrors, mirror.Prefix)
+	}
+	result, err := result.WithMirrors(mirrors)
+	if err != nil {
+		return corev1.Secret{}, err
+	}
+	dockerConfig, err := result.DockerConfigJSON()
+	if err != nil {
+		return corev1.Secret{}, err
+	}
 
 	return corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      registryCredentials.ObjectMeta.Name,
-			Namespace: registryCredentials.ObjectMeta.Namespace,
+			Name:        registryCredentials.ObjectMeta.Name,
+			Namespace:   registryCredentials.ObjectMeta.Namespace,
+			Annotations: result.Annotations,
 			OwnerReferences: []metav1.OwnerReference{
 				*metav1.NewControllerRef(registryCredentials, v1alpha1.GroupVersion.WithKind("RegistryCredentials")),
 			},
 		},
 		Type: corev1.SecretTypeDockerConfigJson,
 		Data: map[string][]byte{
-			corev1.DockerConfigJsonKey: []byte(dockerConfig),
+			corev1.DockerConfigJsonKey: dockerConfig,
 		},
-	}
+	}, nil
 }
 
-func (r *RegistryCredentialsReconciler) createOrUpdateSecret(log logr.Logger, object *corev1.Secret) error {
-	ctx := context.Background()
+func (r *RegistryCredentialsReconciler) createOrUpdateSecret(ctx context.Context, log logr.Logger, object *corev1.Secret) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "createOrUpdateSecret", trace.WithAttributes(
+		attribute.String("secret", object.ObjectMeta.Name),
+	))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
 
-	err := r.Client.Get(ctx, client.ObjectKey{
+	err = r.Client.Get(ctx, client.ObjectKey{
 		Name:      object.ObjectMeta.Name,
 		Namespace: object.ObjectMeta.Namespace,
 	}, &corev1.Secret{})
@@ -218,23 +471,56 @@ func (r *RegistryCredentialsReconciler) createOrUpdateSecret(log logr.Logger, ob
 	if err != nil && errors.IsNotFound(err) {
 		if err := r.Client.Create(ctx, object); err != nil {
 			log.Error(err, "Unable to create object")
+			metrics.SecretWrites.WithLabelValues("create", "error").Inc()
 			return client.IgnoreNotFound(err)
 		}
+		metrics.SecretWrites.WithLabelValues("create", "success").Inc()
 		r.Recorder.Eventf(object, corev1.EventTypeNormal, "Created", "Created secret %q", object.ObjectMeta.Name)
 	} else {
 		if err := r.Client.Update(ctx, object); err != nil {
 			log.Error(err, "Unable to update object")
+			metrics.SecretWrites.WithLabelValues("update", "error").Inc()
 			return client.IgnoreNotFound(err)
 		}
+		metrics.SecretWrites.WithLabelValues("update", "success").Inc()
 		r.Recorder.Eventf(object, corev1.EventTypeNormal, "Updated", "Updated secret %q", object.ObjectMeta.Name)
 	}
 
 	return nil
 }
 
-func (r *RegistryCredentialsReconciler) setError(log logr.Logger, registryCredentials *registryv1alpha1.RegistryCredentials, err error) error {
-	ctx := context.Background()
+// setPullRateLimit reports the pull quota of the result in the status and the
+// metrics
+func setPullRateLimit(key types.NamespacedName, registryCredentials *registryv1alpha1.RegistryCredentials, rateLimit *providers.PullRateLimit) {
+	if rateLimit == nil {
+		registryCredentials.Status.PullRateLimit = nil
+		metrics.PullRateLimit.DeleteLabelValues(key.Namespace, key.Name)
+		metrics.PullRateLimitRemaining.DeleteLabelValues(key.Namespace, key.Name)
+		return
+	}
+
+	status := &registryv1alpha1.PullRateLimit{
+		Limit:        rateLimit.Limit,
+		Remaining:    rateLimit.Remaining,
+		ObservedTime: metav1.Now(),
+	}
+	if rateLimit.Window > 0 {
+		status.Window = &metav1.Duration{Duration: rateLimit.Window}
+	}
+	registryCredentials.Status.PullRateLimit = status
+	metrics.PullRateLimit.WithLabelValues(key.Namespace, key.Name).Set(float64(rateLimit.Limit))
+	metrics.PullRateLimitRemaining.WithLabelValues(key.Namespace, key.Name).Set(float64(rateLimit.Remaining))
+}
+
+// deleteMetrics stops reporting the metrics of a RegistryCredentials
+func deleteMetrics(key types.NamespacedName) {
+	metrics.TokenExpiry.Delete(key)
+	metrics.PullRateLimit.DeleteLabelValues(key.Namespace, key.Name)
+	metrics.PullRateLimitRemaining.DeleteLabelValues(key.Namespace, key.Name)
+	metrics.Pullable.DeleteLabelValues(key.Namespace, key.Name)
+}
 
+func (r *RegistryCredentialsReconciler) setError(ctx context.Context, log logr.Logger, registryCredentials *registryv1alpha1.RegistryCredentials, err error) error {
 	registryCredentials.Status.ErrorMessage = err.Error()
 	registryCredentials.Status.State = registryv1alpha1.RegistryCredentialsErrored
 
@@ -2,12 +2,22 @@ package controllers
 
 import (
 	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
 	registryv1alpha1 "github.com/astrokube/registry-controller/api/v1alpha1"
+	"github.com/astrokube/registry-controller/pkg/providers"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 )
@@ -50,6 +60,7 @@ var _ = Describe("RegistryCredentials controller", func() {
 				}, fetched)
 				return fetched.Status.State
 			}, timeout, interval).Should(Equal(registryv1alpha1.RegistryCredentialsUnauthorized))
+			Expect(fetched.Status.ErrorMessage).NotTo(BeEmpty())
 		})
 
 		It("Should set RegistryCredentials.Status to Error when region is not valid", func() {
@@ -150,4 +161,288 @@ var _ = Describe("RegistryCredentials controller", func() {
 
 	})
 
+	Context("When the provider issues credentials that must be revoked", func() {
+		var (
+			harbor *fakeHarbor
+			server *httptest.Server
+		)
+
+		BeforeEach(func() {
+			harbor = &fakeHarbor{}
+			server = httptest.NewTLSServer(harbor)
+			providers.AllowedURLs = []string{server.URL}
+		})
+
+		AfterEach(func() {
+			server.Close()
+			providers.AllowedURLs = nil
+		})
+
+		// createHarborCredentials creates the RegistryCredentials with the
+		// Secret of the Harbor admin, and waits for the first robot account
+		createHarborCredentials := func(name string) types.NamespacedName {
+			ctx := context.Background()
+			Expect(k8sClient.Create(ctx, &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: name + "-admin", Namespace: namespace},
+				Type:       corev1.SecretTypeBasicAuth,
+				StringData: map[string]string{
+					corev1.BasicAuthUsernameKey: "admin",
+					corev1.BasicAuthPasswordKey: "Harbor12345",
+				},
+			})).Should(Succeed())
+			Expect(k8sClient.Create(ctx, &registryv1alpha1.RegistryCredentials{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+				Spec: registryv1alpha1.RegistryCredentialsSpec{
+					Provider: registryv1alpha1.RegistryProvider{
+						Harbor: &registryv1alpha1.HarborProvider{
+							URL:                  server.URL,
+							Project:              "team",
+							CredentialsSecretRef: corev1.LocalObjectReference{Name: name + "-admin"},
+							CABundle:             certificatePEM(server.Certificate()),
+						},
+					},
+				},
+			})).Should(Succeed())
+
+			key := types.NamespacedName{Name: name, Namespace: namespace}
+			Eventually(func() []string { return issuedRobots(key) }, timeout, interval).Should(Equal([]string{"1"}))
+
+			return key
+		}
+
+		It("Should add the finalizer before issuing a robot account", func() {
+			key := createHarborCredentials("harbor-finalizer")
+
+			fetched := &registryv1alpha1.RegistryCredentials{}
+			Expect(k8sClient.Get(context.Background(), key, fetched)).Should(Succeed())
+			Expect(fetched.Finalizers).Should(ContainElement(RevokeFinalizer))
+			Expect(fetched.Status.IssuedCredentials[0].Provider.Harbor.Project).Should(Equal("team"))
+		})
+
+		It("Should revoke the robot account replaced by a rotation", func() {
+			key := createHarborCredentials("harbor-rotate")
+
+			fetched := &registryv1alpha1.RegistryCredentials{}
+			Expect(k8sClient.Get(context.Background(), key, fetched)).Should(Succeed())
+			fetched.Spec.Provider.Harbor.Project = "other"
+			Expect(k8sClient.Update(context.Background(), fetched)).Should(Succeed())
+
+			Eventually(func() []string { return issuedRobots(key) }, timeout, interval).Should(Equal([]string{"2"}))
+			Expect(harbor.Deleted()).Should(Equal([]string{"1"}))
+		})
+
+		It("Should revoke the robot account on deletion even without the pull Secret", func() {
+			key := createHarborCredentials("harbor-delete")
+
+			Expect(k8sClient.Delete(context.Background(), &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+			})).Should(Succeed())
+			Expect(k8sClient.Delete(context.Background(), &registryv1alpha1.RegistryCredentials{
+				ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+			})).Should(Succeed())
+
+			Eventually(deleted(key), timeout, interval).Should(BeTrue())
+			Expect(harbor.Deleted()).Should(Equal([]string{"1"}))
+		})
+
+		It("Should release the finalizer when the admin Secret is missing", func() {
+			key := createHarborCredentials("harbor-missing-admin")
+
+			Expect(k8sClient.Delete(context.Background(), &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: key.Name + "-admin", Namespace: key.Namespace},
+			})).Should(Succeed())
+			Expect(k8sClient.Delete(context.Background(), &registryv1alpha1.RegistryCredentials{
+				ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+			})).Should(Succeed())
+
+			Eventually(deleted(key), timeout, interval).Should(BeTrue())
+			Expect(harbor.Deleted()).Should(BeEmpty())
+		})
+	})
+
+	Context("When the provider uses GitLab deploy tokens", func() {
+		var (
+			gitlab *fakeGitLab
+			server *httptest.Server
+		)
+
+		BeforeEach(func() {
+			gitlab = &fakeGitLab{}
+			server = httptest.NewTLSServer(gitlab)
+			providers.AllowedURLs = []string{server.URL}
+		})
+
+		AfterEach(func() {
+			server.Close()
+			providers.AllowedURLs = nil
+		})
+
+		createSecret := func(name string, data map[string]string) {
+			Expect(k8sClient.Create(context.Background(), &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+				StringData: data,
+			})).Should(Succeed())
+		}
+
+		It("Should not add the finalizer for static deploy tokens", func() {
+			createSecret("gitlab-static-token", map[string]string{"username": "gitlab+deploy-token-9", "token": "static"})
+			key := types.NamespacedName{Name: "gitlab-static", Namespace: namespace}
+			Expect(k8sClient.Create(context.Background(), &registryv1alpha1.RegistryCredentials{
+				ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+				Spec: registryv1alpha1.RegistryCredentialsSpec{
+					Provider: registryv1alpha1.RegistryProvider{
+						GitLab: &registryv1alpha1.GitLabProvider{
+							DeployTokenSecretRef: &corev1.LocalObjectReference{Name: "gitlab-static-token"},
+						},
+					},
+				},
+			})).Should(Succeed())
+
+			fetched := &registryv1alpha1.RegistryCredentials{}
+			Eventually(func() registryv1alpha1.RegistryCredentialsState {
+				k8sClient.Get(context.Background(), key, fetched)
+				return fetched.Status.State
+			}, timeout, interval).Should(Equal(registryv1alpha1.RegistryCredentialsAuthenticated))
+			Expect(fetched.Finalizers).ShouldNot(ContainElement(RevokeFinalizer))
+			Expect(fetched.Status.IssuedCredentials).Should(BeEmpty())
+		})
+
+		It("Should release the finalizer when the access token Secret is missing", func() {
+			createSecret("gitlab-maintainer", map[string]string{"token": "glpat-maintainer"})
+			key := types.NamespacedName{Name: "gitlab-missing-access-token", Namespace: namespace}
+			Expect(k8sClient.Create(context.Background(), &registryv1alpha1.RegistryCredentials{
+				ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+				Spec: registryv1alpha1.RegistryCredentialsSpec{
+					Provider: registryv1alpha1.RegistryProvider{
+						GitLab: &registryv1alpha1.GitLabProvider{
+							APIURL:   server.URL + "/api/v4",
+							Project:  "group/project",
+							CABundle: certificatePEM(server.Certificate()),
+							AccessTokenSecretRef: &corev1.SecretKeySelector{
+								LocalObjectReference: corev1.LocalObjectReference{Name: "gitlab-maintainer"},
+								Key:                  "token",
+							},
+						},
+					},
+				},
+			})).Should(Succeed())
+
+			fetched := &registryv1alpha1.RegistryCredentials{}
+			Eventually(func() int {
+				k8sClient.Get(context.Background(), key, fetched)
+				return len(fetched.Status.IssuedCredentials)
+			}, timeout, interval).Should(Equal(1))
+			Expect(fetched.Finalizers).Should(ContainElement(RevokeFinalizer))
+
+			Expect(k8sClient.Delete(context.Background(), &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "gitlab-maintainer", Namespace: namespace},
+			})).Should(Succeed())
+			Expect(k8sClient.Delete(context.Background(), fetched)).Should(Succeed())
+
+			Eventually(deleted(key), timeout, interval).Should(BeTrue())
+			Expect(gitlab.Deleted()).Should(BeEmpty())
+		})
+	})
+
 })
+
+// issuedRobots returns the IDs of the robot accounts in the issued credentials
+// of the RegistryCredentials
+func issuedRobots(key types.NamespacedName) []string {
+	fetched := &registryv1alpha1.RegistryCredentials{}
+	if err := k8sClient.Get(context.Background(), key, fetched); err != nil {
+		return nil
+	}
+	ids := []string{}
+	for _, issued := range fetched.Status.IssuedCredentials {
+		ids = append(ids, issued.Annotations[providers.HarborRobotIDAnnotation])
+	}
+
+	return ids
+}
+
+// certificatePEM returns the PEM bundle of the certificate of a test server
+func certificatePEM(certificate *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw})
+}
+
+// deleted returns whether the RegistryCredentials doesn't exist anymore
+func deleted(key types.NamespacedName) func() bool {
+	return func() bool {
+		err := k8sClient.Get(context.Background(), key, &registryv1alpha1.RegistryCredentials{})
+		return apierrors.IsNotFound(err)
+	}
+}
+
+// fakeHarbor implements the robot accounts of the Harbor v2 API
+type fakeHarbor struct {
+	mu      sync.Mutex
+	created int
+	deleted []string
+}
+
+func (h *fakeHarbor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if username, password, ok := r.BasicAuth(); !ok || username != "admin" || password != "Harbor12345" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v2.0/robots":
+		h.created++
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"id":%d,"name":"robot$%d","secret":"secret"}`, h.created, h.created)
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/api/v2.0/robots/"):
+		h.deleted = append(h.deleted, strings.TrimPrefix(r.URL.Path, "/api/v2.0/robots/"))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// Deleted returns the IDs of the deleted robot accounts
+func (h *fakeHarbor) Deleted() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return append([]string{}, h.deleted...)
+}
+
+// fakeGitLab implements the deploy tokens of the GitLab API
+type fakeGitLab struct {
+	mu      sync.Mutex
+	created int
+	deleted []string
+}
+
+func (g *fakeGitLab) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if r.Header.Get("PRIVATE-TOKEN") != "glpat-maintainer" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/deploy_tokens"):
+		g.created++
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"id":%d,"username":"gitlab+deploy-token-%d","token":"token"}`, g.created, g.created)
+	case r.Method == http.MethodDelete && strings.Contains(r.URL.Path, "/deploy_tokens/"):
+		g.deleted = append(g.deleted, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// Deleted returns the paths of the deleted deploy tokens
+func (g *fakeGitLab) Deleted() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return append([]string{}, g.deleted...)
+}
@@ -17,8 +17,10 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"os"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -26,14 +28,17 @@ import (
 
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
-	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	registryv1alpha1 "github.com/astrokube/registry-controller/api/v1alpha1"
 	"github.com/astrokube/registry-controller/controllers"
+	"github.com/astrokube/registry-controller/pkg/health"
+	"github.com/astrokube/registry-controller/pkg/providers"
+	"github.com/astrokube/registry-controller/pkg/tracing"
 	"github.com/astrokube/registry-controller/webhooks"
 	//+kubebuilder:scaffold:imports
 )
@@ -54,11 +59,65 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var podReadinessTimeout time.Duration
+	var providerTimeout time.Duration
+	var execPluginDir string
+	var vaultAddresses string
+	var allowedURLs string
+	var vaultTokenAudience string
+	var podInjectionMode string
+	var erroredThreshold float64
+	var otlpEndpoint string
+	var otlpInsecure bool
+	var traceSampleRatio float64
+	var digestCacheTTL time.Duration
+	var imageVerificationCacheTTL time.Duration
+	var signatureCacheTTL time.Duration
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.DurationVar(&podReadinessTimeout, "pod-readiness-timeout", webhooks.DefaultReadinessTimeout,
+		"Maximum time the Pod webhook waits for the matching RegistryCredentials to be authenticated. "+
+			"It is always bounded by the timeout of the admission request.")
+	flag.DurationVar(&providerTimeout, "provider-timeout", controllers.DefaultProviderTimeout,
+		"The maximum duration of the calls to the registry providers.")
+	flag.StringVar(&execPluginDir, "exec-plugin-dir", providers.DefaultExecPluginDir,
+		"The directory with the credential provider plugins that can be run by the exec provider.")
+	flag.Var(providers.ExecPluginEnvFlag(), "exec-plugin-env",
+		"A variable of the environment of a plugin of the exec provider, like plugin:NAME=value. "+
+			"The plugins don't inherit the environment of the operator. It can be repeated.")
+	flag.Var(providers.ExecPluginAllowedEnvFlag(), "exec-plugin-allowed-env",
+		"The variables of the environment of a plugin of the exec provider that RegistryCredentials can set, like plugin:NAME1,NAME2. "+
+			"Loader and proxy variables, like LD_PRELOAD, PATH or HTTPS_PROXY, can't be allowed. It can be repeated.")
+	flag.Var(providers.ExecPluginAllowedArgsFlag(), "exec-plugin-allowed-args",
+		"The arguments that RegistryCredentials can pass to a plugin of the exec provider, like plugin:--arg1,--arg2=. "+
+			"Arguments ending with = allow any value. The plugins are run without arguments otherwise. It can be repeated.")
+	flag.StringVar(&allowedURLs, "allowed-urls", "",
+		"The comma separated HTTPS URLs that RegistryCredentials can set as the endpoints of the providers, including the endpoints under them. "+
+			"The default endpoints of the providers are always allowed, and the webhook and harbor providers are disabled when empty.")
+	flag.StringVar(&vaultAddresses, "vault-addresses", "",
+		"The comma separated HTTPS addresses of the Vault servers that RegistryCredentials can login to. "+
+			"The vault provider is disabled when empty.")
+	flag.StringVar(&vaultTokenAudience, "vault-token-audience", "",
+		"The audience of the service account tokens used to login to Vault. The audience of the API server is used when empty.")
+	flag.StringVar(&podInjectionMode, "pod-injection-mode", string(webhooks.InjectionModeEnforce),
+		"The injection mode of the Pod webhook: enforce injects the secrets, audit only records them as Pod annotations, Events and metrics. "+
+			"It can be overridden per Namespace with the "+webhooks.InjectionModeKey+" annotation.")
+	flag.Float64Var(&erroredThreshold, "errored-threshold", 0,
+		"Share of RegistryCredentials in Errored state, between 0 and 1, that makes the /degraded check of the metrics server report the operator as degraded. "+
+			"The check is disabled when set to 0.")
+	flag.StringVar(&otlpEndpoint, "otlp-endpoint", "",
+		"The host and port of the OTLP HTTP endpoint where the traces are exported. Tracing is disabled when empty.")
+	flag.BoolVar(&otlpInsecure, "otlp-insecure", false, "Disable TLS to export the traces to the OTLP endpoint.")
+	flag.Float64Var(&traceSampleRatio, "trace-sample-ratio", 1, "The ratio of traces sampled, between 0 and 1.")
+	flag.DurationVar(&digestCacheTTL, "digest-cache-ttl", webhooks.DefaultDigestCacheTTL,
+		"The time the digests resolved from the image tags by the Pod webhook are cached.")
+	flag.DurationVar(&imageVerificationCacheTTL, "image-verification-cache-ttl", webhooks.DefaultImageVerificationCacheTTL,
+		"The time the results of the verification of the images of the Pods are cached.")
+	flag.DurationVar(&signatureCacheTTL, "signature-cache-ttl", webhooks.DefaultSignatureCacheTTL,
+		"The time the results of the verification of the image signatures by the Pod webhook are cached.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -66,6 +125,35 @@ func main() {
 	flag.Parse()
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+	providers.ExecPluginDir = execPluginDir
+	addresses, err := providers.ParseVaultAddresses(vaultAddresses)
+	if err != nil {
+		setupLog.Error(err, "invalid Vault addresses")
+		os.Exit(1)
+	}
+	providers.VaultAddresses = addresses
+	urls, err := providers.ParseAllowedURLs(allowedURLs)
+	if err != nil {
+		setupLog.Error(err, "invalid allowed URLs")
+		os.Exit(1)
+	}
+	providers.AllowedURLs = urls
+	if vaultTokenAudience != "" {
+		providers.VaultTokenAudiences = []string{vaultTokenAudience}
+	}
+
+	if otlpEndpoint != "" {
+		tracerProvider, err := tracing.SetupOTLP(context.Background(), otlpEndpoint, otlpInsecure, traceSampleRatio)
+		if err != nil {
+			setupLog.Error(err, "unable to set up tracing")
+			os.Exit(1)
+		}
+		defer func() {
+			if err := tracerProvider.Shutdown(context.Background()); err != nil {
+				setupLog.Error(err, "unable to flush traces")
+			}
+		}()
+	}
 
 	// syncPeriod, _ := time.ParseDuration("100s")
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
@@ -81,16 +169,61 @@ func main() {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
+	clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		setupLog.Error(err, "unable to create clientset")
+		os.Exit(1)
+	}
+	providers.ServiceAccountTokens = providers.NewTokenRequester(clientset.CoreV1())
 
 	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
 		setupLog.Info("set up webhook")
+		mode, err := webhooks.ParseInjectionMode(podInjectionMode)
+		if err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Pod")
+			os.Exit(1)
+		}
 		mutatePodWebhook := &webhooks.MutatePodWebhook{
-			Client:   mgr.GetClient(),
-			Log:      ctrl.Log.WithName("controllers").WithName("Pod"),
-			Recorder: mgr.GetEventRecorderFor("registry-credentials-controller"),
+			Client:            mgr.GetClient(),
+			APIReader:         mgr.GetAPIReader(),
+			Log:               ctrl.Log.WithName("controllers").WithName("Pod"),
+			Recorder:          mgr.GetEventRecorderFor("registry-credentials-controller"),
+			Mode:              mode,
+			ReadinessTimeout:  podReadinessTimeout,
+			DigestCacheTTL:    digestCacheTTL,
+			SignatureCacheTTL: signatureCacheTTL,
+		}
+		if err = mutatePodWebhook.SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Pod")
+			os.Exit(1)
+		}
+
+		if err = (&webhooks.MutateWorkloadWebhook{
+			Log:        ctrl.Log.WithName("controllers").WithName("Workload"),
+			PodWebhook: mutatePodWebhook,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Workload")
+			os.Exit(1)
 		}
-		mgr.GetWebhookServer().Register("/mutate-pod", &webhook.Admission{Handler: mutatePodWebhook})
 
+		if err = (&webhooks.ValidateImagesWebhook{
+			Log:        ctrl.Log.WithName("controllers").WithName("ImageVerification"),
+			PodWebhook: mutatePodWebhook,
+			CacheTTL:   imageVerificationCacheTTL,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ImageVerification")
+			os.Exit(1)
+		}
+
+		if err = (&webhooks.ValidateSignaturesWebhook{
+			Log:        ctrl.Log.WithName("controllers").WithName("SignatureVerification"),
+			PodWebhook: mutatePodWebhook,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "SignatureVerification")
+			os.Exit(1)
+		}
+
+		registryv1alpha1.ProviderValidator = providers.Validate
 		if err = (&registryv1alpha1.RegistryCredentials{}).SetupWebhookWithManager(mgr); err != nil {
 			setupLog.Error(err, "unable to create webhook", "webhook", "RegistryCredentials")
 			os.Exit(1)
@@ -98,11 +231,19 @@ func main() {
 	}
 
 	if err = (&controllers.RegistryCredentialsReconciler{
+		Client:          mgr.GetClient(),
+		Recorder:        mgr.GetEventRecorderFor("registry-credentials-controller"),
+		Scheme:          mgr.GetScheme(),
+		ProviderTimeout: providerTimeout,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "RegistryCredentials")
+		os.Exit(1)
+	}
+	if err = (&controllers.HealthCheckReconciler{
 		Client:   mgr.GetClient(),
 		Recorder: mgr.GetEventRecorderFor("registry-credentials-controller"),
-		Scheme:   mgr.GetScheme(),
 	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "RegistryCredentials")
+		setupLog.Error(err, "unable to create controller", "controller", "HealthCheck")
 		os.Exit(1)
 	}
 	//+kubebuilder:scaffold:builder
@@ -115,6 +256,25 @@ func main() {
 		setupLog.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
+	if err := mgr.AddReadyzCheck("cache-sync", health.CacheSynced(mgr.GetCache())); err != nil {
+		setupLog.Error(err, "unable to set up ready check")
+		os.Exit(1)
+	}
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err := mgr.AddReadyzCheck("webhook", health.WebhookServing(mgr.GetWebhookServer())); err != nil {
+			setupLog.Error(err, "unable to set up ready check")
+			os.Exit(1)
+		}
+	}
+	// The degraded check is kept out of the readiness check, so errors of the
+	// RegistryCredentials don't remove the webhook from the Service endpoints
+	if erroredThreshold > 0 {
+		checker := healthz.CheckHandler{Checker: health.ErroredRegistryCredentials(mgr.GetClient(), erroredThreshold)}
+		if err := mgr.AddMetricsExtraHandler("/degraded", checker); err != nil {
+			setupLog.Error(err, "unable to set up degraded check")
+			os.Exit(1)
+		}
+	}
 
 	setupLog.Info("starting manager")
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
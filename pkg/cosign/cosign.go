@@ -0,0 +1,176 @@
+// Package cosign verifies the signatures of the images signed with cosign
+// public keys, stored in the registry next to the images.
+package cosign
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/astrokube/registry-controller/pkg/registry"
+)
+
+const (
+	// SimpleSigningMediaType is the media type of the layers of the signature
+	// manifests, whose content is the signed payload
+	SimpleSigningMediaType = "application/vnd.dev.cosign.simplesigning.v1+json"
+
+	// SignatureAnnotation is the annotation of the layers of the signature
+	// manifests with the base64 encoded signature of the payload
+	SignatureAnnotation = "dev.cosignproject.cosign/signature"
+
+	// SignatureType is the type of the payloads of the image signatures
+	SignatureType = "cosign container image signature"
+
+	// maxPayloadSize bounds the size of the payloads read from the registries
+	maxPayloadSize = 1 << 20
+)
+
+var (
+	// ErrNoSignature is returned when the image isn't signed
+	ErrNoSignature = errors.New("no signature found")
+
+	// ErrInvalidSignature is returned when none of the signatures of the image
+	// can be verified with the public keys
+	ErrInvalidSignature = errors.New("invalid signature")
+)
+
+// Payload is the simple signing payload signed by cosign
+type Payload struct {
+	Critical Critical          `json:"critical"`
+	Optional map[string]string `json:"optional"`
+}
+
+// Critical identifies the signed image
+type Critical struct {
+	Identity Identity `json:"identity"`
+	Image    Image    `json:"image"`
+	Type     string   `json:"type"`
+}
+
+// Identity is the repository of the signed image
+type Identity struct {
+	DockerReference string `json:"docker-reference"`
+}
+
+// Image is the digest of the signed image
+type Image struct {
+	DockerManifestDigest string `json:"docker-manifest-digest"`
+}
+
+// manifest is the part of the signature manifests used to verify them
+type manifest struct {
+	Layers []layer `json:"layers"`
+}
+
+type layer struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// SignatureTag returns the tag of the signatures of the image with the
+// digest, like sha256-<hex>.sig
+func SignatureTag(digest string) string {
+	return strings.Replace(digest, ":", "-", 1) + ".sig"
+}
+
+// ParsePublicKeys parses the PEM encoded ECDSA public keys
+func ParsePublicKeys(keys []string) ([]*ecdsa.PublicKey, error) {
+	publicKeys := []*ecdsa.PublicKey{}
+	for i, key := range keys {
+		block, _ := pem.Decode([]byte(key))
+		if block == nil {
+			return nil, fmt.Errorf("public key %d isn't PEM encoded", i)
+		}
+		publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parsing public key %d: %w", i, err)
+		}
+		ecdsaKey, ok := publicKey.(*ecdsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("public key %d isn't an ECDSA key", i)
+		}
+		publicKeys = append(publicKeys, ecdsaKey)
+	}
+
+	return publicKeys, nil
+}
+
+// Verify checks that the image with the digest has a signature of one of the
+// public keys. It returns ErrNoSignature or ErrInvalidSignature when the
+// signatures are missing or invalid, and other errors when the signatures
+// can't be read from the registry.
+func Verify(ctx context.Context, client *registry.Client, ref registry.Reference, digest string, auth string, keys []*ecdsa.PublicKey) error {
+	signatures := registry.Reference{
+		Registry:   ref.Registry,
+		Repository: ref.Repository,
+		Tag:        SignatureTag(digest),
+	}
+	_, content, err := client.GetManifest(ctx, signatures, auth)
+	if registry.IsNotFound(err) {
+		return fmt.Errorf("%w for the image %s@%s", ErrNoSignature, ref.Name(), digest)
+	}
+	if err != nil {
+		return err
+	}
+	signatureManifest := manifest{}
+	if err := json.Unmarshal(content, &signatureManifest); err != nil {
+		return fmt.Errorf("%w: unable to decode the manifest %s: %v", ErrInvalidSignature, signatures, err)
+	}
+
+	found := false
+	for _, layer := range signatureManifest.Layers {
+		if layer.MediaType != SimpleSigningMediaType {
+			continue
+		}
+		signature, err := base64.StdEncoding.DecodeString(layer.Annotations[SignatureAnnotation])
+		if err != nil || len(signature) == 0 {
+			continue
+		}
+		found = true
+
+		payload, err := client.GetBlob(ctx, signatures, layer.Digest, maxPayloadSize, auth)
+		if err != nil {
+			return err
+		}
+		if verifyPayload(payload, signature, digest, keys) {
+			return nil
+		}
+	}
+	if !found {
+		return fmt.Errorf("%w for the image %s@%s", ErrNoSignature, ref.Name(), digest)
+	}
+
+	return fmt.Errorf("%w: no signature of the image %s@%s matches the public keys", ErrInvalidSignature, ref.Name(), digest)
+}
+
+// verifyPayload checks that the payload is signed by one of the keys and
+// identifies the image with the digest
+func verifyPayload(payload, signature []byte, digest string, keys []*ecdsa.PublicKey) bool {
+	hash := sha256.Sum256(payload)
+	verified := false
+	for _, key := range keys {
+		if ecdsa.VerifyASN1(key, hash[:], signature) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return false
+	}
+
+	signed := Payload{}
+	if err := json.Unmarshal(payload, &signed); err != nil {
+		return false
+	}
+
+	return signed.Critical.Type == SignatureType && signed.Critical.Image.DockerManifestDigest == digest
+}
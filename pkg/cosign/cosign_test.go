@@ -0,0 +1,105 @@
+package cosign_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/astrokube/registry-controller/pkg/cosign"
+	"github.com/astrokube/registry-controller/pkg/cosign/cosigntest"
+	"github.com/astrokube/registry-controller/pkg/registry"
+	"github.com/astrokube/registry-controller/pkg/registry/registrytest"
+)
+
+var _ = Describe("Verify", func() {
+	var (
+		server *registrytest.Server
+		client *registry.Client
+		ref    registry.Reference
+		digest string
+	)
+
+	BeforeEach(func() {
+		server = registrytest.NewServer("user", "password")
+		client = registry.NewClient(server.Client())
+		digest = server.PushImage("team/app", "1.0")
+
+		var err error
+		ref, err = registry.ParseReference(server.Host() + "/team/app@" + digest)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	publicKeys := func(keys ...string) []*ecdsa.PublicKey {
+		parsed, err := cosign.ParsePublicKeys(keys)
+		Expect(err).NotTo(HaveOccurred())
+		return parsed
+	}
+
+	Context("When the image is signed with one of the keys", func() {
+		It("Should verify the signature", func() {
+			_, other := cosigntest.GenerateKey()
+			key, publicKey := cosigntest.GenerateKey()
+			cosigntest.Sign(server, "team/app", digest, key)
+
+			Expect(cosign.Verify(context.Background(), client, ref, digest, server.Auth(), publicKeys(other, publicKey))).To(Succeed())
+			Expect(server.Requests("team/app", cosign.SignatureTag(digest))).To(Equal(1))
+		})
+	})
+
+	Context("When the image isn't signed", func() {
+		It("Should return ErrNoSignature", func() {
+			_, publicKey := cosigntest.GenerateKey()
+
+			err := cosign.Verify(context.Background(), client, ref, digest, server.Auth(), publicKeys(publicKey))
+			Expect(errors.Is(err, cosign.ErrNoSignature)).To(BeTrue())
+		})
+	})
+
+	Context("When the image is signed with another key", func() {
+		It("Should return ErrInvalidSignature", func() {
+			key, _ := cosigntest.GenerateKey()
+			_, publicKey := cosigntest.GenerateKey()
+			cosigntest.Sign(server, "team/app", digest, key)
+
+			err := cosign.Verify(context.Background(), client, ref, digest, server.Auth(), publicKeys(publicKey))
+			Expect(errors.Is(err, cosign.ErrInvalidSignature)).To(BeTrue())
+		})
+	})
+
+	Context("When the signed payload is for another image", func() {
+		It("Should return ErrInvalidSignature", func() {
+			key, publicKey := cosigntest.GenerateKey()
+			other := registry.Digest([]byte("another image"))
+			cosigntest.SignPayload(server, "team/app", digest, cosigntest.Payload(server, "team/app", other), key)
+
+			err := cosign.Verify(context.Background(), client, ref, digest, server.Auth(), publicKeys(publicKey))
+			Expect(errors.Is(err, cosign.ErrInvalidSignature)).To(BeTrue())
+		})
+	})
+
+	Context("When the registry can't be reached", func() {
+		It("Should return the error of the registry", func() {
+			_, publicKey := cosigntest.GenerateKey()
+			server.Close()
+
+			err := cosign.Verify(context.Background(), client, ref, digest, server.Auth(), publicKeys(publicKey))
+			Expect(err).To(HaveOccurred())
+			Expect(errors.Is(err, cosign.ErrNoSignature)).To(BeFalse())
+			Expect(errors.Is(err, cosign.ErrInvalidSignature)).To(BeFalse())
+		})
+	})
+})
+
+var _ = Describe("ParsePublicKeys", func() {
+	It("Should reject keys that aren't PEM encoded", func() {
+		_, err := cosign.ParsePublicKeys([]string{"not a key"})
+		Expect(err).To(MatchError(ContainSubstring("isn't PEM encoded")))
+	})
+})
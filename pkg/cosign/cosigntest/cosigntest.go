@@ -0,0 +1,90 @@
+// Package cosigntest signs the images of a registrytest.Server like cosign, for
+// testing.
+package cosigntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+
+	"github.com/astrokube/registry-controller/pkg/cosign"
+	"github.com/astrokube/registry-controller/pkg/registry"
+	"github.com/astrokube/registry-controller/pkg/registry/registrytest"
+)
+
+// GenerateKey returns a new ECDSA P-256 key and its PEM encoded public key,
+// like the ones generated by cosign generate-key-pair
+func GenerateKey() (*ecdsa.PrivateKey, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		panic(err)
+	}
+
+	return key, string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+// Payload returns the simple signing payload of the image of the repository
+// with the digest
+func Payload(server *registrytest.Server, repository, digest string) []byte {
+	payload, err := json.Marshal(cosign.Payload{
+		Critical: cosign.Critical{
+			Identity: cosign.Identity{DockerReference: server.Host() + "/" + repository},
+			Image:    cosign.Image{DockerManifestDigest: digest},
+			Type:     cosign.SignatureType,
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	return payload
+}
+
+// Sign signs the image of the repository with the digest with the key, and
+// pushes the signature to its sha256-<hex>.sig tag
+func Sign(server *registrytest.Server, repository, digest string, key *ecdsa.PrivateKey) {
+	SignPayload(server, repository, digest, Payload(server, repository, digest), key)
+}
+
+// SignPayload signs the payload with the key, and pushes the signature to the
+// tag of the signatures of the image of the repository with the digest
+func SignPayload(server *registrytest.Server, repository, digest string, payload []byte, key *ecdsa.PrivateKey) {
+	hash := sha256.Sum256(payload)
+	signature, err := ecdsa.SignASN1(rand.Reader, key, hash[:])
+	if err != nil {
+		panic(err)
+	}
+
+	config := []byte("{}")
+	content, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     "application/vnd.oci.image.manifest.v1+json",
+		"config": registry.Descriptor{
+			MediaType: "application/vnd.oci.image.config.v1+json",
+			Digest:    server.PushBlob(repository, config),
+			Size:      int64(len(config)),
+		},
+		"layers": []map[string]interface{}{{
+			"mediaType": cosign.SimpleSigningMediaType,
+			"digest":    server.PushBlob(repository, payload),
+			"size":      len(payload),
+			"annotations": map[string]string{
+				cosign.SignatureAnnotation: base64.StdEncoding.EncodeToString(signature),
+			},
+		}},
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	server.PushManifest(repository, cosign.SignatureTag(digest), "application/vnd.oci.image.manifest.v1+json", content)
+}
@@ -0,0 +1,107 @@
+package health
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+
+	registryv1alpha1 "github.com/astrokube/registry-controller/api/v1alpha1"
+)
+
+const checkTimeout = time.Second
+
+var (
+	ErrCacheNotSynced = errors.New("informer caches not synced")
+)
+
+// CacheSynced returns a checker that fails until the informer caches of the
+// manager have synced.
+func CacheSynced(informers cache.Cache) healthz.Checker {
+	return func(req *http.Request) error {
+		ctx, cancel := context.WithTimeout(req.Context(), checkTimeout)
+		defer cancel()
+
+		if !informers.WaitForCacheSync(ctx) {
+			return ErrCacheNotSynced
+		}
+
+		return nil
+	}
+}
+
+// WebhookServing returns a checker that fails until the webhook server accepts
+// TLS connections with a valid certificate.
+func WebhookServing(server *webhook.Server) healthz.Checker {
+	return func(req *http.Request) error {
+		host := server.Host
+		if host == "" {
+			host = "localhost"
+		}
+		port := server.Port
+		if port == 0 {
+			port = webhook.DefaultPort
+		}
+
+		dialer := &net.Dialer{Timeout: checkTimeout}
+		conn, err := tls.DialWithDialer(dialer, "tcp", net.JoinHostPort(host, strconv.Itoa(port)), &tls.Config{
+			// The certificate is issued for the webhook Service, so only its
+			// validity period is verified
+			InsecureSkipVerify: true,
+		})
+		if err != nil {
+			return fmt.Errorf("webhook server not serving: %w", err)
+		}
+		defer conn.Close()
+
+		certificates := conn.ConnectionState().PeerCertificates
+		if len(certificates) == 0 {
+			return errors.New("webhook server didn't present a certificate")
+		}
+		now := time.Now()
+		if now.Before(certificates[0].NotBefore) || now.After(certificates[0].NotAfter) {
+			return fmt.Errorf("webhook server certificate not valid between %v and %v", certificates[0].NotBefore, certificates[0].NotAfter)
+		}
+
+		return nil
+	}
+}
+
+// ErroredRegistryCredentials returns a checker that reports the operator as
+// degraded when the share of RegistryCredentials in Errored state reaches the
+// threshold, a value between 0 and 1.
+func ErroredRegistryCredentials(reader client.Reader, threshold float64) healthz.Checker {
+	return func(req *http.Request) error {
+		ctx, cancel := context.WithTimeout(req.Context(), checkTimeout)
+		defer cancel()
+
+		list := &registryv1alpha1.RegistryCredentialsList{}
+		if err := reader.List(ctx, list); err != nil {
+			return err
+		}
+		if len(list.Items) == 0 {
+			return nil
+		}
+
+		errored := 0
+		for _, registryCredentials := range list.Items {
+			if registryCredentials.Status.State == registryv1alpha1.RegistryCredentialsErrored {
+				errored++
+			}
+		}
+		if share := float64(errored) / float64(len(list.Items)); share >= threshold {
+			return fmt.Errorf("degraded: %d of %d RegistryCredentials are Errored", errored, len(list.Items))
+		}
+
+		return nil
+	}
+}
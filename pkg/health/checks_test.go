@@ -0,0 +1,83 @@
+package health
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+
+	registryv1alpha1 "github.com/astrokube/registry-controller/api/v1alpha1"
+)
+
+func newRegistryCredentials(name string, state registryv1alpha1.RegistryCredentialsState) client.Object {
+	return &registryv1alpha1.RegistryCredentials{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Status:     registryv1alpha1.RegistryCredentialsStatus{State: state},
+	}
+}
+
+var _ = Describe("Health checks", func() {
+
+	Context("When checking the webhook server", func() {
+		It("Should succeed when the server serves a valid certificate", func() {
+			server := httptest.NewTLSServer(http.NotFoundHandler())
+			defer server.Close()
+
+			host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+			Expect(err).NotTo(HaveOccurred())
+			portNumber, err := strconv.Atoi(port)
+			Expect(err).NotTo(HaveOccurred())
+
+			check := WebhookServing(&webhook.Server{Host: host, Port: portNumber})
+			Expect(check(httptest.NewRequest(http.MethodGet, "/readyz", nil))).To(Succeed())
+		})
+
+		It("Should fail when the server is not serving", func() {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			port := listener.Addr().(*net.TCPAddr).Port
+			Expect(listener.Close()).To(Succeed())
+
+			check := WebhookServing(&webhook.Server{Host: "127.0.0.1", Port: port})
+			Expect(check(httptest.NewRequest(http.MethodGet, "/readyz", nil))).NotTo(Succeed())
+		})
+	})
+
+	Context("When checking the RegistryCredentials", func() {
+		var scheme *runtime.Scheme
+
+		BeforeEach(func() {
+			scheme = runtime.NewScheme()
+			Expect(registryv1alpha1.AddToScheme(scheme)).To(Succeed())
+		})
+
+		It("Should report degraded when the share of Errored reaches the threshold", func() {
+			reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+				newRegistryCredentials("a", registryv1alpha1.RegistryCredentialsErrored),
+				newRegistryCredentials("b", registryv1alpha1.RegistryCredentialsAuthenticated),
+			).Build()
+
+			check := ErroredRegistryCredentials(reader, 0.5)
+			Expect(check(httptest.NewRequest(http.MethodGet, "/readyz", nil))).To(MatchError(ContainSubstring("degraded")))
+		})
+
+		It("Should succeed when the share of Errored is below the threshold", func() {
+			reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+				newRegistryCredentials("a", registryv1alpha1.RegistryCredentialsErrored),
+				newRegistryCredentials("b", registryv1alpha1.RegistryCredentialsAuthenticated),
+				newRegistryCredentials("c", registryv1alpha1.RegistryCredentialsAuthenticated),
+			).Build()
+
+			check := ErroredRegistryCredentials(reader, 0.5)
+			Expect(check(httptest.NewRequest(http.MethodGet, "/readyz", nil))).To(Succeed())
+		})
+	})
+})
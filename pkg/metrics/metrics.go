@@ -0,0 +1,195 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const namespace = "registry_operator"
+
+var (
+	// Authentications counts the calls to the providers to get a token by
+	// provider and resulting state
+	Authentications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "authentications_total",
+		Help:      "Number of authentications against the providers by provider and resulting state.",
+	}, []string{"provider", "state"})
+
+	// AuthenticationDuration measures the calls to the providers to get a
+	// token
+	AuthenticationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "authentication_duration_seconds",
+		Help:      "Duration of the authentications against the providers by provider.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"provider"})
+
+	// SecretWrites counts the writes of the secrets generated from the
+	// RegistryCredentials
+	SecretWrites = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "secret_writes_total",
+		Help:      "Number of writes of the secrets generated from the RegistryCredentials by operation and result.",
+	}, []string{"operation", "result"})
+
+	// TokenExpiry reports the seconds until the token of every
+	// RegistryCredentials expires
+	TokenExpiry = newExpiryCollector(prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "token_expiry_seconds"),
+		"Seconds until the token of the RegistryCredentials expires.",
+		[]string{"namespace", "name"}, nil,
+	))
+
+	// PullRateLimit reports the pull quota of the RegistryCredentials whose
+	// registry reports it
+	PullRateLimit = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pull_rate_limit",
+		Help:      "Number of pulls allowed in the rate limit window of the RegistryCredentials.",
+	}, []string{"namespace", "name"})
+
+	// PullRateLimitRemaining reports the pulls remaining in the rate limit
+	// window of the RegistryCredentials whose registry reports it
+	PullRateLimitRemaining = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pull_rate_limit_remaining",
+		Help:      "Number of pulls remaining in the rate limit window of the RegistryCredentials.",
+	}, []string{"namespace", "name"})
+
+	// Pullable reports whether the credentials of the RegistryCredentials
+	// with a health check can pull its image
+	Pullable = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pullable",
+		Help:      "Whether the credentials of the RegistryCredentials can pull the image of its health check (1) or not (0).",
+	}, []string{"namespace", "name"})
+
+	// Injections counts the secrets injected in Pods and workloads
+	Injections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "webhook",
+		Name:      "injections_total",
+		Help:      "Number of secrets injected in Pods and workloads by kind.",
+	}, []string{"kind"})
+
+	// SkippedInjections counts the admission requests skipped by the webhooks
+	SkippedInjections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "webhook",
+		Name:      "skipped_injections_total",
+		Help:      "Number of admission requests where the injection was skipped by kind and reason.",
+	}, []string{"kind", "reason"})
+
+	// ReadinessWait measures the time waited for RegistryCredentials to
+	// finish their authentication process before injecting them in Pods
+	ReadinessWait = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "webhook",
+		Name:      "readiness_wait_seconds",
+		Help:      "Time waited for the RegistryCredentials to be authenticated by result.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	}, []string{"result"})
+
+	// AuditedInjections counts the secrets that would have been injected in
+	// Pods in audit mode
+	AuditedInjections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "webhook",
+		Name:      "audited_injections_total",
+		Help:      "Number of secrets that would have been injected in Pods in audit mode.",
+	}, []string{"namespace", "registry_credentials"})
+
+	// DigestResolutions counts the resolutions of the image tags to digests
+	// when pinning the images of Pods
+	DigestResolutions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "webhook",
+		Name:      "digest_resolutions_total",
+		Help:      "Number of image tags resolved to digests by result.",
+	}, []string{"result"})
+
+	// ImageVerifications counts the requests to the registries to verify
+	// that the images of the Pods can be pulled
+	ImageVerifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "webhook",
+		Name:      "image_verifications_total",
+		Help:      "Number of images verified by result.",
+	}, []string{"result"})
+
+	// SignatureVerifications counts the verifications of the cosign
+	// signatures of the images of the Pods
+	SignatureVerifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "webhook",
+		Name:      "signature_verifications_total",
+		Help:      "Number of image signatures verified by result.",
+	}, []string{"result"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		Authentications,
+		AuthenticationDuration,
+		SecretWrites,
+		TokenExpiry,
+		PullRateLimit,
+		PullRateLimitRemaining,
+		Pullable,
+		Injections,
+		SkippedInjections,
+		ReadinessWait,
+		AuditedInjections,
+		DigestResolutions,
+		ImageVerifications,
+		SignatureVerifications,
+	)
+}
+
+// ExpiryCollector reports the seconds until a set of expiration times, which
+// are computed when the metrics are scraped.
+type ExpiryCollector struct {
+	desc       *prometheus.Desc
+	mu         sync.Mutex
+	expiration map[types.NamespacedName]time.Time
+}
+
+func newExpiryCollector(desc *prometheus.Desc) *ExpiryCollector {
+	return &ExpiryCollector{
+		desc:       desc,
+		expiration: map[types.NamespacedName]time.Time{},
+	}
+}
+
+// Set sets the expiration time of the given object.
+func (c *ExpiryCollector) Set(key types.NamespacedName, expiresAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expiration[key] = expiresAt
+}
+
+// Delete stops reporting the expiration time of the given object.
+func (c *ExpiryCollector) Delete(key types.NamespacedName) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.expiration, key)
+}
+
+// Describe implements prometheus.Collector
+func (c *ExpiryCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect implements prometheus.Collector
+func (c *ExpiryCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, expiresAt := range c.expiration {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, time.Until(expiresAt).Seconds(), key.Namespace, key.Name)
+	}
+}
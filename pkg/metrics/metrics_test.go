@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("ExpiryCollector", func() {
+	var collector *ExpiryCollector
+
+	BeforeEach(func() {
+		collector = newExpiryCollector(prometheus.NewDesc("test_expiry_seconds", "Test.", []string{"namespace", "name"}, nil))
+	})
+
+	It("Should report the seconds until the expiration when scraped", func() {
+		collector.Set(types.NamespacedName{Namespace: "default", Name: "ecr"}, time.Now().Add(time.Hour))
+
+		Expect(testutil.CollectAndCount(collector)).To(Equal(1))
+		Expect(testutil.ToFloat64(collector)).To(BeNumerically("~", time.Hour.Seconds(), 5))
+	})
+
+	It("Should report negative seconds for expired tokens", func() {
+		collector.Set(types.NamespacedName{Namespace: "default", Name: "ecr"}, time.Now().Add(-time.Minute))
+
+		Expect(testutil.ToFloat64(collector)).To(BeNumerically("~", -time.Minute.Seconds(), 5))
+	})
+
+	It("Should report a series by object and replace it when set again", func() {
+		collector.Set(types.NamespacedName{Namespace: "default", Name: "ecr"}, time.Now().Add(time.Hour))
+		collector.Set(types.NamespacedName{Namespace: "other", Name: "ecr"}, time.Now().Add(time.Hour))
+		collector.Set(types.NamespacedName{Namespace: "default", Name: "ecr"}, time.Now().Add(2*time.Hour))
+
+		Expect(testutil.CollectAndCount(collector)).To(Equal(2))
+	})
+
+	It("Should remove the series on Delete", func() {
+		key := types.NamespacedName{Namespace: "default", Name: "ecr"}
+		collector.Set(key, time.Now().Add(time.Hour))
+		collector.Set(types.NamespacedName{Namespace: "default", Name: "quay"}, time.Now().Add(time.Hour))
+
+		collector.Delete(key)
+		Expect(testutil.CollectAndCount(collector)).To(Equal(1))
+		collector.Delete(types.NamespacedName{Namespace: "default", Name: "quay"})
+		Expect(testutil.CollectAndCount(collector)).To(BeZero())
+	})
+})
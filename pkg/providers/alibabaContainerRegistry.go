@@ -0,0 +1,325 @@
+package providers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/astrokube/registry-controller/api/v1alpha1"
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// alibabaRegionRegexp matches Alibaba Cloud region IDs, like cn-hangzhou or
+// ap-southeast-1
+var alibabaRegionRegexp = regexp.MustCompile(`^[a-z]{2}-[a-z]+(-[0-9]+)?$`)
+
+func init() {
+	Register(Provider{
+		Name:        "alibabaContainerRegistry",
+		DisplayName: "Alibaba Cloud Container Registry",
+		Factory: func(reader client.Reader, registryCredentials *v1alpha1.RegistryCredentials) (Authenticator, error) {
+			return NewAlibabaContainerRegistryAuthenticator(reader, registryCredentials.Spec.Provider.AlibabaContainerRegistry), nil
+		},
+		Validator: validateAlibabaContainerRegistry,
+	})
+}
+
+func validateAlibabaContainerRegistry(registryCredentials *v1alpha1.RegistryCredentials) error {
+	provider := registryCredentials.Spec.Provider.AlibabaContainerRegistry
+	if !alibabaRegionRegexp.MatchString(provider.Region) {
+		return fmt.Errorf("invalid region %q, it must be a region ID like cn-hangzhou", provider.Region)
+	}
+	if provider.AccessKeySecretRef.Name == "" {
+		return errors.New("accessKeySecretRef is required")
+	}
+	if provider.InstanceID != "" && provider.Registry == "" {
+		return errors.New("registry is required with instanceId")
+	}
+	if provider.Endpoint != "" {
+		if err := checkURL("endpoint", provider.Endpoint); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// alibabaEnterpriseToken is the response of GetAuthorizationToken of the
+// Enterprise Edition API
+type alibabaEnterpriseToken struct {
+	AuthorizationToken string `json:"AuthorizationToken"`
+	TempUsername       string `json:"TempUsername"`
+	ExpireTime         int64  `json:"ExpireTime"`
+}
+
+// alibabaPersonalToken is the response of GetAuthorizationToken of the Personal
+// Edition API
+type alibabaPersonalToken struct {
+	Data struct {
+		AuthorizationToken string `json:"authorizationToken"`
+		TempUserName       string `json:"tempUserName"`
+		ExpireDate         int64  `json:"expireDate"`
+	} `json:"data"`
+}
+
+// alibabaError is the body of the errors of the Alibaba Cloud APIs
+type alibabaError struct {
+	Code    string `json:"Code"`
+	Message string `json:"Message"`
+}
+
+func NewAlibabaContainerRegistryAuthenticator(reader client.Reader, provider *v1alpha1.AlibabaContainerRegistry) Authenticator {
+	return &alibabaContainerRegistryAuthenticator{
+		Reader:   reader,
+		Provider: provider,
+	}
+}
+
+type alibabaContainerRegistryAuthenticator struct {
+	Reader   client.Reader
+	Provider *v1alpha1.AlibabaContainerRegistry
+}
+
+func (a *alibabaContainerRegistryAuthenticator) GetToken(ctx context.Context, log logr.Logger, registryCredentials *v1alpha1.RegistryCredentials) (*Result, error) {
+	secret, err := getSecret(ctx, a.Reader, registryCredentials.Namespace, a.Provider.AccessKeySecretRef.Name)
+	if err != nil {
+		return nil, err
+	}
+	accessKeyID, accessKeySecret := string(secret.Data["accessKeyId"]), string(secret.Data["accessKeySecret"])
+	if accessKeyID == "" || accessKeySecret == "" {
+		return nil, fmt.Errorf("the Secret %q must have the accessKeyId and accessKeySecret keys", secret.Name)
+	}
+
+	httpClient, err := newHTTPClient(a.Provider.CABundle)
+	if err != nil {
+		return nil, err
+	}
+	defer httpClient.CloseIdleConnections()
+
+	// The endpoint is checked again, as the allowed URLs can change after the
+	// RegistryCredentials are created
+	endpoint := a.Provider.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://cr.%s.aliyuncs.com", a.Provider.Region)
+	} else if err := checkURL("endpoint", endpoint); err != nil {
+		return nil, err
+	}
+	endpoint = strings.TrimRight(endpoint, "/")
+	now := time.Now()
+
+	var username, password string
+	var expireTime int64
+	if a.Provider.InstanceID != "" {
+		req, err := newAlibabaRPCRequest(ctx, endpoint, accessKeyID, accessKeySecret, now, url.Values{
+			"Action":     {"GetAuthorizationToken"},
+			"Version":    {"2018-12-01"},
+			"RegionId":   {a.Provider.Region},
+			"InstanceId": {a.Provider.InstanceID},
+		})
+		if err != nil {
+			return nil, err
+		}
+		token := &alibabaEnterpriseToken{}
+		if err := doAlibaba(ctx, httpClient, req, token); err != nil {
+			log.Info("Unable to get authorization token", "instanceId", a.Provider.InstanceID)
+			return nil, err
+		}
+		username, password, expireTime = token.TempUsername, token.AuthorizationToken, token.ExpireTime
+	} else {
+		req, err := newAlibabaROARequest(ctx, endpoint, "/tokens", accessKeyID, accessKeySecret, a.Provider.Region, now)
+		if err != nil {
+			return nil, err
+		}
+		token := &alibabaPersonalToken{}
+		if err := doAlibaba(ctx, httpClient, req, token); err != nil {
+			log.Info("Unable to get authorization token", "region", a.Provider.Region)
+			return nil, err
+		}
+		username, password, expireTime = token.Data.TempUserName, token.Data.AuthorizationToken, token.Data.ExpireDate
+	}
+	if password == "" {
+		return nil, errors.New("Alibaba Cloud didn't return an authorization token")
+	}
+
+	registry := a.Provider.Registry
+	if registry == "" {
+		registry = fmt.Sprintf("registry.%s.aliyuncs.com", a.Provider.Region)
+	}
+	result := &Result{
+		Registry: registry,
+		Token:    base64.StdEncoding.EncodeToString([]byte(username + ":" + password)),
+	}
+	if expireTime > 0 {
+		expiresAt := time.Unix(0, expireTime*int64(time.Millisecond))
+		result.ExpiresAt = &expiresAt
+	}
+
+	return result, nil
+}
+
+// newAlibabaRPCRequest returns a GET request to an RPC style API signed with
+// the AccessKey, as described in
+// https://www.alibabacloud.com/help/doc-detail/28761.htm
+func newAlibabaRPCRequest(ctx context.Context, endpoint, accessKeyID, accessKeySecret string, now time.Time, parameters url.Values) (*http.Request, error) {
+	nonce, err := newAlibabaNonce()
+	if err != nil {
+		return nil, err
+	}
+	parameters.Set("Format", "JSON")
+	parameters.Set("AccessKeyId", accessKeyID)
+	parameters.Set("SignatureMethod", "HMAC-SHA1")
+	parameters.Set("SignatureVersion", "1.0")
+	parameters.Set("SignatureNonce", nonce)
+	parameters.Set("Timestamp", now.UTC().Format("2006-01-02T15:04:05Z"))
+
+	query := alibabaCanonicalizedQuery(parameters)
+	signature := alibabaSign(accessKeySecret+"&", http.MethodGet+"&"+alibabaPercentEncode("/")+"&"+alibabaPercentEncode(query))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"/?"+query+"&Signature="+alibabaPercentEncode(signature), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	return req, nil
+}
+
+// newAlibabaROARequest returns a GET request to a ROA style API signed with the
+// AccessKey
+func newAlibabaROARequest(ctx context.Context, endpoint, path, accessKeyID, accessKeySecret, region string, now time.Time) (*http.Request, error) {
+	nonce, err := newAlibabaNonce()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Date", now.UTC().Format(http.TimeFormat))
+	req.Header.Set("x-acs-region-id", region)
+	req.Header.Set("x-acs-signature-method", "HMAC-SHA1")
+	req.Header.Set("x-acs-signature-nonce", nonce)
+	req.Header.Set("x-acs-signature-version", "1.0")
+	req.Header.Set("x-acs-version", "2016-06-07")
+	req.Header.Set("Authorization", "acs "+accessKeyID+":"+alibabaSign(accessKeySecret, alibabaROAStringToSign(req)))
+
+	return req, nil
+}
+
+// alibabaROAStringToSign returns the string signed for ROA style requests: the
+// method, the standard headers, the x-acs- headers and the resource
+func alibabaROAStringToSign(req *http.Request) string {
+	builder := strings.Builder{}
+	builder.WriteString(req.Method + "\n")
+	for _, header := range []string{"Accept", "Content-MD5", "Content-Type", "Date"} {
+		builder.WriteString(req.Header.Get(header) + "\n")
+	}
+
+	headers := []string{}
+	for header := range req.Header {
+		if header = strings.ToLower(header); strings.HasPrefix(header, "x-acs-") {
+			headers = append(headers, header)
+		}
+	}
+	sort.Strings(headers)
+	for _, header := range headers {
+		builder.WriteString(header + ":" + req.Header.Get(header) + "\n")
+	}
+
+	builder.WriteString(req.URL.Path)
+	if req.URL.RawQuery != "" {
+		builder.WriteString("?" + alibabaCanonicalizedQuery(req.URL.Query()))
+	}
+
+	return builder.String()
+}
+
+// alibabaCanonicalizedQuery returns the parameters sorted by key and percent
+// encoded
+func alibabaCanonicalizedQuery(parameters url.Values) string {
+	keys := make([]string, 0, len(parameters))
+	for key := range parameters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, alibabaPercentEncode(key)+"="+alibabaPercentEncode(parameters.Get(key)))
+	}
+
+	return strings.Join(pairs, "&")
+}
+
+// alibabaPercentEncode encodes the value as RFC 3986 requires, which differs
+// from the query encoding of Go in spaces, asterisks and tildes
+func alibabaPercentEncode(value string) string {
+	encoded := url.QueryEscape(value)
+	encoded = strings.ReplaceAll(encoded, "+", "%20")
+	encoded = strings.ReplaceAll(encoded, "*", "%2A")
+	encoded = strings.ReplaceAll(encoded, "%7E", "~")
+
+	return encoded
+}
+
+func alibabaSign(key, stringToSign string) string {
+	mac := hmac.New(sha1.New, []byte(key))
+	mac.Write([]byte(stringToSign))
+
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func newAlibabaNonce() (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(nonce), nil
+}
+
+// doAlibaba sends the request and decodes the JSON response into out. Errors
+// caused by the AccessKey are returned as UnauthorizedError, as Alibaba Cloud
+// doesn't return them with a 401 or 403 status.
+func doAlibaba(ctx context.Context, httpClient *http.Client, req *http.Request, out interface{}) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return getHTTPError(ctx, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return getHTTPError(ctx, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		apiError := alibabaError{}
+		json.Unmarshal(body, &apiError)
+		err := fmt.Errorf("%s %s returned %s: %s", req.Method, req.URL.Path, resp.Status, apiError.Code)
+		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden ||
+			strings.HasPrefix(apiError.Code, "InvalidAccessKeyId") || apiError.Code == "SignatureDoesNotMatch" {
+			return &UnauthorizedError{Err: err}
+		}
+		return err
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("decoding response of %s: %w", req.URL.Path, err)
+	}
+
+	return nil
+}
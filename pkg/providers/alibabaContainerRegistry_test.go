@@ -0,0 +1,148 @@
+package providers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/astrokube/registry-controller/api/v1alpha1"
+)
+
+var _ = Describe("Alibaba Cloud Container Registry provider", func() {
+	var (
+		server   *httptest.Server
+		expireAt time.Time
+	)
+
+	registryCredentials := &v1alpha1.RegistryCredentials{
+		ObjectMeta: metav1.ObjectMeta{Name: "sample", Namespace: "default"},
+	}
+
+	writeError := func(w http.ResponseWriter, status int, code string) {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(alibabaError{Code: code, Message: "rejected"})
+	}
+
+	BeforeEach(func() {
+		expireAt = time.Now().Add(time.Hour).Truncate(time.Millisecond)
+		server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/":
+				// Enterprise Edition RPC API
+				query := r.URL.Query()
+				if query.Get("AccessKeyId") != "LTAI-id" {
+					writeError(w, http.StatusNotFound, "InvalidAccessKeyId.NotFound")
+					return
+				}
+				signature := query.Get("Signature")
+				query.Del("Signature")
+				if signature != alibabaSign("secret&", "GET&%2F&"+alibabaPercentEncode(alibabaCanonicalizedQuery(query))) {
+					writeError(w, http.StatusBadRequest, "SignatureDoesNotMatch")
+					return
+				}
+				Expect(query.Get("Action")).To(Equal("GetAuthorizationToken"))
+				Expect(query.Get("InstanceId")).To(Equal("cri-123"))
+				Expect(query.Get("RegionId")).To(Equal("cn-hangzhou"))
+				json.NewEncoder(w).Encode(alibabaEnterpriseToken{
+					AuthorizationToken: "enterprise-token",
+					TempUsername:       "cr_temp_user",
+					ExpireTime:         expireAt.UnixNano() / int64(time.Millisecond),
+				})
+			case "/tokens":
+				// Personal Edition ROA API
+				authorization := strings.TrimPrefix(r.Header.Get("Authorization"), "acs ")
+				if authorization != "LTAI-id:"+alibabaSign("secret", alibabaROAStringToSign(r)) {
+					writeError(w, http.StatusBadRequest, "SignatureDoesNotMatch")
+					return
+				}
+				Expect(r.Header.Get("x-acs-version")).To(Equal("2016-06-07"))
+				token := alibabaPersonalToken{}
+				token.Data.AuthorizationToken = "personal-token"
+				token.Data.TempUserName = "cr_temp_user"
+				token.Data.ExpireDate = expireAt.UnixNano() / int64(time.Millisecond)
+				json.NewEncoder(w).Encode(token)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		AllowedURLs = []string{server.URL}
+	})
+
+	AfterEach(func() {
+		server.Close()
+		AllowedURLs = nil
+	})
+
+	getToken := func(secret string, provider *v1alpha1.AlibabaContainerRegistry) (*Result, error) {
+		reader := fake.NewClientBuilder().WithObjects(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "alibaba", Namespace: "default"},
+			Data:       map[string][]byte{"accessKeyId": []byte("LTAI-id"), "accessKeySecret": []byte(secret)},
+		}).Build()
+		provider.Region = "cn-hangzhou"
+		provider.AccessKeySecretRef = corev1.LocalObjectReference{Name: "alibaba"}
+		provider.Endpoint = server.URL
+		provider.CABundle = certificatePEM(server.Certificate())
+
+		return NewAlibabaContainerRegistryAuthenticator(reader, provider).GetToken(context.Background(), log.Log, registryCredentials)
+	}
+
+	Context("When using the Personal Edition", func() {
+		It("Should get a temporary token of the regional registry", func() {
+			result, err := getToken("secret", &v1alpha1.AlibabaContainerRegistry{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Registry).To(Equal("registry.cn-hangzhou.aliyuncs.com"))
+			Expect(result.Token).To(Equal(base64.StdEncoding.EncodeToString([]byte("cr_temp_user:personal-token"))))
+			Expect(result.ExpiresAt).NotTo(BeNil())
+			Expect(result.ExpiresAt.Equal(expireAt)).To(BeTrue())
+		})
+	})
+
+	Context("When using an Enterprise Edition instance", func() {
+		It("Should get a temporary token of the instance", func() {
+			result, err := getToken("secret", &v1alpha1.AlibabaContainerRegistry{InstanceID: "cri-123", Registry: "myinstance-registry.cn-hangzhou.cr.aliyuncs.com"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Registry).To(Equal("myinstance-registry.cn-hangzhou.cr.aliyuncs.com"))
+			Expect(result.Token).To(Equal(base64.StdEncoding.EncodeToString([]byte("cr_temp_user:enterprise-token"))))
+		})
+
+		It("Should return an UnauthorizedError when the signature is rejected", func() {
+			_, err := getToken("invalid", &v1alpha1.AlibabaContainerRegistry{InstanceID: "cri-123", Registry: "myinstance-registry.cn-hangzhou.cr.aliyuncs.com"})
+			Expect(IsUnauthorized(err)).To(BeTrue())
+		})
+	})
+
+	Context("When signing requests", func() {
+		It("Should percent encode as RFC 3986 requires", func() {
+			Expect(alibabaPercentEncode("a b*c~d/e")).To(Equal("a%20b%2Ac~d%2Fe"))
+		})
+	})
+
+	Context("When validating the provider", func() {
+		validate := func(provider *v1alpha1.AlibabaContainerRegistry) error {
+			return Validate(&v1alpha1.RegistryCredentials{Spec: v1alpha1.RegistryCredentialsSpec{
+				Provider: v1alpha1.RegistryProvider{AlibabaContainerRegistry: provider},
+			}})
+		}
+		accessKeySecretRef := corev1.LocalObjectReference{Name: "alibaba"}
+
+		It("Should reject invalid regions", func() {
+			Expect(validate(&v1alpha1.AlibabaContainerRegistry{Region: "ap-southeast-1", AccessKeySecretRef: accessKeySecretRef})).To(Succeed())
+			Expect(validate(&v1alpha1.AlibabaContainerRegistry{Region: "Hangzhou", AccessKeySecretRef: accessKeySecretRef})).NotTo(Succeed())
+		})
+
+		It("Should require the registry of Enterprise Edition instances", func() {
+			Expect(validate(&v1alpha1.AlibabaContainerRegistry{Region: "cn-hangzhou", AccessKeySecretRef: accessKeySecretRef, InstanceID: "cri-123"})).NotTo(Succeed())
+		})
+	})
+})
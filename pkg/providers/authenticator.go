@@ -1,10 +1,25 @@
 package providers
 
 import (
+	"context"
+
 	"github.com/astrokube/registry-controller/api/v1alpha1"
 	"github.com/go-logr/logr"
 )
 
 type Authenticator interface {
-	GetToken(log logr.Logger, registryCredentials *v1alpha1.RegistryCredentials) *AuthenticationIntent
+	// GetToken authenticates against the provider and returns the token to
+	// access the registry. The context bounds the call, so providers must
+	// stop as soon as it is done. Failures are returned as typed errors, like
+	// UnauthorizedError.
+	GetToken(ctx context.Context, log logr.Logger, registryCredentials *v1alpha1.RegistryCredentials) (*Result, error)
+}
+
+// Revoker is implemented by the authenticators issuing credentials that must be
+// revoked once they are replaced or the RegistryCredentials is deleted, like
+// robot accounts.
+type Revoker interface {
+	// Revoke revokes the credentials identified by the annotations of the
+	// Result that issued them, which are stored in the generated Secret.
+	Revoke(ctx context.Context, log logr.Logger, registryCredentials *v1alpha1.RegistryCredentials, annotations map[string]string) error
 }
@@ -1,18 +1,46 @@
 package providers
 
 import (
+	"context"
+	"errors"
 	"fmt"
 
 	"github.com/astrokube/registry-controller/api/v1alpha1"
+	"github.com/astrokube/registry-controller/pkg/tracing"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ecr"
 	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+func init() {
+	Register(Provider{
+		Name:        "awsElasticContainerRegistry",
+		DisplayName: "AWS Elastic Container Registry",
+		Factory: func(reader client.Reader, registryCredentials *v1alpha1.RegistryCredentials) (Authenticator, error) {
+			return NewAWSElasticContainerRegistryAuthenticator(registryCredentials.Spec.Provider.AWSElasticContainerRegistry), nil
+		},
+		Validator: validateAWSElasticContainerRegistry,
+	})
+}
+
+func validateAWSElasticContainerRegistry(registryCredentials *v1alpha1.RegistryCredentials) error {
+	provider := registryCredentials.Spec.Provider.AWSElasticContainerRegistry
+	if provider.Region == "" {
+		return errors.New("region is required")
+	}
+	if provider.AccessKeyID == "" || provider.SecretAccessKey == "" {
+		return errors.New("accessKeyId and secretAccessKey are required")
+	}
+
+	return nil
+}
+
 func NewAWSElasticContainerRegistryAuthenticator(provider *v1alpha1.AWSElasticContainerRegistry) Authenticator {
 	return &awsElasticContainerRegistryAuthenticator{
 		AccessKeyID:     provider.AccessKeyID,
@@ -27,45 +55,38 @@ type awsElasticContainerRegistryAuthenticator struct {
 	SecretAccessKey string
 }
 
-func (c *awsElasticContainerRegistryAuthenticator) GetToken(log logr.Logger, registryCredentials *v1alpha1.RegistryCredentials) *AuthenticationIntent {
+func (c *awsElasticContainerRegistryAuthenticator) GetToken(ctx context.Context, log logr.Logger, registryCredentials *v1alpha1.RegistryCredentials) (*Result, error) {
 	awsSession, err := c.getAwsSession(log, registryCredentials)
 	if err != nil {
-		return &AuthenticationIntent{
-			State: c.getState(err),
-			Error: err,
-		}
+		return nil, c.getError(err)
 	}
 
 	svc := ecr.New(awsSession)
 	input := &ecr.GetAuthorizationTokenInput{}
 
-	result, err := svc.GetAuthorizationToken(input)
+	result, err := svc.GetAuthorizationTokenWithContext(ctx, input)
 	if err != nil {
 		log.Info("Unable to get authorization token")
-		return &AuthenticationIntent{
-			State: c.getState(err),
-			Error: err,
-		}
+		return nil, c.getError(err)
+	}
+	if len(result.AuthorizationData) == 0 {
+		return nil, fmt.Errorf("no authorization data returned by ECR")
 	}
 
 	stsSvc := sts.New(awsSession)
-	identity, err := stsSvc.GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	identity, err := stsSvc.GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{})
 	if err != nil {
 		log.Info("Unable to get CallerIdentity")
-		return &AuthenticationIntent{
-			State: c.getState(err),
-			Error: err,
-		}
+		return nil, c.getError(err)
 	}
 
 	registry := fmt.Sprintf("%s.dkr.ecr.%s.amazonaws.com", *identity.Account, registryCredentials.Spec.Provider.AWSElasticContainerRegistry.Region)
 
-	return &AuthenticationIntent{
+	return &Result{
 		Registry:  registry,
-		State:     v1alpha1.RegistryCredentialsAuthenticated,
 		Token:     *result.AuthorizationData[0].AuthorizationToken,
 		ExpiresAt: result.AuthorizationData[0].ExpiresAt,
-	}
+	}, nil
 }
 
 func (r *awsElasticContainerRegistryAuthenticator) getAwsSession(log logr.Logger, registryCredentials *v1alpha1.RegistryCredentials) (*session.Session, error) {
@@ -77,20 +98,28 @@ func (r *awsElasticContainerRegistryAuthenticator) getAwsSession(log logr.Logger
 		Credentials: credentials,
 		Region:      aws.String(registryCredentials.Spec.Provider.AWSElasticContainerRegistry.Region),
 	}
-	return session.NewSession(awsConfig)
+	awsSession, err := session.NewSession(awsConfig)
+	if err != nil {
+		return nil, err
+	}
+	tracing.InstrumentAWSHandlers(&awsSession.Handlers)
+
+	return awsSession, nil
 }
 
-func (r *awsElasticContainerRegistryAuthenticator) getState(err error) v1alpha1.RegistryCredentialsState {
+func (r *awsElasticContainerRegistryAuthenticator) getError(err error) error {
 	if aerr, ok := err.(awserr.Error); ok {
 		switch aerr.Code() {
 		case "UnrecognizedClientException":
-			return v1alpha1.RegistryCredentialsUnauthorized
+			return &UnauthorizedError{Err: err}
 		case "InvalidSignatureException":
-			return v1alpha1.RegistryCredentialsUnauthorized
+			return &UnauthorizedError{Err: err}
+		case request.CanceledErrorCode:
+			return &TimeoutError{Err: err}
 		default:
-			return v1alpha1.RegistryCredentialsErrored
+			return err
 		}
 	} else {
-		return v1alpha1.RegistryCredentialsErrored
+		return err
 	}
 }
@@ -0,0 +1,226 @@
+package providers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/astrokube/registry-controller/api/v1alpha1"
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// DockerHubRegistry is the key of Docker Hub in docker config files
+	DockerHubRegistry = "https://index.docker.io/v1/"
+
+	defaultDockerHubAuthURL     = "https://auth.docker.io/token"
+	defaultDockerHubRegistryURL = "https://registry-1.docker.io"
+
+	// dockerHubRateLimitRepository is the repository provided by Docker to
+	// check the rate limit. HEAD requests of its manifest don't count as
+	// pulls.
+	dockerHubRateLimitRepository = "ratelimitpreview/test"
+)
+
+func init() {
+	Register(Provider{
+		Name:        "dockerHub",
+		DisplayName: "Docker Hub",
+		Factory: func(reader client.Reader, registryCredentials *v1alpha1.RegistryCredentials) (Authenticator, error) {
+			return NewDockerHubAuthenticator(reader, registryCredentials.Spec.Provider.DockerHub), nil
+		},
+		Validator: validateDockerHub,
+	})
+}
+
+func validateDockerHub(registryCredentials *v1alpha1.RegistryCredentials) error {
+	provider := registryCredentials.Spec.Provider.DockerHub
+	if provider.CredentialsSecretRef.Name == "" {
+		return errors.New("credentialsSecretRef is required")
+	}
+	for field, value := range map[string]string{"authUrl": provider.AuthURL, "registryUrl": provider.RegistryURL} {
+		if value == "" {
+			continue
+		}
+		if err := checkURL(field, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dockerHubToken is the response of the token endpoint
+type dockerHubToken struct {
+	Token       string `json:"token"`
+	AccessToken string `json:"access_token"`
+}
+
+func NewDockerHubAuthenticator(reader client.Reader, provider *v1alpha1.DockerHubProvider) Authenticator {
+	return &dockerHubAuthenticator{
+		Reader:   reader,
+		Provider: provider,
+	}
+}
+
+type dockerHubAuthenticator struct {
+	Reader   client.Reader
+	Provider *v1alpha1.DockerHubProvider
+}
+
+func (a *dockerHubAuthenticator) GetToken(ctx context.Context, log logr.Logger, registryCredentials *v1alpha1.RegistryCredentials) (*Result, error) {
+	secret, err := getSecret(ctx, a.Reader, registryCredentials.Namespace, a.Provider.CredentialsSecretRef.Name)
+	if err != nil {
+		return nil, err
+	}
+	username, token := string(secret.Data["username"]), strings.TrimSpace(string(secret.Data["token"]))
+	if username == "" || token == "" {
+		return nil, fmt.Errorf("the Secret %q must have the username and token keys", secret.Name)
+	}
+
+	httpClient, err := newHTTPClient(a.Provider.CABundle)
+	if err != nil {
+		return nil, err
+	}
+	defer httpClient.CloseIdleConnections()
+
+	// Validate the personal access token with a pull token for the rate limit
+	// repository
+	bearer, err := a.getPullToken(ctx, httpClient, username, token)
+	if err != nil {
+		log.Info("Unable to validate the personal access token", "username", username)
+		return nil, err
+	}
+
+	result := &Result{
+		Registry: DockerHubRegistry,
+		Token:    base64.StdEncoding.EncodeToString([]byte(username + ":" + token)),
+	}
+
+	// The rate limit is informative, so failures don't prevent the
+	// authentication
+	rateLimit, err := a.getPullRateLimit(ctx, httpClient, bearer)
+	if err != nil {
+		log.Error(err, "Unable to get the pull rate limit")
+	} else if rateLimit != nil {
+		log.Info("Got the pull rate limit", "limit", rateLimit.Limit, "remaining", rateLimit.Remaining)
+		result.PullRateLimit = rateLimit
+	}
+
+	return result, nil
+}
+
+// getPullToken exchanges the personal access token for a bearer token to pull
+// the rate limit repository
+func (a *dockerHubAuthenticator) getPullToken(ctx context.Context, httpClient *http.Client, username, token string) (string, error) {
+	authURL := a.Provider.AuthURL
+	if authURL == "" {
+		authURL = defaultDockerHubAuthURL
+	} else if err := checkURL("authUrl", authURL); err != nil {
+		return "", err
+	}
+	query := url.Values{
+		"service": {"registry.docker.io"},
+		"scope":   {"repository:" + dockerHubRateLimitRepository + ":pull"},
+	}
+	req, err := newJSONRequest(ctx, http.MethodGet, authURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(username, token)
+
+	response := &dockerHubToken{}
+	if err := doJSON(ctx, httpClient, req, response); err != nil {
+		return "", err
+	}
+	if response.Token != "" {
+		return response.Token, nil
+	}
+	if response.AccessToken != "" {
+		return response.AccessToken, nil
+	}
+
+	return "", errors.New("Docker Hub didn't return a token")
+}
+
+// getPullRateLimit returns the rate limit reported in the headers of the
+// manifest of the rate limit repository, or nil if the account isn't limited
+func (a *dockerHubAuthenticator) getPullRateLimit(ctx context.Context, httpClient *http.Client, bearer string) (*PullRateLimit, error) {
+	registryURL := a.Provider.RegistryURL
+	if registryURL == "" {
+		registryURL = defaultDockerHubRegistryURL
+	} else if err := checkURL("registryUrl", registryURL); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, strings.TrimRight(registryURL, "/")+"/v2/"+dockerHubRateLimitRepository+"/manifests/latest", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+bearer)
+	req.Header.Set("Accept", "application/vnd.docker.distribution.manifest.v2+json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, getHTTPError(ctx, err)
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp); err != nil {
+		return nil, err
+	}
+
+	return parsePullRateLimit(resp.Header)
+}
+
+// parsePullRateLimit parses the ratelimit-limit and ratelimit-remaining
+// headers, like 100;w=21600
+func parsePullRateLimit(header http.Header) (*PullRateLimit, error) {
+	limitHeader, remainingHeader := header.Get("ratelimit-limit"), header.Get("ratelimit-remaining")
+	if limitHeader == "" || remainingHeader == "" {
+		return nil, nil
+	}
+
+	limit, window, err := parseRateLimitHeader(limitHeader)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ratelimit-limit header %q: %w", limitHeader, err)
+	}
+	remaining, _, err := parseRateLimitHeader(remainingHeader)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ratelimit-remaining header %q: %w", remainingHeader, err)
+	}
+
+	return &PullRateLimit{
+		Limit:     limit,
+		Remaining: remaining,
+		Window:    window,
+	}, nil
+}
+
+func parseRateLimitHeader(value string) (int64, time.Duration, error) {
+	parts := strings.Split(value, ";")
+	quota, err := strconv.ParseInt(strings.TrimSpace(parts[0]), 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var window time.Duration
+	for _, parameter := range parts[1:] {
+		parameter = strings.TrimSpace(parameter)
+		if !strings.HasPrefix(parameter, "w=") {
+			continue
+		}
+		seconds, err := strconv.ParseInt(strings.TrimPrefix(parameter, "w="), 10, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+		window = time.Duration(seconds) * time.Second
+	}
+
+	return quota, window, nil
+}
@@ -0,0 +1,114 @@
+package providers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/astrokube/registry-controller/api/v1alpha1"
+)
+
+var _ = Describe("Docker Hub provider", func() {
+	var (
+		server          *httptest.Server
+		rateLimitHeader bool
+	)
+
+	registryCredentials := &v1alpha1.RegistryCredentials{
+		ObjectMeta: metav1.ObjectMeta{Name: "sample", Namespace: "default"},
+	}
+
+	BeforeEach(func() {
+		rateLimitHeader = true
+		server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.Method == http.MethodGet && r.URL.Path == "/token":
+				username, password, ok := r.BasicAuth()
+				if !ok || username != "user" || password != "dckr_pat_valid" {
+					w.WriteHeader(http.StatusUnauthorized)
+					w.Write([]byte(`{"details":"incorrect username or password"}`))
+					return
+				}
+				Expect(r.URL.Query().Get("service")).To(Equal("registry.docker.io"))
+				Expect(r.URL.Query().Get("scope")).To(Equal("repository:ratelimitpreview/test:pull"))
+				json.NewEncoder(w).Encode(dockerHubToken{Token: "bearer"})
+			case r.Method == http.MethodHead && r.URL.Path == "/v2/ratelimitpreview/test/manifests/latest":
+				if r.Header.Get("Authorization") != "Bearer bearer" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				if rateLimitHeader {
+					w.Header().Set("ratelimit-limit", "200;w=21600")
+					w.Header().Set("ratelimit-remaining", "76;w=21600")
+				}
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		AllowedURLs = []string{server.URL}
+	})
+
+	AfterEach(func() {
+		server.Close()
+		AllowedURLs = nil
+	})
+
+	getToken := func(token string) (*Result, error) {
+		reader := fake.NewClientBuilder().WithObjects(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "docker-hub", Namespace: "default"},
+			Data:       map[string][]byte{"username": []byte("user"), "token": []byte(token)},
+		}).Build()
+
+		return NewDockerHubAuthenticator(reader, &v1alpha1.DockerHubProvider{
+			CredentialsSecretRef: corev1.LocalObjectReference{Name: "docker-hub"},
+			AuthURL:              server.URL + "/token",
+			RegistryURL:          server.URL,
+			CABundle:             certificatePEM(server.Certificate()),
+		}).GetToken(context.Background(), log.Log, registryCredentials)
+	}
+
+	Context("When the personal access token is valid", func() {
+		It("Should return the Docker Hub auth entry with the pull rate limit", func() {
+			result, err := getToken("dckr_pat_valid")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Registry).To(Equal("https://index.docker.io/v1/"))
+			Expect(result.Token).To(Equal(base64.StdEncoding.EncodeToString([]byte("user:dckr_pat_valid"))))
+			Expect(result.ExpiresAt).To(BeNil())
+			Expect(result.PullRateLimit).To(Equal(&PullRateLimit{Limit: 200, Remaining: 76, Window: 6 * time.Hour}))
+		})
+
+		It("Should not report a rate limit for unlimited accounts", func() {
+			rateLimitHeader = false
+			result, err := getToken("dckr_pat_valid")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.PullRateLimit).To(BeNil())
+		})
+	})
+
+	Context("When the personal access token is invalid", func() {
+		It("Should return an UnauthorizedError", func() {
+			_, err := getToken("dckr_pat_invalid")
+			Expect(IsUnauthorized(err)).To(BeTrue())
+		})
+	})
+
+	Context("When parsing the rate limit headers", func() {
+		It("Should fail on invalid quotas", func() {
+			header := http.Header{}
+			header.Set("ratelimit-limit", "many;w=21600")
+			header.Set("ratelimit-remaining", "76")
+			_, err := parsePullRateLimit(header)
+			Expect(err).To(MatchError(ContainSubstring("invalid ratelimit-limit header")))
+		})
+	})
+})
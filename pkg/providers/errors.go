@@ -0,0 +1,86 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/astrokube/registry-controller/api/v1alpha1"
+)
+
+var (
+	ErrProviderNotImplemented = errors.New("Provider not implemented")
+)
+
+// UnauthorizedError is returned when the provider rejects the credentials
+type UnauthorizedError struct {
+	Err error
+}
+
+func (e *UnauthorizedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *UnauthorizedError) Unwrap() error {
+	return e.Err
+}
+
+// TimeoutError is returned when the provider doesn't answer before the
+// deadline of the call
+type TimeoutError struct {
+	Err error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("timeout waiting for the provider: %v", e.Err)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// MissingCredentialsError is returned when the Secret with the credentials of
+// the provider, like the ones of an admin account, doesn't exist
+type MissingCredentialsError struct {
+	Err error
+}
+
+func (e *MissingCredentialsError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *MissingCredentialsError) Unwrap() error {
+	return e.Err
+}
+
+// IsUnauthorized returns true if the error is an UnauthorizedError.
+func IsUnauthorized(err error) bool {
+	var unauthorizedError *UnauthorizedError
+	return errors.As(err, &unauthorizedError)
+}
+
+// IsTimeout returns true if the error is a TimeoutError or the deadline of the
+// context was exceeded.
+func IsTimeout(err error) bool {
+	var timeoutError *TimeoutError
+	return errors.As(err, &timeoutError) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// IsMissingCredentials returns true if the error is a MissingCredentialsError.
+func IsMissingCredentials(err error) bool {
+	var missingCredentialsError *MissingCredentialsError
+	return errors.As(err, &missingCredentialsError)
+}
+
+// GetState returns the state of the RegistryCredentials for the result of a
+// call to GetToken.
+func GetState(err error) v1alpha1.RegistryCredentialsState {
+	switch {
+	case err == nil:
+		return v1alpha1.RegistryCredentialsAuthenticated
+	case IsUnauthorized(err):
+		return v1alpha1.RegistryCredentialsUnauthorized
+	default:
+		return v1alpha1.RegistryCredentialsErrored
+	}
+}
@@ -0,0 +1,51 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/astrokube/registry-controller/api/v1alpha1"
+)
+
+var _ = Describe("Provider errors", func() {
+
+	Context("When getting the state for the result of GetToken", func() {
+		It("Should be Authenticated without error", func() {
+			Expect(GetState(nil)).To(Equal(v1alpha1.RegistryCredentialsAuthenticated))
+		})
+
+		It("Should be Unauthorized for wrapped unauthorized errors", func() {
+			err := fmt.Errorf("getting token: %w", &UnauthorizedError{Err: errors.New("denied")})
+			Expect(IsUnauthorized(err)).To(BeTrue())
+			Expect(GetState(err)).To(Equal(v1alpha1.RegistryCredentialsUnauthorized))
+		})
+
+		It("Should be Errored for timeouts and any other error", func() {
+			err := &TimeoutError{Err: context.DeadlineExceeded}
+			Expect(IsTimeout(err)).To(BeTrue())
+			Expect(GetState(err)).To(Equal(v1alpha1.RegistryCredentialsErrored))
+			Expect(GetState(ErrProviderNotImplemented)).To(Equal(v1alpha1.RegistryCredentialsErrored))
+		})
+	})
+
+	Context("When mapping AWS errors", func() {
+		authenticator := &awsElasticContainerRegistryAuthenticator{}
+
+		It("Should return an UnauthorizedError for invalid credentials", func() {
+			err := authenticator.getError(awserr.New("UnrecognizedClientException", "invalid token", nil))
+			Expect(IsUnauthorized(err)).To(BeTrue())
+		})
+
+		It("Should return a TimeoutError for canceled requests", func() {
+			err := authenticator.getError(awserr.New(request.CanceledErrorCode, "canceled", context.DeadlineExceeded))
+			Expect(IsTimeout(err)).To(BeTrue())
+			Expect(IsUnauthorized(err)).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,367 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/astrokube/registry-controller/api/v1alpha1"
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// DefaultExecPluginDir is the default directory of the credential provider
+	// plugins
+	DefaultExecPluginDir = "/credential-providers"
+
+	defaultExecAPIVersion = "credentialprovider.kubelet.k8s.io/v1"
+)
+
+// ExecPluginDir is the directory of the operator image with the credential
+// provider plugins that can be run by the exec provider. Plugins are referenced
+// by name, so RegistryCredentials can't run binaries outside of it.
+var ExecPluginDir = DefaultExecPluginDir
+
+// ExecPlugins is the configuration of the plugins set by the operator, by
+// plugin name. Plugins without configuration are run with an empty
+// environment and without arguments.
+var ExecPlugins = map[string]*ExecPlugin{}
+
+// ExecPlugin is the configuration of a plugin set by the operator
+type ExecPlugin struct {
+	// Env are the variables of the environment of the plugin, like NAME=value
+	Env []string
+	// AllowedEnv are the names of the variables that RegistryCredentials can
+	// add to the environment of the plugin
+	AllowedEnv []string
+	// AllowedArgs are the arguments that RegistryCredentials can pass to the
+	// plugin. Arguments ending with =, like --region=, allow any value.
+	AllowedArgs []string
+}
+
+func init() {
+	Register(Provider{
+		Name:        "exec",
+		DisplayName: "Exec plugin",
+		Factory: func(reader client.Reader, registryCredentials *v1alpha1.RegistryCredentials) (Authenticator, error) {
+			provider := registryCredentials.Spec.Provider.Exec
+			return NewExecAuthenticator(ExecPluginDir, ExecPlugins[provider.Name], provider), nil
+		},
+		Validator: validateExec,
+	})
+}
+
+func validateExec(registryCredentials *v1alpha1.RegistryCredentials) error {
+	provider := registryCredentials.Spec.Provider.Exec
+	if provider.Name == "" || provider.Name != filepath.Base(provider.Name) || provider.Name == ".." {
+		return fmt.Errorf("name must be the name of a plugin in the plugin directory, got %q", provider.Name)
+	}
+	if provider.Registry == "" {
+		return errors.New("registry is required")
+	}
+	for _, env := range provider.Env {
+		if err := ExecPlugins[provider.Name].checkEnv(provider.Name, env.Name); err != nil {
+			return err
+		}
+	}
+	for _, arg := range provider.Args {
+		if err := ExecPlugins[provider.Name].checkArg(provider.Name, arg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkEnv checks that RegistryCredentials can set the variable of the
+// environment of the plugin
+func (p *ExecPlugin) checkEnv(plugin, name string) error {
+	if isForbiddenEnv(name) {
+		return fmt.Errorf("env %q can't be set", name)
+	}
+	if p != nil {
+		for _, allowed := range p.AllowedEnv {
+			if name == allowed {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("env %q isn't allowed for the plugin %q", name, plugin)
+}
+
+// checkArg checks that RegistryCredentials can pass the argument to the plugin
+func (p *ExecPlugin) checkArg(plugin, arg string) error {
+	if p != nil {
+		for _, allowed := range p.AllowedArgs {
+			if arg == allowed || (strings.HasSuffix(allowed, "=") && strings.HasPrefix(arg, allowed)) {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("arg %q isn't allowed for the plugin %q", arg, plugin)
+}
+
+// isForbiddenEnv returns whether the variable changes how the plugin is loaded
+// or where it connects to, so RegistryCredentials can never set it
+func isForbiddenEnv(name string) bool {
+	upper := strings.ToUpper(name)
+	switch {
+	case strings.HasPrefix(upper, "LD_"), strings.HasPrefix(upper, "DYLD_"), strings.HasSuffix(upper, "_PROXY"):
+		return true
+	}
+	switch upper {
+	case "PATH", "IFS", "ENV", "BASH_ENV", "GCONV_PATH", "HOSTALIASES", "SSL_CERT_FILE", "SSL_CERT_DIR":
+		return true
+	}
+
+	return false
+}
+
+// ExecPluginEnvFlag returns the flag that adds variables to the environment of
+// a plugin, like plugin:NAME=value
+func ExecPluginEnvFlag() flag.Value {
+	return &execPluginFlag{kind: execPluginEnv}
+}
+
+// ExecPluginAllowedEnvFlag returns the flag that allows RegistryCredentials to
+// set variables of the environment of a plugin, like plugin:NAME1,NAME2
+func ExecPluginAllowedEnvFlag() flag.Value {
+	return &execPluginFlag{kind: execPluginAllowedEnv}
+}
+
+// ExecPluginAllowedArgsFlag returns the flag that allows RegistryCredentials
+// to pass arguments to a plugin, like plugin:--arg1,--arg2=
+func ExecPluginAllowedArgsFlag() flag.Value {
+	return &execPluginFlag{kind: execPluginAllowedArgs}
+}
+
+type execPluginFlagKind int
+
+const (
+	execPluginEnv execPluginFlagKind = iota
+	execPluginAllowedEnv
+	execPluginAllowedArgs
+)
+
+// execPluginFlag is a repeatable flag that configures the ExecPlugins
+type execPluginFlag struct {
+	kind   execPluginFlagKind
+	values []string
+}
+
+func (f *execPluginFlag) String() string {
+	if f == nil {
+		return ""
+	}
+
+	return strings.Join(f.values, " ")
+}
+
+func (f *execPluginFlag) Set(value string) error {
+	format := "plugin:NAME=value"
+	switch f.kind {
+	case execPluginAllowedEnv:
+		format = "plugin:NAME1,NAME2"
+	case execPluginAllowedArgs:
+		format = "plugin:--arg1,--arg2="
+	}
+	name, env := splitPluginFlag(value)
+	if name == "" || name != filepath.Base(name) || env == "" || (f.kind == execPluginEnv && !strings.Contains(env, "=")) {
+		return fmt.Errorf("expected %s, got %q", format, value)
+	}
+	plugin, ok := ExecPlugins[name]
+	if !ok {
+		plugin = &ExecPlugin{}
+		ExecPlugins[name] = plugin
+	}
+
+	switch f.kind {
+	case execPluginAllowedEnv:
+		for _, allowed := range strings.Split(env, ",") {
+			if allowed == "" || isForbiddenEnv(allowed) {
+				return fmt.Errorf("env %q can't be allowed", allowed)
+			}
+			plugin.AllowedEnv = append(plugin.AllowedEnv, allowed)
+		}
+	case execPluginAllowedArgs:
+		for _, allowed := range strings.Split(env, ",") {
+			if allowed == "" {
+				return fmt.Errorf("expected %s, got %q", format, value)
+			}
+			plugin.AllowedArgs = append(plugin.AllowedArgs, allowed)
+		}
+	default:
+		plugin.Env = append(plugin.Env, env)
+	}
+	f.values = append(f.values, value)
+
+	return nil
+}
+
+func splitPluginFlag(value string) (string, string) {
+	i := strings.Index(value, ":")
+	if i < 0 {
+		return "", ""
+	}
+
+	return value[:i], value[i+1:]
+}
+
+// credentialProviderRequest is the CredentialProviderRequest of the kubelet
+// credential provider API
+type credentialProviderRequest struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Image      string `json:"image"`
+}
+
+// credentialProviderResponse is the CredentialProviderResponse of the kubelet
+// credential provider API
+type credentialProviderResponse struct {
+	APIVersion    string                `json:"apiVersion"`
+	Kind          string                `json:"kind"`
+	CacheKeyType  string                `json:"cacheKeyType"`
+	CacheDuration *metav1.Duration      `json:"cacheDuration,omitempty"`
+	Auth          map[string]authConfig `json:"auth"`
+}
+
+type authConfig struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// NewExecAuthenticator returns the Authenticator that runs the plugin of the
+// provider from the plugin directory, with the configuration of the operator.
+// The plugin configuration can be nil.
+func NewExecAuthenticator(pluginDir string, plugin *ExecPlugin, provider *v1alpha1.ExecProvider) Authenticator {
+	return &execAuthenticator{
+		PluginDir: pluginDir,
+		Plugin:    plugin,
+		Provider:  provider,
+	}
+}
+
+type execAuthenticator struct {
+	PluginDir string
+	Plugin    *ExecPlugin
+	Provider  *v1alpha1.ExecProvider
+}
+
+func (a *execAuthenticator) GetToken(ctx context.Context, log logr.Logger, registryCredentials *v1alpha1.RegistryCredentials) (*Result, error) {
+	apiVersion := a.Provider.APIVersion
+	if apiVersion == "" {
+		apiVersion = defaultExecAPIVersion
+	}
+
+	request, err := json.Marshal(credentialProviderRequest{
+		APIVersion: apiVersion,
+		Kind:       "CredentialProviderRequest",
+		Image:      a.Provider.Registry,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The plugin doesn't inherit the environment of the operator, it only gets
+	// the variables configured by the operator and the allowed ones of the
+	// RegistryCredentials
+	env := []string{}
+	if a.Plugin != nil {
+		env = append(env, a.Plugin.Env...)
+	}
+	for _, variable := range a.Provider.Env {
+		if err := a.Plugin.checkEnv(a.Provider.Name, variable.Name); err != nil {
+			return nil, err
+		}
+		env = append(env, fmt.Sprintf("%s=%s", variable.Name, variable.Value))
+	}
+	for _, arg := range a.Provider.Args {
+		if err := a.Plugin.checkArg(a.Provider.Name, arg); err != nil {
+			return nil, err
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, filepath.Join(a.PluginDir, filepath.Base(a.Provider.Name)), a.Provider.Args...)
+	cmd.Env = env
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = bytes.NewReader(request)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, &TimeoutError{Err: err}
+		}
+		log.Info("Credential provider plugin failed", "plugin", a.Provider.Name, "stderr", stderr.String())
+		return nil, fmt.Errorf("running plugin %q: %w: %s", a.Provider.Name, err, strings.TrimSpace(stderr.String()))
+	}
+
+	response := &credentialProviderResponse{}
+	if err := json.Unmarshal(stdout.Bytes(), response); err != nil {
+		return nil, fmt.Errorf("decoding response of plugin %q: %w", a.Provider.Name, err)
+	}
+	if response.Kind != "CredentialProviderResponse" || response.APIVersion != apiVersion {
+		return nil, fmt.Errorf("unexpected response of plugin %q: %s, %s", a.Provider.Name, response.APIVersion, response.Kind)
+	}
+
+	result := &Result{Auths: map[string]string{}}
+	for host, auth := range response.Auth {
+		registry, ok := a.getRegistry(host)
+		if !ok {
+			log.Info("Ignoring credentials of the plugin for other registries", "plugin", a.Provider.Name, "host", host)
+			continue
+		}
+		result.Auths[registry] = base64.StdEncoding.EncodeToString([]byte(auth.Username + ":" + auth.Password))
+	}
+	if len(result.Auths) == 0 {
+		return nil, fmt.Errorf("plugin %q didn't return credentials for %q", a.Provider.Name, a.Provider.Registry)
+	}
+	if response.CacheDuration != nil && response.CacheDuration.Duration > 0 {
+		expiresAt := time.Now().Add(response.CacheDuration.Duration)
+		result.ExpiresAt = &expiresAt
+	}
+
+	return result, nil
+}
+
+// getRegistry returns the registry of the Secret for a host of the response.
+// Hosts can contain wildcards, like *.dkr.ecr.*.amazonaws.com, which aren't
+// supported by the Docker config, so they are replaced by the requested
+// registry when it matches.
+func (a *execAuthenticator) getRegistry(host string) (string, bool) {
+	if !strings.Contains(host, "*") {
+		return host, true
+	}
+
+	return a.Provider.Registry, matchHost(host, a.Provider.Registry)
+}
+
+// matchHost matches a host against a pattern with wildcards in its domain
+// segments, like the kubelet does for the keys of the auth map.
+func matchHost(pattern, host string) bool {
+	patternSegments := strings.Split(pattern, ".")
+	hostSegments := strings.Split(host, ".")
+	if len(patternSegments) != len(hostSegments) {
+		return false
+	}
+	for i := range patternSegments {
+		if ok, err := path.Match(patternSegments[i], hostSegments[i]); err != nil || !ok {
+			return false
+		}
+	}
+
+	return true
+}
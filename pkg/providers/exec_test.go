@@ -0,0 +1,209 @@
+package providers
+
+import (
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/astrokube/registry-controller/api/v1alpha1"
+)
+
+var _ = Describe("Exec provider", func() {
+	var pluginDir string
+
+	writePlugin := func(name, script string) {
+		Expect(ioutil.WriteFile(filepath.Join(pluginDir, name), []byte("#!/bin/sh\n"+script), 0755)).To(Succeed())
+	}
+
+	getToken := func(ctx context.Context, provider *v1alpha1.ExecProvider) (*Result, error) {
+		return NewExecAuthenticator(pluginDir, ExecPlugins[provider.Name], provider).GetToken(ctx, log.Log, &v1alpha1.RegistryCredentials{})
+	}
+
+	BeforeEach(func() {
+		var err error
+		pluginDir, err = ioutil.TempDir("", "plugins")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(pluginDir)
+		ExecPlugins = map[string]*ExecPlugin{}
+	})
+
+	Context("When the plugin returns credentials", func() {
+		It("Should send the registry and parse the auth map and cache duration", func() {
+			Expect(ExecPluginAllowedEnvFlag().Set("plugin:PASSWORD")).To(Succeed())
+			writePlugin("plugin", `
+read -r request
+case "$request" in
+  *'"kind":"CredentialProviderRequest"'*'"image":"123456789012.dkr.ecr.eu-west-1.amazonaws.com"'*) ;;
+  *) echo "unexpected request $request" >&2; exit 1 ;;
+esac
+cat <<EOF
+{"apiVersion":"credentialprovider.kubelet.k8s.io/v1","kind":"CredentialProviderResponse","cacheKeyType":"Registry","cacheDuration":"6h","auth":{"*.dkr.ecr.*.amazonaws.com":{"username":"AWS","password":"$PASSWORD"},"*.dkr.ecr.*.amazonaws.com.cn":{"username":"AWS","password":"other"}}}
+EOF
+`)
+			result, err := getToken(context.Background(), &v1alpha1.ExecProvider{
+				Name:     "plugin",
+				Registry: "123456789012.dkr.ecr.eu-west-1.amazonaws.com",
+				Env:      []v1alpha1.ExecEnvVar{{Name: "PASSWORD", Value: "secret"}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Auths).To(Equal(map[string]string{
+				"123456789012.dkr.ecr.eu-west-1.amazonaws.com": "QVdTOnNlY3JldA==",
+			}))
+			Expect(result.ExpiresAt).NotTo(BeNil())
+			Expect(*result.ExpiresAt).To(BeTemporally("~", time.Now().Add(6*time.Hour), time.Minute))
+
+			dockerConfig, err := result.DockerConfigJSON()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(dockerConfig)).To(Equal(`{"auths":{"123456789012.dkr.ecr.eu-west-1.amazonaws.com":{"auth":"QVdTOnNlY3JldA=="}}}`))
+		})
+
+		It("Should fail when the response has another API version", func() {
+			writePlugin("plugin", `echo '{"apiVersion":"credentialprovider.kubelet.k8s.io/v1alpha1","kind":"CredentialProviderResponse","auth":{"registry.example.com":{"username":"user","password":"pass"}}}'`)
+			_, err := getToken(context.Background(), &v1alpha1.ExecProvider{Name: "plugin", Registry: "registry.example.com"})
+			Expect(err).To(MatchError(ContainSubstring("unexpected response")))
+		})
+	})
+
+	Context("When the plugin is run", func() {
+		It("Should only pass the variables configured by the operator and the allowed ones", func() {
+			Expect(os.Setenv("OPERATOR_SECRET", "secret")).To(Succeed())
+			defer os.Unsetenv("OPERATOR_SECRET")
+			Expect(ExecPluginEnvFlag().Set("plugin:AWS_CONFIG_FILE=/etc/aws/config")).To(Succeed())
+			Expect(ExecPluginAllowedEnvFlag().Set("plugin:AWS_REGION")).To(Succeed())
+			writePlugin("plugin", `
+cat <<EOF
+{"apiVersion":"credentialprovider.kubelet.k8s.io/v1","kind":"CredentialProviderResponse","auth":{"registry.example.com":{"username":"$AWS_CONFIG_FILE:$AWS_REGION","password":"$OPERATOR_SECRET"}}}
+EOF
+`)
+			result, err := getToken(context.Background(), &v1alpha1.ExecProvider{
+				Name:     "plugin",
+				Registry: "registry.example.com",
+				Env:      []v1alpha1.ExecEnvVar{{Name: "AWS_REGION", Value: "eu-west-1"}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Auths).To(Equal(map[string]string{
+				"registry.example.com": base64.StdEncoding.EncodeToString([]byte("/etc/aws/config:eu-west-1:")),
+			}))
+		})
+
+		It("Should not run the plugin with variables that aren't allowed", func() {
+			writePlugin("plugin", `echo "unexpected run" >&2; exit 1`)
+			_, err := getToken(context.Background(), &v1alpha1.ExecProvider{
+				Name:     "plugin",
+				Registry: "registry.example.com",
+				Env:      []v1alpha1.ExecEnvVar{{Name: "AWS_CONFIG_FILE", Value: "/tmp/config"}},
+			})
+			Expect(err).To(MatchError(ContainSubstring(`env "AWS_CONFIG_FILE" isn't allowed for the plugin "plugin"`)))
+		})
+
+		It("Should only pass the arguments allowed by the operator", func() {
+			Expect(ExecPluginAllowedArgsFlag().Set("plugin:--region=")).To(Succeed())
+			writePlugin("plugin", `
+cat <<EOF
+{"apiVersion":"credentialprovider.kubelet.k8s.io/v1","kind":"CredentialProviderResponse","auth":{"registry.example.com":{"username":"user","password":"$1"}}}
+EOF
+`)
+			result, err := getToken(context.Background(), &v1alpha1.ExecProvider{
+				Name:     "plugin",
+				Registry: "registry.example.com",
+				Args:     []string{"--region=eu-west-1"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Auths).To(Equal(map[string]string{
+				"registry.example.com": base64.StdEncoding.EncodeToString([]byte("user:--region=eu-west-1")),
+			}))
+
+			_, err = getToken(context.Background(), &v1alpha1.ExecProvider{
+				Name:     "plugin",
+				Registry: "registry.example.com",
+				Args:     []string{"--config=/tmp/config"},
+			})
+			Expect(err).To(MatchError(ContainSubstring(`arg "--config=/tmp/config" isn't allowed for the plugin "plugin"`)))
+		})
+	})
+
+	Context("When the plugin fails", func() {
+		It("Should return the error output of the plugin", func() {
+			writePlugin("plugin", `echo "no credentials" >&2; exit 1`)
+			_, err := getToken(context.Background(), &v1alpha1.ExecProvider{Name: "plugin", Registry: "registry.example.com"})
+			Expect(err).To(MatchError(ContainSubstring("no credentials")))
+			Expect(GetState(err)).To(Equal(v1alpha1.RegistryCredentialsErrored))
+		})
+
+		It("Should return a TimeoutError when the context is done", func() {
+			writePlugin("plugin", `exec sleep 10`)
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			_, err := getToken(ctx, &v1alpha1.ExecProvider{Name: "plugin", Registry: "registry.example.com"})
+			Expect(IsTimeout(err)).To(BeTrue())
+		})
+	})
+
+	Context("When validating the provider", func() {
+		It("Should only accept plugins in the plugin directory", func() {
+			newRegistryCredentials := func(name string) *v1alpha1.RegistryCredentials {
+				return &v1alpha1.RegistryCredentials{Spec: v1alpha1.RegistryCredentialsSpec{
+					Provider: v1alpha1.RegistryProvider{Exec: &v1alpha1.ExecProvider{Name: name, Registry: "registry.example.com"}},
+				}}
+			}
+			Expect(Validate(newRegistryCredentials("ecr-credential-provider"))).To(Succeed())
+			Expect(Validate(newRegistryCredentials("/bin/sh"))).NotTo(Succeed())
+			Expect(Validate(newRegistryCredentials("../bin/sh"))).NotTo(Succeed())
+			Expect(Validate(newRegistryCredentials(".."))).NotTo(Succeed())
+		})
+
+		It("Should only accept the variables allowed by the operator", func() {
+			Expect(ExecPluginAllowedEnvFlag().Set("ecr-credential-provider:AWS_REGION,AWS_PROFILE")).To(Succeed())
+			newRegistryCredentials := func(name string) *v1alpha1.RegistryCredentials {
+				return &v1alpha1.RegistryCredentials{Spec: v1alpha1.RegistryCredentialsSpec{
+					Provider: v1alpha1.RegistryProvider{Exec: &v1alpha1.ExecProvider{
+						Name:     "ecr-credential-provider",
+						Registry: "registry.example.com",
+						Env:      []v1alpha1.ExecEnvVar{{Name: name, Value: "value"}},
+					}},
+				}}
+			}
+			Expect(Validate(newRegistryCredentials("AWS_REGION"))).To(Succeed())
+			Expect(Validate(newRegistryCredentials("AWS_CONFIG_FILE"))).To(MatchError(ContainSubstring("isn't allowed")))
+			Expect(Validate(newRegistryCredentials("LD_PRELOAD"))).To(MatchError(ContainSubstring("can't be set")))
+			Expect(Validate(newRegistryCredentials("https_proxy"))).To(MatchError(ContainSubstring("can't be set")))
+			Expect(Validate(newRegistryCredentials("PATH"))).To(MatchError(ContainSubstring("can't be set")))
+		})
+
+		It("Should only accept the arguments allowed by the operator", func() {
+			Expect(ExecPluginAllowedArgsFlag().Set("ecr-credential-provider:--v=2,--region=")).To(Succeed())
+			newRegistryCredentials := func(args ...string) *v1alpha1.RegistryCredentials {
+				return &v1alpha1.RegistryCredentials{Spec: v1alpha1.RegistryCredentialsSpec{
+					Provider: v1alpha1.RegistryProvider{Exec: &v1alpha1.ExecProvider{
+						Name:     "ecr-credential-provider",
+						Registry: "registry.example.com",
+						Args:     args,
+					}},
+				}}
+			}
+			Expect(Validate(newRegistryCredentials("--v=2", "--region=eu-west-1"))).To(Succeed())
+			Expect(Validate(newRegistryCredentials("--v=4"))).To(MatchError(ContainSubstring(`arg "--v=4" isn't allowed`)))
+			Expect(Validate(newRegistryCredentials("--region"))).To(MatchError(ContainSubstring("isn't allowed")))
+			Expect(Validate(newRegistryCredentials("--config=/tmp/config"))).To(MatchError(ContainSubstring("isn't allowed")))
+			Expect(ExecPluginAllowedArgsFlag().Set("plugin:")).NotTo(Succeed())
+			Expect(ExecPluginAllowedArgsFlag().Set("plugin:--v=2,,--region=")).NotTo(Succeed())
+		})
+
+		It("Should not let the operator allow loader and proxy variables", func() {
+			Expect(ExecPluginAllowedEnvFlag().Set("plugin:LD_PRELOAD")).NotTo(Succeed())
+			Expect(ExecPluginAllowedEnvFlag().Set("plugin:HTTPS_PROXY")).NotTo(Succeed())
+			Expect(ExecPluginEnvFlag().Set("plugin:AWS_REGION")).NotTo(Succeed())
+			Expect(ExecPluginEnvFlag().Set("AWS_REGION=eu-west-1")).NotTo(Succeed())
+		})
+	})
+})
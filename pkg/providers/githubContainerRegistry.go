@@ -0,0 +1,179 @@
+package providers
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/astrokube/registry-controller/api/v1alpha1"
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	defaultGitHubAPIURL   = "https://api.github.com"
+	defaultGitHubRegistry = "ghcr.io"
+)
+
+func init() {
+	Register(Provider{
+		Name:        "githubContainerRegistry",
+		DisplayName: "GitHub Container Registry",
+		Factory: func(reader client.Reader, registryCredentials *v1alpha1.RegistryCredentials) (Authenticator, error) {
+			return NewGitHubContainerRegistryAuthenticator(reader, registryCredentials.Spec.Provider.GitHubContainerRegistry), nil
+		},
+		Validator: validateGitHubContainerRegistry,
+	})
+}
+
+func validateGitHubContainerRegistry(registryCredentials *v1alpha1.RegistryCredentials) error {
+	provider := registryCredentials.Spec.Provider.GitHubContainerRegistry
+	if provider.AppID <= 0 || provider.InstallationID <= 0 {
+		return errors.New("appId and installationId are required")
+	}
+	if provider.PrivateKeySecretRef.Name == "" || provider.PrivateKeySecretRef.Key == "" {
+		return errors.New("privateKeySecretRef is required")
+	}
+	if provider.APIURL != "" {
+		if err := checkURL("apiUrl", provider.APIURL); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// gitHubInstallationToken is the installation access token returned by GitHub
+type gitHubInstallationToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func NewGitHubContainerRegistryAuthenticator(reader client.Reader, provider *v1alpha1.GitHubContainerRegistry) Authenticator {
+	return &gitHubContainerRegistryAuthenticator{
+		Reader:   reader,
+		Provider: provider,
+	}
+}
+
+type gitHubContainerRegistryAuthenticator struct {
+	Reader   client.Reader
+	Provider *v1alpha1.GitHubContainerRegistry
+}
+
+func (a *gitHubContainerRegistryAuthenticator) GetToken(ctx context.Context, log logr.Logger, registryCredentials *v1alpha1.RegistryCredentials) (*Result, error) {
+	privateKeyPEM, err := getSecretKey(ctx, a.Reader, registryCredentials.Namespace, &a.Provider.PrivateKeySecretRef)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, err := parseRSAPrivateKey(privateKeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("loading the private key of the GitHub App: %w", err)
+	}
+	jwt, err := newGitHubAppJWT(privateKey, a.Provider.AppID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient, err := newHTTPClient(a.Provider.CABundle)
+	if err != nil {
+		return nil, err
+	}
+	defer httpClient.CloseIdleConnections()
+
+	apiURL := a.Provider.APIURL
+	if apiURL == "" {
+		apiURL = defaultGitHubAPIURL
+	} else if err := checkURL("apiUrl", apiURL); err != nil {
+		return nil, err
+	}
+	req, err := newJSONRequest(ctx, http.MethodPost, fmt.Sprintf("%s/app/installations/%d/access_tokens", strings.TrimRight(apiURL, "/"), a.Provider.InstallationID), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	req.Header.Set("Authorization", "Bearer "+jwt)
+
+	token := &gitHubInstallationToken{}
+	if err := doJSON(ctx, httpClient, req, token); err != nil {
+		log.Info("Unable to create installation access token", "appId", a.Provider.AppID, "installationId", a.Provider.InstallationID)
+		return nil, err
+	}
+	if token.Token == "" {
+		return nil, errors.New("GitHub didn't return an installation access token")
+	}
+
+	registry := a.Provider.Registry
+	if registry == "" {
+		registry = defaultGitHubRegistry
+	}
+	result := &Result{
+		Registry: registry,
+		Token:    base64.StdEncoding.EncodeToString([]byte("x-access-token:" + token.Token)),
+	}
+	if !token.ExpiresAt.IsZero() {
+		result.ExpiresAt = &token.ExpiresAt
+	}
+
+	return result, nil
+}
+
+// newGitHubAppJWT returns the JWT, signed with RS256, that authenticates as the
+// GitHub App. It is backdated to allow for clock drift, and GitHub rejects
+// JWTs valid for more than 10 minutes.
+func newGitHubAppJWT(privateKey *rsa.PrivateKey, appID int64, now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": strconv.FormatInt(appID, 10),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// parseRSAPrivateKey parses a PEM encoded PKCS #1 or PKCS #8 RSA private key
+func parseRSAPrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM encoded key found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("the key isn't an RSA key")
+	}
+
+	return rsaKey, nil
+}
@@ -0,0 +1,134 @@
+package providers
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/astrokube/registry-controller/api/v1alpha1"
+)
+
+// verifyGitHubAppJWT checks the signature of the JWT and returns its claims
+func verifyGitHubAppJWT(publicKey *rsa.PublicKey, jwt string) (map[string]interface{}, error) {
+	parts := strings.Split(jwt, ".")
+	Expect(parts).To(HaveLen(3))
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	Expect(err).NotTo(HaveOccurred())
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, err
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	Expect(err).NotTo(HaveOccurred())
+	claims := map[string]interface{}{}
+	Expect(json.Unmarshal(payload, &claims)).To(Succeed())
+
+	return claims, nil
+}
+
+var _ = Describe("GitHub Container Registry provider", func() {
+	var (
+		server     *httptest.Server
+		privateKey *rsa.PrivateKey
+		expiresAt  time.Time
+	)
+
+	registryCredentials := &v1alpha1.RegistryCredentials{
+		ObjectMeta: metav1.ObjectMeta{Name: "sample", Namespace: "default"},
+	}
+
+	BeforeEach(func() {
+		var err error
+		privateKey, err = rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).NotTo(HaveOccurred())
+		expiresAt = time.Now().Add(time.Hour).Truncate(time.Second).UTC()
+
+		server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost || r.URL.Path != "/api/v3/app/installations/42/access_tokens" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			claims, err := verifyGitHubAppJWT(&privateKey.PublicKey, strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+			if err != nil || claims["iss"] != "1234" {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"message":"A JSON web token could not be decoded"}`))
+				return
+			}
+			Expect(claims["exp"].(float64) - claims["iat"].(float64)).To(BeNumerically("<=", 600))
+
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(gitHubInstallationToken{Token: "ghs_token", ExpiresAt: expiresAt})
+		}))
+		AllowedURLs = []string{server.URL}
+	})
+
+	AfterEach(func() {
+		server.Close()
+		AllowedURLs = nil
+	})
+
+	getToken := func(key []byte) (*Result, error) {
+		reader := fake.NewClientBuilder().WithObjects(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "github-app", Namespace: "default"},
+			Data:       map[string][]byte{"private-key.pem": key},
+		}).Build()
+
+		return NewGitHubContainerRegistryAuthenticator(reader, &v1alpha1.GitHubContainerRegistry{
+			AppID:               1234,
+			InstallationID:      42,
+			PrivateKeySecretRef: corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "github-app"}, Key: "private-key.pem"},
+			APIURL:              server.URL + "/api/v3/",
+			CABundle:            certificatePEM(server.Certificate()),
+		}).GetToken(context.Background(), log.Log, registryCredentials)
+	}
+
+	Context("When the GitHub App is installed", func() {
+		It("Should exchange the JWT for an installation access token", func() {
+			result, err := getToken(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)}))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Registry).To(Equal("ghcr.io"))
+			Expect(result.Token).To(Equal(base64.StdEncoding.EncodeToString([]byte("x-access-token:ghs_token"))))
+			Expect(result.ExpiresAt).NotTo(BeNil())
+			Expect(result.ExpiresAt.Equal(expiresAt)).To(BeTrue())
+		})
+
+		It("Should accept PKCS #8 private keys", func() {
+			key, err := x509.MarshalPKCS8PrivateKey(privateKey)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = getToken(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}))
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("When the private key doesn't belong to the GitHub App", func() {
+		It("Should return an UnauthorizedError", func() {
+			otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = getToken(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(otherKey)}))
+			Expect(IsUnauthorized(err)).To(BeTrue())
+		})
+
+		It("Should fail when the key isn't PEM encoded", func() {
+			_, err := getToken([]byte("invalid"))
+			Expect(err).To(MatchError(ContainSubstring("no PEM encoded key found")))
+		})
+	})
+})
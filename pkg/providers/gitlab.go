@@ -0,0 +1,274 @@
+package providers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/astrokube/registry-controller/api/v1alpha1"
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// GitLabDeployTokenIDAnnotation is the ID of the deploy token stored in the
+	// Secret
+	GitLabDeployTokenIDAnnotation = "registry.astrokube.com/gitlab-deploy-token-id"
+	// GitLabOwnerAnnotation is the project or group of the deploy token stored
+	// in the Secret, like projects/42
+	GitLabOwnerAnnotation = "registry.astrokube.com/gitlab-owner"
+	// GitLabRotateAtAnnotation is when the deploy token stored in the Secret
+	// must be rotated
+	GitLabRotateAtAnnotation = "registry.astrokube.com/gitlab-rotate-at"
+	// GitLabExpiresAtAnnotation is when the deploy token stored in the Secret
+	// expires
+	GitLabExpiresAtAnnotation = "registry.astrokube.com/gitlab-expires-at"
+
+	defaultGitLabAPIURL       = "https://gitlab.com/api/v4"
+	defaultGitLabRegistry     = "registry.gitlab.com"
+	defaultGitLabDurationDays = 30
+)
+
+var gitLabRotationAnnotations = rotationAnnotations{
+	ID:        GitLabDeployTokenIDAnnotation,
+	RotateAt:  GitLabRotateAtAnnotation,
+	ExpiresAt: GitLabExpiresAtAnnotation,
+}
+
+func init() {
+	Register(Provider{
+		Name:        "gitlab",
+		DisplayName: "GitLab",
+		Factory: func(reader client.Reader, registryCredentials *v1alpha1.RegistryCredentials) (Authenticator, error) {
+			return NewGitLabAuthenticator(reader, registryCredentials.Spec.Provider.GitLab), nil
+		},
+		Validator: validateGitLab,
+	})
+}
+
+func validateGitLab(registryCredentials *v1alpha1.RegistryCredentials) error {
+	provider := registryCredentials.Spec.Provider.GitLab
+	if provider.APIURL != "" {
+		if err := checkURL("apiUrl", provider.APIURL); err != nil {
+			return err
+		}
+	}
+
+	if provider.DeployTokenSecretRef != nil {
+		if provider.Project != "" || provider.Group != "" || provider.AccessTokenSecretRef != nil {
+			return errors.New("deployTokenSecretRef can't be set with project, group or accessTokenSecretRef")
+		}
+		return nil
+	}
+
+	if (provider.Project == "") == (provider.Group == "") {
+		return errors.New("either deployTokenSecretRef, project or group must be set")
+	}
+	if provider.AccessTokenSecretRef == nil {
+		return errors.New("accessTokenSecretRef is required to create deploy tokens")
+	}
+	if provider.RotationInterval != nil {
+		duration := time.Duration(gitLabDurationDays(provider)) * 24 * time.Hour
+		if provider.RotationInterval.Duration <= 0 || provider.RotationInterval.Duration >= duration {
+			return fmt.Errorf("rotationInterval must be positive and shorter than the lifetime of the deploy tokens, %v", duration)
+		}
+	}
+
+	return nil
+}
+
+func gitLabDurationDays(provider *v1alpha1.GitLabProvider) int32 {
+	if provider.DurationDays > 0 {
+		return provider.DurationDays
+	}
+
+	return defaultGitLabDurationDays
+}
+
+// gitLabDeployTokenRequest is the body of the creation of a deploy token
+type gitLabDeployTokenRequest struct {
+	Name      string    `json:"name"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Scopes    []string  `json:"scopes"`
+}
+
+// gitLabDeployToken is the deploy token created by GitLab
+type gitLabDeployToken struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	Token    string `json:"token"`
+}
+
+// NewGitLabAuthenticator returns the Authenticator of the static deploy token
+// of the Secret, or the one creating deploy tokens, which revokes them
+func NewGitLabAuthenticator(reader client.Reader, provider *v1alpha1.GitLabProvider) Authenticator {
+	if provider.DeployTokenSecretRef != nil {
+		return &gitLabStaticAuthenticator{
+			Reader:   reader,
+			Provider: provider,
+		}
+	}
+
+	return &gitLabAuthenticator{
+		Reader:   reader,
+		Provider: provider,
+	}
+}
+
+// gitLabStaticAuthenticator reads a static deploy token, which is never
+// revoked
+type gitLabStaticAuthenticator struct {
+	Reader   client.Reader
+	Provider *v1alpha1.GitLabProvider
+}
+
+func (a *gitLabStaticAuthenticator) GetToken(ctx context.Context, log logr.Logger, registryCredentials *v1alpha1.RegistryCredentials) (*Result, error) {
+	secret, err := getSecret(ctx, a.Reader, registryCredentials.Namespace, a.Provider.DeployTokenSecretRef.Name)
+	if err != nil {
+		return nil, err
+	}
+	username, token := secret.Data["username"], secret.Data["token"]
+	if len(username) == 0 || len(token) == 0 {
+		return nil, fmt.Errorf("the Secret %q must have the username and token keys", secret.Name)
+	}
+
+	return &Result{
+		Registry: gitLabRegistry(a.Provider),
+		Token:    base64.StdEncoding.EncodeToString([]byte(string(username) + ":" + string(token))),
+	}, nil
+}
+
+// gitLabAuthenticator creates deploy tokens with the access token of the
+// Secret
+type gitLabAuthenticator struct {
+	Reader   client.Reader
+	Provider *v1alpha1.GitLabProvider
+}
+
+func (a *gitLabAuthenticator) GetToken(ctx context.Context, log logr.Logger, registryCredentials *v1alpha1.RegistryCredentials) (*Result, error) {
+	registry := gitLabRegistry(a.Provider)
+
+	// Keep the current deploy token until it must be rotated
+	identity := map[string]string{GitLabOwnerAnnotation: a.getOwner()}
+	current, err := getCurrentCredentials(ctx, a.Reader, registryCredentials, registry, gitLabRotationAnnotations, identity)
+	if err != nil {
+		return nil, err
+	}
+	if current != nil {
+		log.Info("Deploy token is not due for rotation", "id", current.Annotations[GitLabDeployTokenIDAnnotation])
+		return current, nil
+	}
+
+	httpClient, err := newHTTPClient(a.Provider.CABundle)
+	if err != nil {
+		return nil, err
+	}
+	defer httpClient.CloseIdleConnections()
+
+	now := time.Now()
+	duration := time.Duration(gitLabDurationDays(a.Provider)) * 24 * time.Hour
+	expiresAt := now.Add(duration).UTC().Truncate(time.Second)
+	req, err := a.newRequest(ctx, registryCredentials.Namespace, http.MethodPost, "deploy_tokens", gitLabDeployTokenRequest{
+		Name:      fmt.Sprintf("registry-controller-%s-%s-%d", registryCredentials.Namespace, registryCredentials.Name, now.Unix()),
+		ExpiresAt: expiresAt,
+		Scopes:    []string{"read_registry"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	deployToken := &gitLabDeployToken{}
+	if err := doJSON(ctx, httpClient, req, deployToken); err != nil {
+		log.Info("Unable to create deploy token", "owner", a.getOwner())
+		return nil, err
+	}
+	log.Info("Created deploy token", "id", deployToken.ID, "owner", a.getOwner())
+
+	rotateAt := now.Add(getRotationInterval(duration, a.Provider.RotationInterval))
+
+	return &Result{
+		Registry:    registry,
+		Token:       base64.StdEncoding.EncodeToString([]byte(deployToken.Username + ":" + deployToken.Token)),
+		ExpiresAt:   &expiresAt,
+		Annotations: gitLabRotationAnnotations.annotations(strconv.FormatInt(deployToken.ID, 10), rotateAt, expiresAt, identity),
+	}, nil
+}
+
+// Revoke deletes the deploy token created by the operator
+func (a *gitLabAuthenticator) Revoke(ctx context.Context, log logr.Logger, registryCredentials *v1alpha1.RegistryCredentials, annotations map[string]string) error {
+	id := annotations[GitLabDeployTokenIDAnnotation]
+	owner := annotations[GitLabOwnerAnnotation]
+	if id == "" || owner == "" {
+		return nil
+	}
+
+	httpClient, err := newHTTPClient(a.Provider.CABundle)
+	if err != nil {
+		return err
+	}
+	defer httpClient.CloseIdleConnections()
+
+	req, err := a.newRequestForOwner(ctx, registryCredentials.Namespace, owner, http.MethodDelete, "deploy_tokens/"+url.PathEscape(id), nil)
+	if err != nil {
+		return missingCredentials(err)
+	}
+	if err := doDelete(ctx, httpClient, req); err != nil {
+		return err
+	}
+	log.Info("Deleted deploy token", "id", id, "owner", owner)
+
+	return nil
+}
+
+func gitLabRegistry(provider *v1alpha1.GitLabProvider) string {
+	if provider.Registry != "" {
+		return provider.Registry
+	}
+
+	return defaultGitLabRegistry
+}
+
+// getOwner returns the path of the project or group in the API, like
+// projects/group%2Fproject
+func (a *gitLabAuthenticator) getOwner() string {
+	if a.Provider.Project != "" {
+		return "projects/" + url.PathEscape(a.Provider.Project)
+	}
+
+	return "groups/" + url.PathEscape(a.Provider.Group)
+}
+
+func (a *gitLabAuthenticator) newRequest(ctx context.Context, namespace, method, path string, body interface{}) (*http.Request, error) {
+	return a.newRequestForOwner(ctx, namespace, a.getOwner(), method, path, body)
+}
+
+// newRequestForOwner returns a request to the GitLab API for a resource of the
+// project or group, authenticated with the access token of the Secret
+func (a *gitLabAuthenticator) newRequestForOwner(ctx context.Context, namespace, owner, method, path string, body interface{}) (*http.Request, error) {
+	if a.Provider.AccessTokenSecretRef == nil {
+		return nil, &MissingCredentialsError{Err: errors.New("accessTokenSecretRef is required to manage deploy tokens")}
+	}
+	token, err := getSecretKey(ctx, a.Reader, namespace, a.Provider.AccessTokenSecretRef)
+	if err != nil {
+		return nil, err
+	}
+
+	apiURL := a.Provider.APIURL
+	if apiURL == "" {
+		apiURL = defaultGitLabAPIURL
+	} else if err := checkURL("apiUrl", apiURL); err != nil {
+		return nil, err
+	}
+	req, err := newJSONRequest(ctx, method, strings.TrimRight(apiURL, "/")+"/"+owner+"/"+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("PRIVATE-TOKEN", strings.TrimSpace(string(token)))
+
+	return req, nil
+}
@@ -0,0 +1,280 @@
+package providers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/astrokube/registry-controller/api/v1alpha1"
+)
+
+// fakeGitLab implements the deploy tokens of the GitLab v4 API
+type fakeGitLab struct {
+	mu      sync.Mutex
+	paths   []string
+	created []gitLabDeployTokenRequest
+	deleted []string
+}
+
+func (g *fakeGitLab) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if r.Header.Get("PRIVATE-TOKEN") != "glpat-maintainer" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"message":"401 Unauthorized"}`))
+		return
+	}
+
+	path := r.URL.EscapedPath()
+	g.paths = append(g.paths, path)
+	switch {
+	case r.Method == http.MethodPost && strings.HasSuffix(path, "/deploy_tokens"):
+		request := gitLabDeployTokenRequest{}
+		Expect(json.NewDecoder(r.Body).Decode(&request)).To(Succeed())
+		g.created = append(g.created, request)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(gitLabDeployToken{
+			ID:       int64(len(g.created)),
+			Username: "gitlab+deploy-token-1",
+			Token:    "deploy-token",
+		})
+	case r.Method == http.MethodDelete && strings.Contains(path, "/deploy_tokens/"):
+		if strings.HasSuffix(path, "/404") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		g.deleted = append(g.deleted, path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+var _ = Describe("GitLab provider", func() {
+	var (
+		gitlab *fakeGitLab
+		server *httptest.Server
+	)
+
+	registryCredentials := &v1alpha1.RegistryCredentials{
+		ObjectMeta: metav1.ObjectMeta{Name: "sample", Namespace: "team"},
+	}
+
+	accessTokenSecret := func(token string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "gitlab-maintainer", Namespace: "team"},
+			Data:       map[string][]byte{"token": []byte(token)},
+		}
+	}
+
+	pullSecret := func(annotations map[string]string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "sample", Namespace: "team", Annotations: annotations},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data: map[string][]byte{
+				corev1.DockerConfigJsonKey: []byte(`{"auths":{"registry.gitlab.com":{"auth":"Y3VycmVudA=="}}}`),
+			},
+		}
+	}
+
+	newProvider := func() *v1alpha1.GitLabProvider {
+		return &v1alpha1.GitLabProvider{
+			APIURL:               server.URL + "/api/v4",
+			CABundle:             certificatePEM(server.Certificate()),
+			Project:              "group/project",
+			AccessTokenSecretRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "gitlab-maintainer"}, Key: "token"},
+			DurationDays:         10,
+		}
+	}
+
+	newAuthenticator := func(provider *v1alpha1.GitLabProvider, objects ...client.Object) Authenticator {
+		return NewGitLabAuthenticator(fake.NewClientBuilder().WithObjects(objects...).Build(), provider)
+	}
+
+	BeforeEach(func() {
+		gitlab = &fakeGitLab{}
+		server = httptest.NewTLSServer(gitlab)
+		AllowedURLs = []string{server.URL}
+	})
+
+	AfterEach(func() {
+		server.Close()
+		AllowedURLs = nil
+	})
+
+	Context("When using a static deploy token", func() {
+		It("Should return the deploy token of the Secret", func() {
+			provider := &v1alpha1.GitLabProvider{
+				Registry:             "registry.example.com",
+				DeployTokenSecretRef: &corev1.LocalObjectReference{Name: "deploy-token"},
+			}
+			result, err := newAuthenticator(provider, &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "deploy-token", Namespace: "team"},
+				Data:       map[string][]byte{"username": []byte("gitlab+deploy-token-9"), "token": []byte("static")},
+			}).GetToken(context.Background(), log.Log, registryCredentials)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Registry).To(Equal("registry.example.com"))
+			Expect(result.Token).To(Equal(base64.StdEncoding.EncodeToString([]byte("gitlab+deploy-token-9:static"))))
+			Expect(result.ExpiresAt).To(BeNil())
+			Expect(result.Annotations).To(BeEmpty())
+			Expect(gitlab.paths).To(BeEmpty())
+		})
+
+		It("Should not revoke the deploy token", func() {
+			_, ok := newAuthenticator(&v1alpha1.GitLabProvider{
+				DeployTokenSecretRef: &corev1.LocalObjectReference{Name: "deploy-token"},
+			}).(Revoker)
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Context("When there is no deploy token", func() {
+		It("Should create a deploy token with read_registry scope for the project", func() {
+			result, err := newAuthenticator(newProvider(), accessTokenSecret("glpat-maintainer")).GetToken(context.Background(), log.Log, registryCredentials)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(gitlab.paths).To(Equal([]string{"/api/v4/projects/group%2Fproject/deploy_tokens"}))
+			Expect(gitlab.created).To(HaveLen(1))
+			Expect(gitlab.created[0].Name).To(HavePrefix("registry-controller-team-sample-"))
+			Expect(gitlab.created[0].Scopes).To(Equal([]string{"read_registry"}))
+			Expect(gitlab.created[0].ExpiresAt).To(BeTemporally("~", time.Now().Add(10*24*time.Hour), time.Minute))
+
+			Expect(result.Registry).To(Equal("registry.gitlab.com"))
+			Expect(result.Token).To(Equal(base64.StdEncoding.EncodeToString([]byte("gitlab+deploy-token-1:deploy-token"))))
+			Expect(result.ExpiresAt).NotTo(BeNil())
+			Expect(result.Annotations).To(HaveKeyWithValue(GitLabDeployTokenIDAnnotation, "1"))
+			Expect(result.Annotations).To(HaveKeyWithValue(GitLabOwnerAnnotation, "projects/group%2Fproject"))
+			rotateAt, err := time.Parse(time.RFC3339, result.Annotations[GitLabRotateAtAnnotation])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rotateAt).To(BeTemporally("~", time.Now().Add(5*24*time.Hour), time.Minute))
+		})
+
+		It("Should create group deploy tokens", func() {
+			provider := newProvider()
+			provider.Project = ""
+			provider.Group = "42"
+			_, err := newAuthenticator(provider, accessTokenSecret("glpat-maintainer")).GetToken(context.Background(), log.Log, registryCredentials)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(gitlab.paths).To(Equal([]string{"/api/v4/groups/42/deploy_tokens"}))
+		})
+
+		It("Should return an UnauthorizedError when the access token is rejected", func() {
+			_, err := newAuthenticator(newProvider(), accessTokenSecret("invalid")).GetToken(context.Background(), log.Log, registryCredentials)
+			Expect(IsUnauthorized(err)).To(BeTrue())
+		})
+	})
+
+	Context("When there is a deploy token", func() {
+		annotations := func(owner string, rotateAt time.Time) map[string]string {
+			return map[string]string{
+				GitLabDeployTokenIDAnnotation: "7",
+				GitLabOwnerAnnotation:         owner,
+				GitLabRotateAtAnnotation:      rotateAt.UTC().Format(time.RFC3339),
+				GitLabExpiresAtAnnotation:     time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339),
+			}
+		}
+
+		It("Should keep it until it must be rotated", func() {
+			current := annotations("projects/group%2Fproject", time.Now().Add(time.Hour))
+			result, err := newAuthenticator(newProvider(), accessTokenSecret("glpat-maintainer"), pullSecret(current)).GetToken(context.Background(), log.Log, registryCredentials)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(gitlab.created).To(BeEmpty())
+			Expect(result.Token).To(Equal("Y3VycmVudA=="))
+			Expect(result.Annotations).To(Equal(current))
+		})
+
+		It("Should create a new one when it must be rotated", func() {
+			current := annotations("projects/group%2Fproject", time.Now().Add(-time.Minute))
+			_, err := newAuthenticator(newProvider(), accessTokenSecret("glpat-maintainer"), pullSecret(current)).GetToken(context.Background(), log.Log, registryCredentials)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(gitlab.created).To(HaveLen(1))
+		})
+
+		It("Should create a new one when it belongs to another project", func() {
+			current := annotations("projects/other", time.Now().Add(time.Hour))
+			_, err := newAuthenticator(newProvider(), accessTokenSecret("glpat-maintainer"), pullSecret(current)).GetToken(context.Background(), log.Log, registryCredentials)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(gitlab.created).To(HaveLen(1))
+		})
+
+		It("Should delete it from its project when revoked", func() {
+			revoker, ok := newAuthenticator(newProvider(), accessTokenSecret("glpat-maintainer")).(Revoker)
+			Expect(ok).To(BeTrue())
+
+			Expect(revoker.Revoke(context.Background(), log.Log, registryCredentials, annotations("projects/other", time.Now()))).To(Succeed())
+			Expect(revoker.Revoke(context.Background(), log.Log, registryCredentials, map[string]string{
+				GitLabDeployTokenIDAnnotation: "404",
+				GitLabOwnerAnnotation:         "projects/group%2Fproject",
+			})).To(Succeed())
+			Expect(revoker.Revoke(context.Background(), log.Log, registryCredentials, map[string]string{})).To(Succeed())
+			Expect(gitlab.deleted).To(Equal([]string{"/api/v4/projects/other/deploy_tokens/7"}))
+		})
+
+		It("Should return a MissingCredentialsError without the access token", func() {
+			revoker := newAuthenticator(newProvider()).(Revoker)
+
+			err := revoker.Revoke(context.Background(), log.Log, registryCredentials, annotations("projects/other", time.Now()))
+			Expect(IsMissingCredentials(err)).To(BeTrue())
+			Expect(gitlab.deleted).To(BeEmpty())
+		})
+	})
+
+	Context("When validating the provider", func() {
+		newRegistryCredentials := func(provider *v1alpha1.GitLabProvider) *v1alpha1.RegistryCredentials {
+			return &v1alpha1.RegistryCredentials{Spec: v1alpha1.RegistryCredentialsSpec{
+				Provider: v1alpha1.RegistryProvider{GitLab: provider},
+			}}
+		}
+		accessTokenSecretRef := &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "gitlab-maintainer"}, Key: "token"}
+
+		It("Should require either a static deploy token or a project or group", func() {
+			Expect(Validate(newRegistryCredentials(&v1alpha1.GitLabProvider{}))).NotTo(Succeed())
+			Expect(Validate(newRegistryCredentials(&v1alpha1.GitLabProvider{DeployTokenSecretRef: &corev1.LocalObjectReference{Name: "deploy-token"}}))).To(Succeed())
+			Expect(Validate(newRegistryCredentials(&v1alpha1.GitLabProvider{Project: "group/project", AccessTokenSecretRef: accessTokenSecretRef}))).To(Succeed())
+			Expect(Validate(newRegistryCredentials(&v1alpha1.GitLabProvider{Project: "group/project", Group: "group", AccessTokenSecretRef: accessTokenSecretRef}))).NotTo(Succeed())
+			Expect(Validate(newRegistryCredentials(&v1alpha1.GitLabProvider{Project: "group/project"}))).NotTo(Succeed())
+			Expect(Validate(newRegistryCredentials(&v1alpha1.GitLabProvider{
+				DeployTokenSecretRef: &corev1.LocalObjectReference{Name: "deploy-token"},
+				Project:              "group/project",
+			}))).NotTo(Succeed())
+		})
+
+		It("Should only accept HTTPS API URLs", func() {
+			AllowedURLs = []string{"https://gitlab.example.com"}
+			provider := &v1alpha1.GitLabProvider{
+				APIURL:               "https://gitlab.example.com/api/v4",
+				Project:              "group/project",
+				AccessTokenSecretRef: accessTokenSecretRef,
+			}
+			Expect(Validate(newRegistryCredentials(provider))).To(Succeed())
+			provider.APIURL = "http://gitlab.example.com/api/v4"
+			Expect(Validate(newRegistryCredentials(provider))).To(MatchError(ContainSubstring("HTTPS")))
+		})
+
+		It("Should reject rotation intervals longer than the lifetime of the deploy tokens", func() {
+			provider := &v1alpha1.GitLabProvider{
+				Group:                "group",
+				AccessTokenSecretRef: accessTokenSecretRef,
+				DurationDays:         1,
+				RotationInterval:     &metav1.Duration{Duration: 12 * time.Hour},
+			}
+			Expect(Validate(newRegistryCredentials(provider))).To(Succeed())
+			provider.RotationInterval.Duration = 48 * time.Hour
+			Expect(Validate(newRegistryCredentials(provider))).NotTo(Succeed())
+		})
+	})
+})
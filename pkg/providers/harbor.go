@@ -0,0 +1,241 @@
+package providers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/astrokube/registry-controller/api/v1alpha1"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// HarborRobotIDAnnotation is the ID of the robot account stored in the
+	// Secret
+	HarborRobotIDAnnotation = "registry.astrokube.com/harbor-robot-id"
+	// HarborProjectAnnotation is the project of the robot account stored in the
+	// Secret
+	HarborProjectAnnotation = "registry.astrokube.com/harbor-project"
+	// HarborRotateAtAnnotation is when the robot account stored in the Secret
+	// must be rotated
+	HarborRotateAtAnnotation = "registry.astrokube.com/harbor-rotate-at"
+	// HarborExpiresAtAnnotation is when the robot account stored in the Secret
+	// expires
+	HarborExpiresAtAnnotation = "registry.astrokube.com/harbor-expires-at"
+
+	defaultHarborDurationDays = 30
+)
+
+var harborRotationAnnotations = rotationAnnotations{
+	ID:        HarborRobotIDAnnotation,
+	RotateAt:  HarborRotateAtAnnotation,
+	ExpiresAt: HarborExpiresAtAnnotation,
+}
+
+func init() {
+	Register(Provider{
+		Name:        "harbor",
+		DisplayName: "Harbor",
+		Factory: func(reader client.Reader, registryCredentials *v1alpha1.RegistryCredentials) (Authenticator, error) {
+			return NewHarborAuthenticator(reader, registryCredentials.Spec.Provider.Harbor), nil
+		},
+		Validator: validateHarbor,
+	})
+}
+
+func validateHarbor(registryCredentials *v1alpha1.RegistryCredentials) error {
+	provider := registryCredentials.Spec.Provider.Harbor
+	if err := checkURL("url", provider.URL); err != nil {
+		return err
+	}
+	if provider.Project == "" {
+		return errors.New("project is required")
+	}
+	if provider.CredentialsSecretRef.Name == "" {
+		return errors.New("credentialsSecretRef is required")
+	}
+	if provider.RotationInterval != nil {
+		duration := time.Duration(harborDurationDays(provider)) * 24 * time.Hour
+		if provider.RotationInterval.Duration <= 0 || provider.RotationInterval.Duration >= duration {
+			return fmt.Errorf("rotationInterval must be positive and shorter than the lifetime of the robot accounts, %v", duration)
+		}
+	}
+
+	return nil
+}
+
+func harborDurationDays(provider *v1alpha1.HarborProvider) int32 {
+	if provider.DurationDays > 0 {
+		return provider.DurationDays
+	}
+
+	return defaultHarborDurationDays
+}
+
+// harborRobotRequest is the body of the creation of a robot account
+type harborRobotRequest struct {
+	Name        string                  `json:"name"`
+	Description string                  `json:"description"`
+	Duration    int32                   `json:"duration"`
+	Level       string                  `json:"level"`
+	Permissions []harborRobotPermission `json:"permissions"`
+}
+
+type harborRobotPermission struct {
+	Kind      string              `json:"kind"`
+	Namespace string              `json:"namespace"`
+	Access    []harborRobotAccess `json:"access"`
+}
+
+type harborRobotAccess struct {
+	Resource string `json:"resource"`
+	Action   string `json:"action"`
+}
+
+// harborRobot is the robot account created by Harbor
+type harborRobot struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	Secret    string `json:"secret"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+func NewHarborAuthenticator(reader client.Reader, provider *v1alpha1.HarborProvider) Authenticator {
+	return &harborAuthenticator{
+		Reader:   reader,
+		Provider: provider,
+	}
+}
+
+type harborAuthenticator struct {
+	Reader   client.Reader
+	Provider *v1alpha1.HarborProvider
+}
+
+func (a *harborAuthenticator) GetToken(ctx context.Context, log logr.Logger, registryCredentials *v1alpha1.RegistryCredentials) (*Result, error) {
+	registry, err := a.getRegistry()
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the current robot account until it must be rotated
+	identity := map[string]string{HarborProjectAnnotation: a.Provider.Project}
+	current, err := getCurrentCredentials(ctx, a.Reader, registryCredentials, registry, harborRotationAnnotations, identity)
+	if err != nil {
+		return nil, err
+	}
+	if current != nil {
+		log.Info("Robot account is not due for rotation", "id", current.Annotations[HarborRobotIDAnnotation])
+		return current, nil
+	}
+
+	httpClient, err := newHTTPClient(a.Provider.CABundle)
+	if err != nil {
+		return nil, err
+	}
+	defer httpClient.CloseIdleConnections()
+
+	now := time.Now()
+	durationDays := harborDurationDays(a.Provider)
+	req, err := a.newRequest(ctx, registryCredentials.Namespace, http.MethodPost, "robots", harborRobotRequest{
+		Name:        fmt.Sprintf("%s-%s-%d", registryCredentials.Namespace, registryCredentials.Name, now.Unix()),
+		Description: fmt.Sprintf("Pull access for RegistryCredentials %s/%s", registryCredentials.Namespace, registryCredentials.Name),
+		Duration:    durationDays,
+		Level:       "project",
+		Permissions: []harborRobotPermission{{
+			Kind:      "project",
+			Namespace: a.Provider.Project,
+			Access:    []harborRobotAccess{{Resource: "repository", Action: "pull"}},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	robot := &harborRobot{}
+	if err := doJSON(ctx, httpClient, req, robot); err != nil {
+		log.Info("Unable to create robot account", "project", a.Provider.Project)
+		return nil, err
+	}
+	log.Info("Created robot account", "id", robot.ID, "name", robot.Name)
+
+	duration := time.Duration(durationDays) * 24 * time.Hour
+	expiresAt := now.Add(duration)
+	if robot.ExpiresAt > 0 {
+		expiresAt = time.Unix(robot.ExpiresAt, 0)
+	}
+	rotateAt := now.Add(getRotationInterval(duration, a.Provider.RotationInterval))
+
+	return &Result{
+		Registry:    registry,
+		Token:       base64.StdEncoding.EncodeToString([]byte(robot.Name + ":" + robot.Secret)),
+		ExpiresAt:   &expiresAt,
+		Annotations: harborRotationAnnotations.annotations(strconv.FormatInt(robot.ID, 10), rotateAt, expiresAt, identity),
+	}, nil
+}
+
+// Revoke deletes the robot account
+func (a *harborAuthenticator) Revoke(ctx context.Context, log logr.Logger, registryCredentials *v1alpha1.RegistryCredentials, annotations map[string]string) error {
+	id := annotations[HarborRobotIDAnnotation]
+	if id == "" {
+		return nil
+	}
+
+	httpClient, err := newHTTPClient(a.Provider.CABundle)
+	if err != nil {
+		return err
+	}
+	defer httpClient.CloseIdleConnections()
+
+	req, err := a.newRequest(ctx, registryCredentials.Namespace, http.MethodDelete, "robots/"+url.PathEscape(id), nil)
+	if err != nil {
+		return missingCredentials(err)
+	}
+	if err := doDelete(ctx, httpClient, req); err != nil {
+		return err
+	}
+	log.Info("Deleted robot account", "id", id)
+
+	return nil
+}
+
+func (a *harborAuthenticator) getRegistry() (string, error) {
+	if a.Provider.Registry != "" {
+		return a.Provider.Registry, nil
+	}
+	harborURL, err := url.Parse(a.Provider.URL)
+	if err != nil {
+		return "", err
+	}
+
+	return harborURL.Host, nil
+}
+
+// newRequest returns a request to the Harbor v2 API authenticated with the
+// credentials of the Secret
+func (a *harborAuthenticator) newRequest(ctx context.Context, namespace, method, path string, body interface{}) (*http.Request, error) {
+	// The URL is checked again, as the allowed URLs can change after the
+	// RegistryCredentials are created
+	if err := checkURL("url", a.Provider.URL); err != nil {
+		return nil, err
+	}
+	secret, err := getSecret(ctx, a.Reader, namespace, a.Provider.CredentialsSecretRef.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := newJSONRequest(ctx, method, strings.TrimRight(a.Provider.URL, "/")+"/api/v2.0/"+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(string(secret.Data[corev1.BasicAuthUsernameKey]), string(secret.Data[corev1.BasicAuthPasswordKey]))
+
+	return req, nil
+}
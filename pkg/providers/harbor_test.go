@@ -0,0 +1,227 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/astrokube/registry-controller/api/v1alpha1"
+)
+
+// fakeHarbor implements the robot accounts of the Harbor v2 API
+type fakeHarbor struct {
+	mu      sync.Mutex
+	created []harborRobotRequest
+	deleted []string
+}
+
+func (h *fakeHarbor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if username, password, ok := r.BasicAuth(); !ok || username != "admin" || password != "Harbor12345" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v2.0/robots":
+		request := harborRobotRequest{}
+		Expect(json.NewDecoder(r.Body).Decode(&request)).To(Succeed())
+		h.created = append(h.created, request)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(harborRobot{
+			ID:        int64(len(h.created)),
+			Name:      "robot$" + request.Permissions[0].Namespace + "+" + request.Name,
+			Secret:    "secret",
+			ExpiresAt: time.Now().Add(time.Duration(request.Duration) * 24 * time.Hour).Unix(),
+		})
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/api/v2.0/robots/"):
+		id := strings.TrimPrefix(r.URL.Path, "/api/v2.0/robots/")
+		if id == "404" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		h.deleted = append(h.deleted, id)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+var _ = Describe("Harbor provider", func() {
+	var (
+		harbor *fakeHarbor
+		server *httptest.Server
+	)
+
+	registryCredentials := &v1alpha1.RegistryCredentials{
+		ObjectMeta: metav1.ObjectMeta{Name: "sample", Namespace: "team"},
+	}
+
+	adminSecret := func(password string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "harbor-admin", Namespace: "team"},
+			Data: map[string][]byte{
+				corev1.BasicAuthUsernameKey: []byte("admin"),
+				corev1.BasicAuthPasswordKey: []byte(password),
+			},
+		}
+	}
+
+	pullSecret := func(annotations map[string]string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "sample", Namespace: "team", Annotations: annotations},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data: map[string][]byte{
+				corev1.DockerConfigJsonKey: []byte(`{"auths":{"harbor.example.com":{"auth":"Y3VycmVudA=="}}}`),
+			},
+		}
+	}
+
+	newAuthenticator := func(objects ...client.Object) Authenticator {
+		return NewHarborAuthenticator(fake.NewClientBuilder().WithObjects(objects...).Build(), &v1alpha1.HarborProvider{
+			URL:                  server.URL,
+			Project:              "library",
+			Registry:             "harbor.example.com",
+			CredentialsSecretRef: corev1.LocalObjectReference{Name: "harbor-admin"},
+			CABundle:             certificatePEM(server.Certificate()),
+			DurationDays:         10,
+		})
+	}
+
+	BeforeEach(func() {
+		harbor = &fakeHarbor{}
+		server = httptest.NewTLSServer(harbor)
+		AllowedURLs = []string{server.URL}
+	})
+
+	AfterEach(func() {
+		server.Close()
+		AllowedURLs = nil
+	})
+
+	Context("When there is no robot account", func() {
+		It("Should create a robot account with pull access to the project", func() {
+			result, err := newAuthenticator(adminSecret("Harbor12345")).GetToken(context.Background(), log.Log, registryCredentials)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(harbor.created).To(HaveLen(1))
+			Expect(harbor.created[0].Name).To(HavePrefix("team-sample-"))
+			Expect(harbor.created[0].Duration).To(Equal(int32(10)))
+			Expect(harbor.created[0].Permissions).To(Equal([]harborRobotPermission{{
+				Kind:      "project",
+				Namespace: "library",
+				Access:    []harborRobotAccess{{Resource: "repository", Action: "pull"}},
+			}}))
+
+			Expect(result.Registry).To(Equal("harbor.example.com"))
+			Expect(result.ExpiresAt).NotTo(BeNil())
+			Expect(*result.ExpiresAt).To(BeTemporally("~", time.Now().Add(10*24*time.Hour), time.Minute))
+			Expect(result.Annotations).To(HaveKeyWithValue(HarborRobotIDAnnotation, "1"))
+			Expect(result.Annotations).To(HaveKeyWithValue(HarborProjectAnnotation, "library"))
+			rotateAt, err := time.Parse(time.RFC3339, result.Annotations[HarborRotateAtAnnotation])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rotateAt).To(BeTemporally("~", time.Now().Add(5*24*time.Hour), time.Minute))
+		})
+
+		It("Should return an UnauthorizedError when the admin credentials are rejected", func() {
+			_, err := newAuthenticator(adminSecret("invalid")).GetToken(context.Background(), log.Log, registryCredentials)
+			Expect(IsUnauthorized(err)).To(BeTrue())
+		})
+	})
+
+	Context("When there is a robot account", func() {
+		annotations := func(rotateAt time.Time) map[string]string {
+			return map[string]string{
+				HarborRobotIDAnnotation:   "7",
+				HarborProjectAnnotation:   "library",
+				HarborRotateAtAnnotation:  rotateAt.UTC().Format(time.RFC3339),
+				HarborExpiresAtAnnotation: time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339),
+			}
+		}
+
+		It("Should keep it until it must be rotated", func() {
+			current := annotations(time.Now().Add(time.Hour))
+			secret := pullSecret(annotations(time.Now().Add(time.Hour)))
+			secret.Annotations["example.com/owner"] = "team"
+			result, err := newAuthenticator(adminSecret("Harbor12345"), secret).GetToken(context.Background(), log.Log, registryCredentials)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(harbor.created).To(BeEmpty())
+			Expect(result.Token).To(Equal("Y3VycmVudA=="))
+			Expect(result.Annotations).To(Equal(current))
+		})
+
+		It("Should create a new one when it must be rotated", func() {
+			result, err := newAuthenticator(adminSecret("Harbor12345"), pullSecret(annotations(time.Now().Add(-time.Minute)))).GetToken(context.Background(), log.Log, registryCredentials)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(harbor.created).To(HaveLen(1))
+			Expect(result.Annotations).To(HaveKeyWithValue(HarborRobotIDAnnotation, "1"))
+		})
+
+		It("Should delete it when revoked", func() {
+			revoker, ok := newAuthenticator(adminSecret("Harbor12345")).(Revoker)
+			Expect(ok).To(BeTrue())
+
+			Expect(revoker.Revoke(context.Background(), log.Log, registryCredentials, map[string]string{HarborRobotIDAnnotation: "7"})).To(Succeed())
+			Expect(revoker.Revoke(context.Background(), log.Log, registryCredentials, map[string]string{HarborRobotIDAnnotation: "404"})).To(Succeed())
+			Expect(revoker.Revoke(context.Background(), log.Log, registryCredentials, map[string]string{})).To(Succeed())
+			Expect(harbor.deleted).To(Equal([]string{"7"}))
+		})
+
+		It("Should return a MissingCredentialsError without the admin Secret", func() {
+			revoker := newAuthenticator().(Revoker)
+
+			err := revoker.Revoke(context.Background(), log.Log, registryCredentials, map[string]string{HarborRobotIDAnnotation: "7"})
+			Expect(IsMissingCredentials(err)).To(BeTrue())
+			Expect(harbor.deleted).To(BeEmpty())
+		})
+	})
+
+	Context("When validating the provider", func() {
+		BeforeEach(func() {
+			AllowedURLs = []string{"https://harbor.example.com"}
+		})
+
+		It("Should only accept HTTPS URLs", func() {
+			newRegistryCredentials := func(url string) *v1alpha1.RegistryCredentials {
+				return &v1alpha1.RegistryCredentials{Spec: v1alpha1.RegistryCredentialsSpec{
+					Provider: v1alpha1.RegistryProvider{Harbor: &v1alpha1.HarborProvider{
+						URL:                  url,
+						Project:              "library",
+						CredentialsSecretRef: corev1.LocalObjectReference{Name: "harbor-admin"},
+					}},
+				}}
+			}
+			Expect(Validate(newRegistryCredentials("https://harbor.example.com"))).To(Succeed())
+			Expect(Validate(newRegistryCredentials("http://harbor.example.com"))).To(MatchError(ContainSubstring("HTTPS")))
+		})
+
+		It("Should reject rotation intervals longer than the lifetime of the robot accounts", func() {
+			newRegistryCredentials := func(rotationInterval time.Duration) *v1alpha1.RegistryCredentials {
+				return &v1alpha1.RegistryCredentials{Spec: v1alpha1.RegistryCredentialsSpec{
+					Provider: v1alpha1.RegistryProvider{Harbor: &v1alpha1.HarborProvider{
+						URL:                  "https://harbor.example.com",
+						Project:              "library",
+						CredentialsSecretRef: corev1.LocalObjectReference{Name: "harbor-admin"},
+						DurationDays:         1,
+						RotationInterval:     &metav1.Duration{Duration: rotationInterval},
+					}},
+				}}
+			}
+			Expect(Validate(newRegistryCredentials(12 * time.Hour))).To(Succeed())
+			Expect(Validate(newRegistryCredentials(48 * time.Hour))).NotTo(Succeed())
+		})
+	})
+})
@@ -0,0 +1,188 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// maxResponseSize bounds the size of the responses read from external
+// endpoints
+const maxResponseSize = 1 << 20
+
+// AllowedURLs are the URLs, like https://harbor.example.com, that
+// RegistryCredentials can set as the endpoints of the providers, including the
+// endpoints under them. The default endpoints of the providers are always
+// allowed, but the ones set by RegistryCredentials are rejected when empty, so
+// the operator only sends requests to the servers it trusts.
+var AllowedURLs []string
+
+// newHTTPClient returns a client trusting the CAs of the PEM bundle, or the
+// system CAs when empty, and presenting the given client certificates.
+func newHTTPClient(caBundle []byte, certificates ...tls.Certificate) (*http.Client, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: certificates,
+	}
+
+	if len(caBundle) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caBundle) {
+			return nil, errors.New("caBundle doesn't contain any PEM encoded certificate")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// validateHTTPSURL checks that the value of the field is an HTTPS URL
+func validateHTTPSURL(field, value string) error {
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", field, err)
+	}
+	if parsed.Scheme != "https" || parsed.Host == "" {
+		return fmt.Errorf("%s must be an HTTPS URL, got %q", field, value)
+	}
+
+	return nil
+}
+
+// parseHTTPSURLs parses a comma separated list of HTTPS URLs, without their
+// trailing slashes
+func parseHTTPSURLs(field, value string) ([]string, error) {
+	urls := []string{}
+	for _, u := range strings.Split(value, ",") {
+		u = strings.TrimRight(strings.TrimSpace(u), "/")
+		if u == "" {
+			continue
+		}
+		if err := validateHTTPSURL(field, u); err != nil {
+			return nil, err
+		}
+		urls = append(urls, u)
+	}
+
+	return urls, nil
+}
+
+// ParseAllowedURLs parses the comma separated list of the HTTPS URLs that
+// RegistryCredentials can set in the providers
+func ParseAllowedURLs(value string) ([]string, error) {
+	return parseHTTPSURLs("allowed URL", value)
+}
+
+// checkURL checks that the URL set in the field of the provider is one of the
+// AllowedURLs or an endpoint under them
+func checkURL(field, value string) error {
+	if err := validateHTTPSURL(field, value); err != nil {
+		return err
+	}
+	for _, allowed := range AllowedURLs {
+		if value == allowed || strings.HasPrefix(value, allowed+"/") {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%s must be one of the URLs allowed by the operator, got %q", field, value)
+}
+
+// checkResponse returns an error for unsuccessful responses, which is an
+// UnauthorizedError if the credentials were rejected. The body of the response
+// isn't part of the error, as it ends up in the status of the
+// RegistryCredentials.
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	err := fmt.Errorf("%s %s returned %s", resp.Request.Method, resp.Request.URL.Redacted(), resp.Status)
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return &UnauthorizedError{Err: err}
+	}
+
+	return err
+}
+
+// getHTTPError returns a TimeoutError if the request failed because the
+// deadline of the context was exceeded
+func getHTTPError(ctx context.Context, err error) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return &TimeoutError{Err: err}
+	}
+
+	return err
+}
+
+// newJSONRequest returns a request with the JSON encoded body, if any
+func newJSONRequest(ctx context.Context, method, url string, body interface{}) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+
+	return req, nil
+}
+
+// doJSON sends the request and decodes the JSON response into out, when it
+// isn't nil
+func doJSON(ctx context.Context, httpClient *http.Client, req *http.Request, out interface{}) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return getHTTPError(ctx, err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp); err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(out); err != nil {
+		return fmt.Errorf("decoding response of %s: %w", req.URL.Redacted(), err)
+	}
+
+	return nil
+}
+
+// doDelete sends the delete request. Resources not found are considered
+// already deleted.
+func doDelete(ctx context.Context, httpClient *http.Client, req *http.Request) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return getHTTPError(ctx, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+
+	return checkResponse(resp)
+}
@@ -0,0 +1,104 @@
+package providers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/astrokube/registry-controller/api/v1alpha1"
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// oracleRegionRegexp matches Oracle Cloud region identifiers, like
+// us-ashburn-1, and region keys, like iad
+var oracleRegionRegexp = regexp.MustCompile(`^([a-z]{2}-[a-z]+-[0-9]+|[a-z]{3})$`)
+
+func init() {
+	Register(Provider{
+		Name:        "oracleContainerRegistry",
+		DisplayName: "Oracle Cloud Infrastructure Registry",
+		Factory: func(reader client.Reader, registryCredentials *v1alpha1.RegistryCredentials) (Authenticator, error) {
+			return NewOracleContainerRegistryAuthenticator(reader, registryCredentials.Spec.Provider.OracleContainerRegistry), nil
+		},
+		Validator: validateOracleContainerRegistry,
+	})
+}
+
+func validateOracleContainerRegistry(registryCredentials *v1alpha1.RegistryCredentials) error {
+	provider := registryCredentials.Spec.Provider.OracleContainerRegistry
+	if !oracleRegionRegexp.MatchString(provider.Region) {
+		return fmt.Errorf("invalid region %q, it must be a region identifier like us-ashburn-1 or a region key like iad", provider.Region)
+	}
+	if provider.TenancyNamespace == "" || provider.Username == "" {
+		return errors.New("tenancyNamespace and username are required")
+	}
+	if provider.AuthTokenSecretRef.Name == "" || provider.AuthTokenSecretRef.Key == "" {
+		return errors.New("authTokenSecretRef is required")
+	}
+	if provider.Endpoint != "" {
+		if err := checkURL("endpoint", provider.Endpoint); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func NewOracleContainerRegistryAuthenticator(reader client.Reader, provider *v1alpha1.OracleContainerRegistry) Authenticator {
+	return &oracleContainerRegistryAuthenticator{
+		Reader:   reader,
+		Provider: provider,
+	}
+}
+
+type oracleContainerRegistryAuthenticator struct {
+	Reader   client.Reader
+	Provider *v1alpha1.OracleContainerRegistry
+}
+
+func (a *oracleContainerRegistryAuthenticator) GetToken(ctx context.Context, log logr.Logger, registryCredentials *v1alpha1.RegistryCredentials) (*Result, error) {
+	authToken, err := getSecretKey(ctx, a.Reader, registryCredentials.Namespace, &a.Provider.AuthTokenSecretRef)
+	if err != nil {
+		return nil, err
+	}
+	username := a.Provider.TenancyNamespace + "/" + a.Provider.Username
+	password := strings.TrimSpace(string(authToken))
+
+	httpClient, err := newHTTPClient(a.Provider.CABundle)
+	if err != nil {
+		return nil, err
+	}
+	defer httpClient.CloseIdleConnections()
+
+	// Validate the auth token against the token endpoint of the registry
+	endpoint := a.Provider.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.ocir.io", a.Provider.Region)
+	} else if err := checkURL("endpoint", endpoint); err != nil {
+		return nil, err
+	}
+	req, err := newJSONRequest(ctx, http.MethodGet, strings.TrimRight(endpoint, "/")+"/20180419/docker/token", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(username, password)
+	if err := doJSON(ctx, httpClient, req, nil); err != nil {
+		log.Info("Unable to validate the auth token", "username", username)
+		return nil, err
+	}
+
+	registry := a.Provider.Registry
+	if registry == "" {
+		registry = a.Provider.Region + ".ocir.io"
+	}
+
+	return &Result{
+		Registry: registry,
+		Token:    base64.StdEncoding.EncodeToString([]byte(username + ":" + password)),
+	}, nil
+}
@@ -0,0 +1,97 @@
+package providers
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/astrokube/registry-controller/api/v1alpha1"
+)
+
+var _ = Describe("Oracle Cloud Infrastructure Registry provider", func() {
+	var server *httptest.Server
+
+	registryCredentials := &v1alpha1.RegistryCredentials{
+		ObjectMeta: metav1.ObjectMeta{Name: "sample", Namespace: "default"},
+	}
+
+	BeforeEach(func() {
+		server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/20180419/docker/token" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			username, password, ok := r.BasicAuth()
+			if !ok || username != "tenancy/oracleidentitycloudservice/user@example.com" || password != "auth-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"token":"bearer","access_token":"bearer","expires_in":300}`))
+		}))
+		AllowedURLs = []string{server.URL}
+	})
+
+	AfterEach(func() {
+		server.Close()
+		AllowedURLs = nil
+	})
+
+	getToken := func(authToken string) (*Result, error) {
+		reader := fake.NewClientBuilder().WithObjects(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "oracle", Namespace: "default"},
+			Data:       map[string][]byte{"token": []byte(authToken)},
+		}).Build()
+
+		return NewOracleContainerRegistryAuthenticator(reader, &v1alpha1.OracleContainerRegistry{
+			Region:             "us-ashburn-1",
+			TenancyNamespace:   "tenancy",
+			Username:           "oracleidentitycloudservice/user@example.com",
+			AuthTokenSecretRef: corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "oracle"}, Key: "token"},
+			Endpoint:           server.URL,
+			CABundle:           certificatePEM(server.Certificate()),
+		}).GetToken(context.Background(), log.Log, registryCredentials)
+	}
+
+	Context("When the auth token is valid", func() {
+		It("Should return the auth entry of the regional registry", func() {
+			result, err := getToken("auth-token\n")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Registry).To(Equal("us-ashburn-1.ocir.io"))
+			Expect(result.Token).To(Equal(base64.StdEncoding.EncodeToString([]byte("tenancy/oracleidentitycloudservice/user@example.com:auth-token"))))
+		})
+	})
+
+	Context("When the auth token is invalid", func() {
+		It("Should return an UnauthorizedError", func() {
+			_, err := getToken("invalid")
+			Expect(IsUnauthorized(err)).To(BeTrue())
+		})
+	})
+
+	Context("When validating the provider", func() {
+		It("Should accept region identifiers and keys", func() {
+			validate := func(region string) error {
+				return Validate(&v1alpha1.RegistryCredentials{Spec: v1alpha1.RegistryCredentialsSpec{
+					Provider: v1alpha1.RegistryProvider{OracleContainerRegistry: &v1alpha1.OracleContainerRegistry{
+						Region:             region,
+						TenancyNamespace:   "tenancy",
+						Username:           "user",
+						AuthTokenSecretRef: corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "oracle"}, Key: "token"},
+					}},
+				}})
+			}
+			Expect(validate("us-ashburn-1")).To(Succeed())
+			Expect(validate("iad")).To(Succeed())
+			Expect(validate("ashburn")).NotTo(Succeed())
+			Expect(validate("")).NotTo(Succeed())
+		})
+	})
+})
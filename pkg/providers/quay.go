@@ -0,0 +1,125 @@
+package providers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/astrokube/registry-controller/api/v1alpha1"
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const defaultQuayRegistry = "quay.io"
+
+func init() {
+	Register(Provider{
+		Name:        "quay",
+		DisplayName: "Quay",
+		Factory: func(reader client.Reader, registryCredentials *v1alpha1.RegistryCredentials) (Authenticator, error) {
+			return NewQuayAuthenticator(reader, registryCredentials.Spec.Provider.Quay), nil
+		},
+		Validator: validateQuay,
+	})
+}
+
+func validateQuay(registryCredentials *v1alpha1.RegistryCredentials) error {
+	provider := registryCredentials.Spec.Provider.Quay
+	if (provider.RobotAccountSecretRef == nil) == (provider.PullSecretRef == nil) {
+		return errors.New("either robotAccountSecretRef or pullSecretRef must be set")
+	}
+	if provider.RobotAccountSecretRef != nil && len(provider.Hosts) > 0 {
+		return errors.New("hosts can only be set with pullSecretRef")
+	}
+	if provider.PullSecretRef != nil && provider.Registry != "" {
+		return errors.New("registry can only be set with robotAccountSecretRef")
+	}
+	for _, host := range provider.Hosts {
+		if _, err := path.Match(host, ""); err != nil {
+			return fmt.Errorf("invalid host %q: %w", host, err)
+		}
+	}
+
+	return nil
+}
+
+func NewQuayAuthenticator(reader client.Reader, provider *v1alpha1.QuayProvider) Authenticator {
+	return &quayAuthenticator{
+		Reader:   reader,
+		Provider: provider,
+	}
+}
+
+type quayAuthenticator struct {
+	Reader   client.Reader
+	Provider *v1alpha1.QuayProvider
+}
+
+func (a *quayAuthenticator) GetToken(ctx context.Context, log logr.Logger, registryCredentials *v1alpha1.RegistryCredentials) (*Result, error) {
+	if a.Provider.RobotAccountSecretRef != nil {
+		secret, err := getSecret(ctx, a.Reader, registryCredentials.Namespace, a.Provider.RobotAccountSecretRef.Name)
+		if err != nil {
+			return nil, err
+		}
+		username, token := secret.Data["username"], secret.Data["token"]
+		if len(username) == 0 || len(token) == 0 {
+			return nil, fmt.Errorf("the Secret %q must have the username and token keys", secret.Name)
+		}
+
+		registry := a.Provider.Registry
+		if registry == "" {
+			registry = defaultQuayRegistry
+		}
+		return &Result{
+			Registry: registry,
+			Token:    base64.StdEncoding.EncodeToString([]byte(string(username) + ":" + strings.TrimSpace(string(token)))),
+		}, nil
+	}
+
+	pullSecret, err := getSecretKey(ctx, a.Reader, registryCredentials.Namespace, a.Provider.PullSecretRef)
+	if err != nil {
+		return nil, err
+	}
+	auths, err := parseDockerConfigJSON(pullSecret)
+	if err != nil {
+		return nil, fmt.Errorf("parsing the pull secret: %w", err)
+	}
+
+	result := &Result{Auths: map[string]string{}}
+	for registry, auth := range auths {
+		if auth == "" || !a.matchHosts(registry) {
+			log.V(1).Info("Skipping auth entry of the pull secret", "registry", registry)
+			continue
+		}
+		result.Auths[registry] = auth
+	}
+	if len(result.Auths) == 0 {
+		return nil, errors.New("no auth entry of the pull secret matches the hosts")
+	}
+
+	return result, nil
+}
+
+// matchHosts returns whether the host of the auth entry, which may be a URL
+// like https://index.docker.io/v1/, matches any of the hosts of the provider
+func (a *quayAuthenticator) matchHosts(registry string) bool {
+	if len(a.Provider.Hosts) == 0 {
+		return true
+	}
+
+	host := registry
+	if i := strings.Index(host, "://"); i >= 0 {
+		host = host[i+3:]
+	}
+	host = strings.SplitN(host, "/", 2)[0]
+	for _, pattern := range a.Provider.Hosts {
+		if matchHost(pattern, host) {
+			return true
+		}
+	}
+
+	return false
+}
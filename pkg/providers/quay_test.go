@@ -0,0 +1,100 @@
+package providers
+
+import (
+	"context"
+	"encoding/base64"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/astrokube/registry-controller/api/v1alpha1"
+)
+
+var _ = Describe("Quay provider", func() {
+	registryCredentials := &v1alpha1.RegistryCredentials{
+		ObjectMeta: metav1.ObjectMeta{Name: "sample", Namespace: "default"},
+	}
+
+	pullSecret := `{"auths":{
+		"cloud.openshift.com":{"auth":"Y2xvdWQ=","email":"user@example.com"},
+		"quay.io":{"auth":"cXVheQ==","email":"user@example.com"},
+		"registry.connect.redhat.com":{"auth":"Y29ubmVjdA==","email":"user@example.com"},
+		"registry.redhat.io":{"username":"user","password":"secret"}
+	}}`
+
+	getToken := func(provider *v1alpha1.QuayProvider) (*Result, error) {
+		reader := fake.NewClientBuilder().WithObjects(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "quay", Namespace: "default"},
+			Data: map[string][]byte{
+				"username":                 []byte("org+robot"),
+				"token":                    []byte("robot-token"),
+				corev1.DockerConfigJsonKey: []byte(pullSecret),
+			},
+		}).Build()
+
+		return NewQuayAuthenticator(reader, provider).GetToken(context.Background(), log.Log, registryCredentials)
+	}
+
+	pullSecretRef := &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "quay"}, Key: corev1.DockerConfigJsonKey}
+
+	Context("When using a robot account", func() {
+		It("Should return the auth entry of quay.io", func() {
+			result, err := getToken(&v1alpha1.QuayProvider{RobotAccountSecretRef: &corev1.LocalObjectReference{Name: "quay"}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Registry).To(Equal("quay.io"))
+			Expect(result.Token).To(Equal(base64.StdEncoding.EncodeToString([]byte("org+robot:robot-token"))))
+		})
+	})
+
+	Context("When using a pull secret", func() {
+		It("Should split it into auth entries by host", func() {
+			result, err := getToken(&v1alpha1.QuayProvider{PullSecretRef: pullSecretRef})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Registry).To(BeEmpty())
+			Expect(result.Auths).To(Equal(map[string]string{
+				"cloud.openshift.com":         "Y2xvdWQ=",
+				"quay.io":                     "cXVheQ==",
+				"registry.connect.redhat.com": "Y29ubmVjdA==",
+				"registry.redhat.io":          base64.StdEncoding.EncodeToString([]byte("user:secret")),
+			}))
+		})
+
+		It("Should only propagate the hosts matching the filter", func() {
+			result, err := getToken(&v1alpha1.QuayProvider{PullSecretRef: pullSecretRef, Hosts: []string{"quay.io", "*.redhat.io"}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Auths).To(HaveLen(2))
+			Expect(result.Auths).To(HaveKey("quay.io"))
+			Expect(result.Auths).To(HaveKey("registry.redhat.io"))
+		})
+
+		It("Should fail when no host matches the filter", func() {
+			_, err := getToken(&v1alpha1.QuayProvider{PullSecretRef: pullSecretRef, Hosts: []string{"docker.io"}})
+			Expect(err).To(MatchError(ContainSubstring("no auth entry")))
+		})
+	})
+
+	Context("When validating the provider", func() {
+		validate := func(provider *v1alpha1.QuayProvider) error {
+			return Validate(&v1alpha1.RegistryCredentials{Spec: v1alpha1.RegistryCredentialsSpec{
+				Provider: v1alpha1.RegistryProvider{Quay: provider},
+			}})
+		}
+
+		It("Should require either a robot account or a pull secret", func() {
+			Expect(validate(&v1alpha1.QuayProvider{})).NotTo(Succeed())
+			Expect(validate(&v1alpha1.QuayProvider{
+				RobotAccountSecretRef: &corev1.LocalObjectReference{Name: "quay"},
+				PullSecretRef:         pullSecretRef,
+			})).NotTo(Succeed())
+			Expect(validate(&v1alpha1.QuayProvider{PullSecretRef: pullSecretRef, Hosts: []string{"*.redhat.io"}})).To(Succeed())
+		})
+
+		It("Should reject invalid host patterns", func() {
+			Expect(validate(&v1alpha1.QuayProvider{PullSecretRef: pullSecretRef, Hosts: []string{"[quay.io"}})).NotTo(Succeed())
+		})
+	})
+})
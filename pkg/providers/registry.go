@@ -0,0 +1,129 @@
+package providers
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/astrokube/registry-controller/api/v1alpha1"
+)
+
+// Factory returns the Authenticator for the provider configured in the
+// RegistryCredentials. The reader gives access to the Secrets referenced by
+// the provider.
+type Factory func(reader client.Reader, registryCredentials *v1alpha1.RegistryCredentials) (Authenticator, error)
+
+// Validator validates the spec of the provider configured in the
+// RegistryCredentials. It is called by the admission webhook.
+type Validator func(registryCredentials *v1alpha1.RegistryCredentials) error
+
+// Provider is the registration of a provider
+type Provider struct {
+	// Name is the JSON name of the field of the provider in RegistryProvider,
+	// like awsElasticContainerRegistry
+	Name string
+	// DisplayName is the human readable name of the provider
+	DisplayName string
+	// Factory builds the Authenticator of the provider
+	Factory Factory
+	// Validator validates the spec of the provider. Optional.
+	Validator Validator
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Provider{}
+)
+
+// Register makes a provider available to the controller and the admission
+// webhook. It panics if the provider is incomplete or already registered, so it
+// is meant to be called from init functions.
+func Register(provider Provider) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if provider.Name == "" || provider.Factory == nil {
+		panic("providers: Register requires a name and a factory")
+	}
+	if _, ok := registry[provider.Name]; ok {
+		panic(fmt.Sprintf("providers: Register called twice for provider %q", provider.Name))
+	}
+	if provider.DisplayName == "" {
+		provider.DisplayName = provider.Name
+	}
+	registry[provider.Name] = provider
+}
+
+// Lookup returns the registered provider with the given name.
+func Lookup(name string) (Provider, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	provider, ok := registry[name]
+	return provider, ok
+}
+
+// Names returns the sorted names of the registered providers.
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Get returns the registered provider configured in the RegistryCredentials.
+// It returns ErrProviderNotImplemented when no registered provider is
+// configured.
+func Get(registryCredentials *v1alpha1.RegistryCredentials) (Provider, error) {
+	for _, name := range registryCredentials.Spec.Provider.Names() {
+		if provider, ok := Lookup(name); ok {
+			return provider, nil
+		}
+	}
+
+	return Provider{}, ErrProviderNotImplemented
+}
+
+// NewAuthenticator returns the Authenticator of the provider configured in the
+// RegistryCredentials.
+func NewAuthenticator(reader client.Reader, registryCredentials *v1alpha1.RegistryCredentials) (Authenticator, error) {
+	provider, err := Get(registryCredentials)
+	if err != nil {
+		return nil, err
+	}
+
+	return provider.Factory(reader, registryCredentials)
+}
+
+// Validate checks that exactly one provider is configured in the
+// RegistryCredentials, that it is registered and that its spec is valid.
+func Validate(registryCredentials *v1alpha1.RegistryCredentials) error {
+	names := registryCredentials.Spec.Provider.Names()
+	switch {
+	case len(names) == 0:
+		return v1alpha1.ErrProviderNotSet
+	case len(names) > 1:
+		return fmt.Errorf("only one provider can be set, got %v", names)
+	}
+
+	provider, ok := Lookup(names[0])
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrProviderNotImplemented, names[0])
+	}
+	if provider.Validator == nil {
+		return nil
+	}
+	if err := provider.Validator(registryCredentials); err != nil {
+		return fmt.Errorf("invalid %s provider: %w", provider.DisplayName, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package providers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/astrokube/registry-controller/api/v1alpha1"
+)
+
+type fakeAuthenticator struct{}
+
+func (a *fakeAuthenticator) GetToken(ctx context.Context, log logr.Logger, registryCredentials *v1alpha1.RegistryCredentials) (*Result, error) {
+	return &Result{Registry: "registry.example.com", Token: "token"}, nil
+}
+
+func newAWSRegistryCredentials(provider *v1alpha1.AWSElasticContainerRegistry) *v1alpha1.RegistryCredentials {
+	return &v1alpha1.RegistryCredentials{
+		Spec: v1alpha1.RegistryCredentialsSpec{
+			Provider: v1alpha1.RegistryProvider{AWSElasticContainerRegistry: provider},
+		},
+	}
+}
+
+var _ = Describe("Provider registry", func() {
+
+	Context("When registering providers", func() {
+		It("Should register the built-in providers", func() {
+			provider, ok := Lookup("awsElasticContainerRegistry")
+			Expect(ok).To(BeTrue())
+			Expect(provider.DisplayName).To(Equal("AWS Elastic Container Registry"))
+			Expect(Names()).To(ContainElement("awsElasticContainerRegistry"))
+		})
+
+		It("Should panic when registering a provider twice", func() {
+			Expect(func() {
+				Register(Provider{Name: "awsElasticContainerRegistry", Factory: func(client.Reader, *v1alpha1.RegistryCredentials) (Authenticator, error) {
+					return &fakeAuthenticator{}, nil
+				}})
+			}).To(Panic())
+		})
+
+		It("Should panic when registering a provider without factory", func() {
+			Expect(func() { Register(Provider{Name: "incomplete"}) }).To(Panic())
+		})
+	})
+
+	Context("When getting the provider of RegistryCredentials", func() {
+		It("Should return the authenticator of the configured provider", func() {
+			authenticator, err := NewAuthenticator(nil, newAWSRegistryCredentials(&v1alpha1.AWSElasticContainerRegistry{Region: "eu-west-1"}))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(authenticator).To(BeAssignableToTypeOf(&awsElasticContainerRegistryAuthenticator{}))
+		})
+
+		It("Should fail when no provider is configured", func() {
+			_, err := NewAuthenticator(nil, &v1alpha1.RegistryCredentials{})
+			Expect(err).To(MatchError(ErrProviderNotImplemented))
+			Expect(err.Error()).To(Equal("Provider not implemented"))
+		})
+	})
+
+	Context("When validating RegistryCredentials", func() {
+		It("Should fail when no provider is set", func() {
+			Expect(errors.Is(Validate(&v1alpha1.RegistryCredentials{}), v1alpha1.ErrProviderNotSet)).To(BeTrue())
+		})
+
+		It("Should validate the spec of the provider", func() {
+			err := Validate(newAWSRegistryCredentials(&v1alpha1.AWSElasticContainerRegistry{Region: "eu-west-1"}))
+			Expect(err).To(MatchError(ContainSubstring("invalid AWS Elastic Container Registry provider")))
+
+			Expect(Validate(newAWSRegistryCredentials(&v1alpha1.AWSElasticContainerRegistry{
+				AccessKeyID:     "AKIA",
+				SecretAccessKey: "secret",
+				Region:          "eu-west-1",
+			}))).To(Succeed())
+		})
+	})
+})
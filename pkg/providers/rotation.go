@@ -0,0 +1,90 @@
+package providers
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/astrokube/registry-controller/api/v1alpha1"
+)
+
+// rotationAnnotations are the keys of the annotations of the Secret that keep
+// track of the credentials issued by a provider
+type rotationAnnotations struct {
+	ID        string
+	RotateAt  string
+	ExpiresAt string
+}
+
+// annotations returns the annotations of issued credentials, with the ones
+// identifying where they were issued
+func (k rotationAnnotations) annotations(id string, rotateAt, expiresAt time.Time, identity map[string]string) map[string]string {
+	annotations := map[string]string{
+		k.ID:        id,
+		k.RotateAt:  rotateAt.UTC().Format(time.RFC3339),
+		k.ExpiresAt: expiresAt.UTC().Format(time.RFC3339),
+	}
+	for key, value := range identity {
+		annotations[key] = value
+	}
+
+	return annotations
+}
+
+// getCurrentCredentials returns the credentials for the registry stored in the
+// Secret of the RegistryCredentials, if they were issued where the identity
+// annotations say and aren't due for rotation
+func getCurrentCredentials(ctx context.Context, reader client.Reader, registryCredentials *v1alpha1.RegistryCredentials, registry string, keys rotationAnnotations, identity map[string]string) (*Result, error) {
+	secret, err := getSecret(ctx, reader, registryCredentials.Namespace, registryCredentials.Name)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	annotations := secret.Annotations
+	if annotations[keys.ID] == "" {
+		return nil, nil
+	}
+	for key, value := range identity {
+		if annotations[key] != value {
+			return nil, nil
+		}
+	}
+	rotateAt, err := time.Parse(time.RFC3339, annotations[keys.RotateAt])
+	if err != nil || !time.Now().Before(rotateAt) {
+		return nil, nil
+	}
+	expiresAt, err := time.Parse(time.RFC3339, annotations[keys.ExpiresAt])
+	if err != nil {
+		return nil, nil
+	}
+	auths, err := parseDockerConfigJSON(secret.Data[corev1.DockerConfigJsonKey])
+	if err != nil || auths[registry] == "" {
+		return nil, nil
+	}
+
+	// Only keep the annotations of the issued credentials, not the ones that
+	// other tools added to the Secret
+	return &Result{
+		Registry:    registry,
+		Token:       auths[registry],
+		ExpiresAt:   &expiresAt,
+		Annotations: keys.annotations(annotations[keys.ID], rotateAt, expiresAt, identity),
+	}, nil
+}
+
+// getRotationInterval returns the interval between rotations of credentials
+// with the given lifetime, which defaults to half of it
+func getRotationInterval(lifetime time.Duration, rotationInterval *metav1.Duration) time.Duration {
+	if rotationInterval != nil {
+		return rotationInterval.Duration
+	}
+
+	return lifetime / 2
+}
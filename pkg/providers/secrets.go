@@ -0,0 +1,46 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// getSecret returns a Secret in the namespace of the RegistryCredentials
+func getSecret(ctx context.Context, reader client.Reader, namespace, name string) (*corev1.Secret, error) {
+	secret := &corev1.Secret{}
+	if err := reader.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, secret); err != nil {
+		return nil, fmt.Errorf("getting Secret %q: %w", name, err)
+	}
+
+	return secret, nil
+}
+
+// getSecretKey returns the value of a key of a Secret in the namespace of the
+// RegistryCredentials
+func getSecretKey(ctx context.Context, reader client.Reader, namespace string, selector *corev1.SecretKeySelector) ([]byte, error) {
+	secret, err := getSecret(ctx, reader, namespace, selector.Name)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := secret.Data[selector.Key]
+	if !ok {
+		return nil, fmt.Errorf("key %q not found in Secret %q", selector.Key, selector.Name)
+	}
+
+	return value, nil
+}
+
+// missingCredentials returns a MissingCredentialsError when the error is
+// because a Secret doesn't exist
+func missingCredentials(err error) error {
+	if apierrors.IsNotFound(err) {
+		return &MissingCredentialsError{Err: err}
+	}
+
+	return err
+}
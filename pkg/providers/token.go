@@ -1,15 +1,126 @@
 package providers
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"time"
-
-	"github.com/astrokube/registry-controller/api/v1alpha1"
 )
 
-type AuthenticationIntent struct {
+// Result is the token returned by a provider
+type Result struct {
 	ExpiresAt *time.Time
 	Registry  string
-	State     v1alpha1.RegistryCredentialsState
 	Token     string
-	Error     error
+	// Auths are the tokens of additional registries, by host, for providers
+	// returning credentials for several registries
+	Auths map[string]string
+	// Annotations are stored in the generated Secret. Providers use them to
+	// keep track of the credentials they issued.
+	Annotations map[string]string
+	// PullRateLimit is the pull quota of the credentials, for providers whose
+	// registry reports it
+	PullRateLimit *PullRateLimit
+}
+
+// PullRateLimit is the pull quota reported by a registry
+type PullRateLimit struct {
+	Limit     int64
+	Remaining int64
+	Window    time.Duration
+}
+
+type dockerConfigJSON struct {
+	Auths map[string]dockerConfigEntry `json:"auths"`
+}
+
+type dockerConfigEntry struct {
+	Auth     string `json:"auth"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// DockerConfigJSON returns the content of a kubernetes.io/dockerconfigjson
+// Secret with all the tokens of the result.
+func (r Result) DockerConfigJSON() ([]byte, error) {
+	config := dockerConfigJSON{Auths: map[string]dockerConfigEntry{}}
+	for registry, token := range r.Auths {
+		config.Auths[registry] = dockerConfigEntry{Auth: token}
+	}
+	if r.Registry != "" {
+		config.Auths[r.Registry] = dockerConfigEntry{Auth: r.Token}
+	}
+
+	return json.Marshal(config)
+}
+
+// WithMirrors returns the result with the token of its registry also set for
+// the mirrors. Results with the tokens of several registries can't be
+// mirrored.
+func (r Result) WithMirrors(mirrors []string) (Result, error) {
+	if len(mirrors) == 0 {
+		return r, nil
+	}
+
+	token := r.Token
+	if r.Registry == "" {
+		if len(r.Auths) != 1 {
+			return r, errors.New("mirrors require a provider returning the credentials of a single registry")
+		}
+		for _, auth := range r.Auths {
+			token = auth
+		}
+	}
+
+	auths := make(map[string]string, len(r.Auths)+len(mirrors))
+	for registry, auth := range r.Auths {
+		auths[registry] = auth
+	}
+	for _, mirror := range mirrors {
+		auths[mirror] = token
+	}
+	r.Auths = auths
+
+	return r, nil
+}
+
+// minRefreshInterval bounds how often short-lived tokens are refreshed
+const minRefreshInterval = 10 * time.Second
+
+// RefreshAfter returns when the token must be refreshed: after the interval, or
+// earlier if it expires before, once 80% of its remaining lifetime has passed.
+func (r Result) RefreshAfter(now time.Time, interval time.Duration) time.Duration {
+	if r.ExpiresAt == nil {
+		return interval
+	}
+
+	refresh := r.ExpiresAt.Sub(now) * 4 / 5
+	if refresh > interval {
+		return interval
+	}
+	if refresh < minRefreshInterval {
+		return minRefreshInterval
+	}
+
+	return refresh
+}
+
+// parseDockerConfigJSON returns the tokens, by registry, of the content of a
+// kubernetes.io/dockerconfigjson Secret. Entries with a username and a password
+// instead of an auth are encoded like the auths.
+func parseDockerConfigJSON(data []byte) (map[string]string, error) {
+	config := dockerConfigJSON{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+
+	auths := map[string]string{}
+	for registry, entry := range config.Auths {
+		if entry.Auth == "" && entry.Username != "" {
+			entry.Auth = base64.StdEncoding.EncodeToString([]byte(entry.Username + ":" + entry.Password))
+		}
+		auths[registry] = entry.Auth
+	}
+
+	return auths, nil
 }
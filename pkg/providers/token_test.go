@@ -0,0 +1,40 @@
+package providers
+
+import (
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Result", func() {
+	Context("When it has mirrors", func() {
+		It("Should set the token of the registry for the mirrors", func() {
+			result, err := Result{Registry: "123.dkr.ecr.eu-west-1.amazonaws.com", Token: "dG9rZW4="}.WithMirrors([]string{"123.dkr.ecr.eu-west-1.amazonaws.com/docker-hub", "harbor.example.com"})
+			Expect(err).NotTo(HaveOccurred())
+
+			dockerConfig, err := result.DockerConfigJSON()
+			Expect(err).NotTo(HaveOccurred())
+			config := dockerConfigJSON{}
+			Expect(json.Unmarshal(dockerConfig, &config)).To(Succeed())
+			Expect(config.Auths).To(Equal(map[string]dockerConfigEntry{
+				"123.dkr.ecr.eu-west-1.amazonaws.com":            {Auth: "dG9rZW4="},
+				"123.dkr.ecr.eu-west-1.amazonaws.com/docker-hub": {Auth: "dG9rZW4="},
+				"harbor.example.com":                             {Auth: "dG9rZW4="},
+			}))
+		})
+
+		It("Should mirror results with a single auth", func() {
+			auths := map[string]string{"quay.io": "cXVheQ=="}
+			result, err := Result{Auths: auths}.WithMirrors([]string{"harbor.example.com/quay"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Auths).To(HaveKeyWithValue("harbor.example.com/quay", "cXVheQ=="))
+			Expect(auths).To(HaveLen(1))
+		})
+
+		It("Should fail for results with several registries", func() {
+			_, err := Result{Auths: map[string]string{"quay.io": "cXVheQ==", "registry.redhat.io": "cmg="}}.WithMirrors([]string{"harbor.example.com"})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
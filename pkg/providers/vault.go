@@ -0,0 +1,278 @@
+package providers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/astrokube/registry-controller/api/v1alpha1"
+	"github.com/go-logr/logr"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	defaultVaultAuthPath           = "kubernetes"
+	defaultVaultServiceAccountName = "default"
+
+	// vaultTokenExpirationSeconds is the lifetime of the service account
+	// tokens requested to login, the minimum allowed by the API server
+	vaultTokenExpirationSeconds = 600
+)
+
+var (
+	// VaultAddresses are the addresses of the Vault servers that
+	// RegistryCredentials can login to. The vault provider is disabled when
+	// empty, as the tokens of the service accounts must only be sent to the
+	// servers trusted by the operator.
+	VaultAddresses []string
+
+	// VaultTokenAudiences are the audiences of the service account tokens used
+	// to login to Vault. The audiences of the API server are used when empty.
+	VaultTokenAudiences []string
+
+	// ServiceAccountTokens requests the tokens of the service accounts used to
+	// login to Vault
+	ServiceAccountTokens TokenRequester
+)
+
+// TokenRequester returns a token of the service account of the namespace with
+// the audiences
+type TokenRequester func(ctx context.Context, namespace, name string, audiences []string) (string, error)
+
+// NewTokenRequester returns the TokenRequester that requests short-lived
+// tokens with the TokenRequest API
+func NewTokenRequester(serviceAccounts corev1client.ServiceAccountsGetter) TokenRequester {
+	return func(ctx context.Context, namespace, name string, audiences []string) (string, error) {
+		expirationSeconds := int64(vaultTokenExpirationSeconds)
+		tokenRequest, err := serviceAccounts.ServiceAccounts(namespace).CreateToken(ctx, name, &authenticationv1.TokenRequest{
+			Spec: authenticationv1.TokenRequestSpec{
+				Audiences:         audiences,
+				ExpirationSeconds: &expirationSeconds,
+			},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return "", err
+		}
+
+		return tokenRequest.Status.Token, nil
+	}
+}
+
+// ParseVaultAddresses parses the comma separated list of the addresses of the
+// Vault servers, which must be HTTPS URLs
+func ParseVaultAddresses(value string) ([]string, error) {
+	return parseHTTPSURLs("Vault address", value)
+}
+
+func init() {
+	Register(Provider{
+		Name:        "vault",
+		DisplayName: "HashiCorp Vault",
+		Factory: func(reader client.Reader, registryCredentials *v1alpha1.RegistryCredentials) (Authenticator, error) {
+			return NewVaultAuthenticator(ServiceAccountTokens, registryCredentials.Spec.Provider.Vault), nil
+		},
+		Validator: validateVault,
+	})
+}
+
+func validateVault(registryCredentials *v1alpha1.RegistryCredentials) error {
+	provider := registryCredentials.Spec.Provider.Vault
+	if err := checkVaultAddress(provider.Address); err != nil {
+		return err
+	}
+	if provider.Role == "" {
+		return errors.New("role is required")
+	}
+	if strings.Trim(provider.Path, "/") == "" {
+		return errors.New("path is required")
+	}
+
+	return nil
+}
+
+// checkVaultAddress checks that the address is one of the Vault servers
+// allowed by the operator
+func checkVaultAddress(address string) error {
+	if len(VaultAddresses) == 0 {
+		return errors.New("no Vault address is allowed by the operator")
+	}
+	for _, allowed := range VaultAddresses {
+		if strings.TrimRight(address, "/") == allowed {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("address must be one of the Vault addresses allowed by the operator %v, got %q", VaultAddresses, address)
+}
+
+// vaultLoginRequest is the body of the login of the Kubernetes auth method
+type vaultLoginRequest struct {
+	Role string `json:"role"`
+	JWT  string `json:"jwt"`
+}
+
+// vaultResponse is the response of the Vault API
+type vaultResponse struct {
+	LeaseDuration int                    `json:"lease_duration"`
+	Data          map[string]interface{} `json:"data"`
+	Auth          *struct {
+		ClientToken string `json:"client_token"`
+	} `json:"auth"`
+}
+
+// NewVaultAuthenticator returns the Authenticator that logins to Vault with
+// the tokens of the service accounts of the namespaces of the
+// RegistryCredentials
+func NewVaultAuthenticator(tokens TokenRequester, provider *v1alpha1.VaultProvider) Authenticator {
+	return &vaultAuthenticator{
+		Tokens:   tokens,
+		Provider: provider,
+	}
+}
+
+type vaultAuthenticator struct {
+	Tokens   TokenRequester
+	Provider *v1alpha1.VaultProvider
+}
+
+func (a *vaultAuthenticator) GetToken(ctx context.Context, log logr.Logger, registryCredentials *v1alpha1.RegistryCredentials) (*Result, error) {
+	// The address is checked again, as the allowed addresses can change after
+	// the RegistryCredentials are created
+	if err := checkVaultAddress(a.Provider.Address); err != nil {
+		return nil, err
+	}
+
+	httpClient, err := newHTTPClient(a.Provider.CABundle)
+	if err != nil {
+		return nil, err
+	}
+	defer httpClient.CloseIdleConnections()
+
+	token, err := a.login(ctx, httpClient, registryCredentials.ObjectMeta.Namespace)
+	if err != nil {
+		log.Info("Unable to login to Vault", "role", a.Provider.Role)
+		return nil, err
+	}
+
+	secret := &vaultResponse{}
+	if err := a.do(ctx, httpClient, http.MethodGet, a.Provider.Path, token, nil, secret); err != nil {
+		log.Info("Unable to read the Vault secret", "path", a.Provider.Path)
+		return nil, err
+	}
+
+	data := secret.Data
+	// KV v2 nests the fields of the secret with its metadata
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"].(map[string]interface{}); ok {
+			data = nested
+		}
+	}
+
+	username, err := getVaultField(data, a.Provider.Fields.Username, "username", true)
+	if err != nil {
+		return nil, err
+	}
+	password, err := getVaultField(data, a.Provider.Fields.Password, "password", true)
+	if err != nil {
+		return nil, err
+	}
+	registry, err := getVaultField(data, a.Provider.Fields.Registry, "registry", false)
+	if err != nil {
+		return nil, err
+	}
+	if registry == "" {
+		registry = a.Provider.Registry
+	}
+	if registry == "" {
+		return nil, fmt.Errorf("the Vault secret doesn't have a registry and no registry is set")
+	}
+
+	result := &Result{
+		Registry: registry,
+		Token:    base64.StdEncoding.EncodeToString([]byte(username + ":" + password)),
+	}
+	if secret.LeaseDuration > 0 {
+		expiresAt := time.Now().Add(time.Duration(secret.LeaseDuration) * time.Second)
+		result.ExpiresAt = &expiresAt
+	}
+
+	return result, nil
+}
+
+// login authenticates with the Kubernetes auth method and returns the Vault
+// token. It uses a token of the service account of the namespace of the
+// RegistryCredentials, so the Vault roles can be bound to each tenant.
+func (a *vaultAuthenticator) login(ctx context.Context, httpClient *http.Client, namespace string) (string, error) {
+	if a.Tokens == nil {
+		return "", errors.New("the service account tokens can't be requested")
+	}
+	serviceAccountName := a.Provider.ServiceAccountName
+	if serviceAccountName == "" {
+		serviceAccountName = defaultVaultServiceAccountName
+	}
+	jwt, err := a.Tokens(ctx, namespace, serviceAccountName, VaultTokenAudiences)
+	if err != nil {
+		return "", fmt.Errorf("requesting a token of the service account %q: %w", serviceAccountName, err)
+	}
+
+	authPath := strings.Trim(a.Provider.AuthPath, "/")
+	if authPath == "" {
+		authPath = defaultVaultAuthPath
+	}
+
+	response := &vaultResponse{}
+	err = a.do(ctx, httpClient, http.MethodPost, "auth/"+authPath+"/login", "", vaultLoginRequest{
+		Role: a.Provider.Role,
+		JWT:  jwt,
+	}, response)
+	if err != nil {
+		return "", err
+	}
+	if response.Auth == nil || response.Auth.ClientToken == "" {
+		return "", errors.New("the Vault login didn't return a token")
+	}
+
+	return response.Auth.ClientToken, nil
+}
+
+func (a *vaultAuthenticator) do(ctx context.Context, httpClient *http.Client, method, path, token string, body, out interface{}) error {
+	req, err := newJSONRequest(ctx, method, strings.TrimRight(a.Provider.Address, "/")+"/v1/"+strings.TrimLeft(path, "/"), body)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if a.Provider.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", a.Provider.Namespace)
+	}
+
+	return doJSON(ctx, httpClient, req, out)
+}
+
+// getVaultField returns the string value of a field of the secret
+func getVaultField(data map[string]interface{}, field, defaultField string, required bool) (string, error) {
+	if field == "" {
+		field = defaultField
+	}
+	value, ok := data[field]
+	if !ok {
+		if required {
+			return "", fmt.Errorf("field %q not found in the Vault secret", field)
+		}
+		return "", nil
+	}
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("field %q of the Vault secret isn't a string", field)
+	}
+
+	return s, nil
+}
@@ -0,0 +1,227 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/astrokube/registry-controller/api/v1alpha1"
+)
+
+// newFakeVault returns a server implementing the login of the Kubernetes auth
+// method, a KV v2 secret and a secrets engine plugin path
+func newFakeVault() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/auth/kubernetes/login", func(w http.ResponseWriter, r *http.Request) {
+		request := vaultLoginRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Role != "registry" || request.JWT != "jwt" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		w.Write([]byte(`{"auth":{"client_token":"s.token","lease_duration":3600}}`))
+	})
+	authorized := func(handler http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-Vault-Token") != "s.token" {
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte(`{"errors":["permission denied"]}`))
+				return
+			}
+			handler(w, r)
+		}
+	}
+	mux.HandleFunc("/v1/secret/data/registry", authorized(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"lease_duration":0,"data":{"data":{"user":"admin","password":"secret","registry":"registry.example.com"},"metadata":{"version":1}}}`))
+	}))
+	mux.HandleFunc("/v1/harbor/creds/robot", authorized(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"lease_id":"harbor/creds/robot/1","lease_duration":600,"data":{"username":"robot$ci","password":"token"}}`))
+	}))
+
+	return httptest.NewTLSServer(mux)
+}
+
+var _ = Describe("Vault provider", func() {
+	var (
+		server    *httptest.Server
+		requested []string
+	)
+
+	// tokens returns the jwt token for the registry service account of the
+	// team namespace
+	tokens := func(ctx context.Context, namespace, name string, audiences []string) (string, error) {
+		requested = append(requested, namespace+"/"+name)
+		Expect(audiences).To(Equal(VaultTokenAudiences))
+		if namespace != "team" || name != "registry" {
+			return "other", nil
+		}
+		return "jwt", nil
+	}
+
+	BeforeEach(func() {
+		server = newFakeVault()
+		VaultAddresses = []string{server.URL}
+		VaultTokenAudiences = []string{"vault"}
+		requested = nil
+	})
+
+	AfterEach(func() {
+		server.Close()
+		VaultAddresses = nil
+		VaultTokenAudiences = nil
+	})
+
+	getToken := func(provider *v1alpha1.VaultProvider) (*Result, error) {
+		provider.Address = server.URL
+		provider.CABundle = certificatePEM(server.Certificate())
+		if provider.ServiceAccountName == "" {
+			provider.ServiceAccountName = "registry"
+		}
+		return NewVaultAuthenticator(tokens, provider).GetToken(context.Background(), log.Log, &v1alpha1.RegistryCredentials{
+			ObjectMeta: metav1.ObjectMeta{Name: "sample", Namespace: "team"},
+		})
+	}
+
+	Context("When reading a KV v2 secret", func() {
+		It("Should map the fields to the credentials", func() {
+			result, err := getToken(&v1alpha1.VaultProvider{
+				Role:   "registry",
+				Path:   "secret/data/registry",
+				Fields: v1alpha1.VaultFields{Username: "user"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Registry).To(Equal("registry.example.com"))
+			Expect(result.Token).To(Equal("YWRtaW46c2VjcmV0"))
+			Expect(result.ExpiresAt).To(BeNil())
+			Expect(requested).To(Equal([]string{"team/registry"}))
+		})
+
+		It("Should fail when a field is missing", func() {
+			_, err := getToken(&v1alpha1.VaultProvider{Role: "registry", Path: "secret/data/registry"})
+			Expect(err).To(MatchError(ContainSubstring(`field "username" not found`)))
+		})
+	})
+
+	Context("When reading a secrets engine plugin", func() {
+		It("Should honor the lease duration", func() {
+			result, err := getToken(&v1alpha1.VaultProvider{
+				Role:     "registry",
+				Path:     "/harbor/creds/robot",
+				Registry: "harbor.example.com",
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Registry).To(Equal("harbor.example.com"))
+			Expect(result.Token).To(Equal("cm9ib3QkY2k6dG9rZW4="))
+			Expect(result.ExpiresAt).NotTo(BeNil())
+			Expect(*result.ExpiresAt).To(BeTemporally("~", time.Now().Add(10*time.Minute), time.Minute))
+		})
+
+		It("Should fail without registry", func() {
+			_, err := getToken(&v1alpha1.VaultProvider{Role: "registry", Path: "harbor/creds/robot"})
+			Expect(err).To(MatchError(ContainSubstring("no registry")))
+		})
+	})
+
+	Context("When the login is rejected", func() {
+		It("Should return an UnauthorizedError", func() {
+			_, err := getToken(&v1alpha1.VaultProvider{Role: "other", Path: "secret/data/registry"})
+			Expect(IsUnauthorized(err)).To(BeTrue())
+		})
+
+		It("Should use the default service account of the namespace", func() {
+			provider := &v1alpha1.VaultProvider{Address: server.URL, CABundle: certificatePEM(server.Certificate()), Role: "registry", Path: "secret/data/registry"}
+			_, err := NewVaultAuthenticator(tokens, provider).GetToken(context.Background(), log.Log, &v1alpha1.RegistryCredentials{
+				ObjectMeta: metav1.ObjectMeta{Name: "sample", Namespace: "team"},
+			})
+			Expect(IsUnauthorized(err)).To(BeTrue())
+			Expect(requested).To(Equal([]string{"team/default"}))
+		})
+	})
+
+	Context("When the address isn't allowed by the operator", func() {
+		It("Should not send the token", func() {
+			VaultAddresses = []string{"https://vault.example.com"}
+			_, err := getToken(&v1alpha1.VaultProvider{Role: "registry", Path: "secret/data/registry"})
+			Expect(err).To(MatchError(ContainSubstring("allowed by the operator")))
+			Expect(requested).To(BeEmpty())
+		})
+	})
+
+	Context("When validating the provider", func() {
+		newRegistryCredentials := func(address string) *v1alpha1.RegistryCredentials {
+			return &v1alpha1.RegistryCredentials{Spec: v1alpha1.RegistryCredentialsSpec{
+				Provider: v1alpha1.RegistryProvider{Vault: &v1alpha1.VaultProvider{Address: address, Role: "registry", Path: "secret/data/registry"}},
+			}}
+		}
+
+		It("Should only accept the addresses allowed by the operator", func() {
+			VaultAddresses = []string{"https://vault.example.com:8200"}
+			Expect(Validate(newRegistryCredentials("https://vault.example.com:8200/"))).To(Succeed())
+			Expect(Validate(newRegistryCredentials("https://attacker.example.com"))).NotTo(Succeed())
+			Expect(Validate(newRegistryCredentials("http://vault.example.com:8200"))).NotTo(Succeed())
+
+			VaultAddresses = nil
+			Expect(Validate(newRegistryCredentials("https://vault.example.com:8200"))).To(MatchError(ContainSubstring("no Vault address is allowed")))
+		})
+
+		It("Should only allow HTTPS addresses", func() {
+			addresses, err := ParseVaultAddresses("https://vault.example.com:8200/, https://vault.example.org")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(addresses).To(Equal([]string{"https://vault.example.com:8200", "https://vault.example.org"}))
+			_, err = ParseVaultAddresses("http://vault.example.com:8200")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("When requesting the tokens of the service accounts", func() {
+		It("Should request short-lived tokens of the service account", func() {
+			clientset := fake.NewSimpleClientset()
+			clientset.PrependReactor("create", "serviceaccounts", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				create := action.(k8stesting.CreateAction)
+				Expect(create.GetSubresource()).To(Equal("token"))
+				Expect(create.GetNamespace()).To(Equal("team"))
+				tokenRequest := create.GetObject().(*authenticationv1.TokenRequest)
+				Expect(tokenRequest.Spec.Audiences).To(Equal([]string{"vault"}))
+				Expect(*tokenRequest.Spec.ExpirationSeconds).To(BeEquivalentTo(600))
+				tokenRequest.Status.Token = "jwt"
+				return true, tokenRequest, nil
+			})
+
+			token, err := NewTokenRequester(clientset.CoreV1())(context.Background(), "team", "registry", []string{"vault"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(token).To(Equal("jwt"))
+		})
+	})
+})
+
+var _ = Describe("Result", func() {
+
+	Context("When scheduling the refresh of the token", func() {
+		now := time.Now()
+		expiresIn := func(d time.Duration) *time.Time {
+			expiresAt := now.Add(d)
+			return &expiresAt
+		}
+
+		It("Should use the interval for tokens without expiration or expiring later", func() {
+			Expect(Result{}.RefreshAfter(now, 30*time.Minute)).To(Equal(30 * time.Minute))
+			Expect(Result{ExpiresAt: expiresIn(12 * time.Hour)}.RefreshAfter(now, 30*time.Minute)).To(Equal(30 * time.Minute))
+		})
+
+		It("Should refresh short-lived tokens before they expire", func() {
+			Expect(Result{ExpiresAt: expiresIn(10 * time.Minute)}.RefreshAfter(now, 30*time.Minute)).To(Equal(8 * time.Minute))
+			Expect(Result{ExpiresAt: expiresIn(-time.Minute)}.RefreshAfter(now, 30*time.Minute)).To(Equal(minRefreshInterval))
+		})
+	})
+})
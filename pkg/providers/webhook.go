@@ -0,0 +1,143 @@
+package providers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/astrokube/registry-controller/api/v1alpha1"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func init() {
+	Register(Provider{
+		Name:        "webhookProvider",
+		DisplayName: "Webhook",
+		Factory: func(reader client.Reader, registryCredentials *v1alpha1.RegistryCredentials) (Authenticator, error) {
+			return NewWebhookAuthenticator(reader, registryCredentials.Spec.Provider.WebhookProvider), nil
+		},
+		Validator: validateWebhook,
+	})
+}
+
+func validateWebhook(registryCredentials *v1alpha1.RegistryCredentials) error {
+	provider := registryCredentials.Spec.Provider.WebhookProvider
+	if err := checkURL("url", provider.URL); err != nil {
+		return err
+	}
+	if provider.Registry == "" {
+		return errors.New("registry is required")
+	}
+	if len(provider.CABundle) > 0 && !x509.NewCertPool().AppendCertsFromPEM(provider.CABundle) {
+		return errors.New("caBundle doesn't contain any PEM encoded certificate")
+	}
+
+	return nil
+}
+
+// webhookRequest is the body POSTed to the endpoint
+type webhookRequest struct {
+	Registry  string `json:"registry"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+// webhookResponse is the body returned by the endpoint
+type webhookResponse struct {
+	Auths     map[string]webhookAuth `json:"auths"`
+	ExpiresAt *time.Time             `json:"expiresAt,omitempty"`
+}
+
+// webhookAuth is an entry of the Docker config, with either the auth token or
+// the username and password
+type webhookAuth struct {
+	Auth     string `json:"auth,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+func NewWebhookAuthenticator(reader client.Reader, provider *v1alpha1.WebhookProvider) Authenticator {
+	return &webhookAuthenticator{
+		Reader:   reader,
+		Provider: provider,
+	}
+}
+
+type webhookAuthenticator struct {
+	Reader   client.Reader
+	Provider *v1alpha1.WebhookProvider
+}
+
+func (a *webhookAuthenticator) GetToken(ctx context.Context, log logr.Logger, registryCredentials *v1alpha1.RegistryCredentials) (*Result, error) {
+	// The URL is checked again, as the allowed URLs can change after the
+	// RegistryCredentials are created
+	if err := checkURL("url", a.Provider.URL); err != nil {
+		return nil, err
+	}
+	httpClient, err := a.getHTTPClient(ctx, registryCredentials.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	defer httpClient.CloseIdleConnections()
+
+	req, err := newJSONRequest(ctx, http.MethodPost, a.Provider.URL, webhookRequest{
+		Registry:  a.Provider.Registry,
+		Namespace: registryCredentials.Namespace,
+		Name:      registryCredentials.Name,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if a.Provider.BearerTokenSecretRef != nil {
+		token, err := getSecretKey(ctx, a.Reader, registryCredentials.Namespace, a.Provider.BearerTokenSecretRef)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	response := &webhookResponse{}
+	if err := doJSON(ctx, httpClient, req, response); err != nil {
+		log.Info("Webhook request failed", "url", req.URL.Redacted())
+		return nil, err
+	}
+	if len(response.Auths) == 0 {
+		return nil, errors.New("the webhook didn't return any auth")
+	}
+
+	result := &Result{Auths: map[string]string{}, ExpiresAt: response.ExpiresAt}
+	for registry, auth := range response.Auths {
+		if auth.Auth != "" {
+			result.Auths[registry] = auth.Auth
+			continue
+		}
+		result.Auths[registry] = base64.StdEncoding.EncodeToString([]byte(auth.Username + ":" + auth.Password))
+	}
+
+	return result, nil
+}
+
+func (a *webhookAuthenticator) getHTTPClient(ctx context.Context, namespace string) (*http.Client, error) {
+	certificates := []tls.Certificate{}
+	if a.Provider.ClientCertificateSecretRef != nil {
+		secret, err := getSecret(ctx, a.Reader, namespace, a.Provider.ClientCertificateSecretRef.Name)
+		if err != nil {
+			return nil, err
+		}
+		certificate, err := tls.X509KeyPair(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate from Secret %q: %w", secret.Name, err)
+		}
+		certificates = append(certificates, certificate)
+	}
+
+	return newHTTPClient(a.Provider.CABundle, certificates...)
+}
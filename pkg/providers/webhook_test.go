@@ -0,0 +1,244 @@
+package providers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/astrokube/registry-controller/api/v1alpha1"
+)
+
+// newClientCertificate returns a self-signed CA and a client certificate and
+// key signed by it, PEM encoded
+func newClientCertificate() (*x509.Certificate, []byte, []byte) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	Expect(err).NotTo(HaveOccurred())
+	ca, err := x509.ParseCertificate(caDER)
+	Expect(err).NotTo(HaveOccurred())
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "registry-controller"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	Expect(err).NotTo(HaveOccurred())
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	Expect(err).NotTo(HaveOccurred())
+
+	return ca,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func certificatePEM(certificate *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw})
+}
+
+var _ = Describe("Webhook provider", func() {
+	var (
+		server   *httptest.Server
+		handler  http.HandlerFunc
+		requests []webhookRequest
+	)
+
+	registryCredentials := &v1alpha1.RegistryCredentials{
+		ObjectMeta: metav1.ObjectMeta{Name: "sample", Namespace: "default"},
+	}
+
+	getToken := func(reader client.Reader, provider *v1alpha1.WebhookProvider) (*Result, error) {
+		return NewWebhookAuthenticator(reader, provider).GetToken(context.Background(), log.Log, registryCredentials)
+	}
+
+	BeforeEach(func() {
+		requests = nil
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			request := webhookRequest{}
+			Expect(json.NewDecoder(r.Body).Decode(&request)).To(Succeed())
+			requests = append(requests, request)
+			if r.Header.Get("Authorization") != "Bearer token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"auths":{"registry.example.com":{"username":"user","password":"pass"},"mirror.example.com":{"auth":"dXNlcjpwYXNz"}},"expiresAt":"2030-01-01T00:00:00Z"}`))
+		}
+		server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handler(w, r)
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+		AllowedURLs = nil
+	})
+
+	// newProvider returns the provider of the started server, which is allowed
+	// by the operator
+	newProvider := func() *v1alpha1.WebhookProvider {
+		AllowedURLs = []string{server.URL}
+		return &v1alpha1.WebhookProvider{
+			URL:                  server.URL,
+			Registry:             "registry.example.com",
+			CABundle:             certificatePEM(server.Certificate()),
+			BearerTokenSecretRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "webhook"}, Key: "token"},
+		}
+	}
+
+	tokenSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "webhook", Namespace: "default"},
+		Data:       map[string][]byte{"token": []byte("token\n")},
+	}
+
+	Context("When the endpoint returns credentials", func() {
+		It("Should send the request and return the auths", func() {
+			server.StartTLS()
+
+			result, err := getToken(fake.NewClientBuilder().WithObjects(tokenSecret).Build(), newProvider())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requests).To(Equal([]webhookRequest{{Registry: "registry.example.com", Namespace: "default", Name: "sample"}}))
+			Expect(result.Auths).To(Equal(map[string]string{
+				"registry.example.com": "dXNlcjpwYXNz",
+				"mirror.example.com":   "dXNlcjpwYXNz",
+			}))
+			Expect(result.ExpiresAt).NotTo(BeNil())
+			Expect(result.ExpiresAt.Equal(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC))).To(BeTrue())
+		})
+
+		It("Should authenticate with the client certificate", func() {
+			ca, certificate, key := newClientCertificate()
+			clientCAs := x509.NewCertPool()
+			clientCAs.AddCert(ca)
+			server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+			server.StartTLS()
+
+			provider := newProvider()
+			provider.ClientCertificateSecretRef = &corev1.LocalObjectReference{Name: "client"}
+			reader := fake.NewClientBuilder().WithObjects(tokenSecret, &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "client", Namespace: "default"},
+				Type:       corev1.SecretTypeTLS,
+				Data:       map[string][]byte{corev1.TLSCertKey: certificate, corev1.TLSPrivateKeyKey: key},
+			}).Build()
+
+			_, err := getToken(reader, provider)
+			Expect(err).NotTo(HaveOccurred())
+
+			provider.ClientCertificateSecretRef = nil
+			_, err = getToken(reader, provider)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("When the endpoint can't be trusted or rejects the request", func() {
+		It("Should fail without the CA of the endpoint", func() {
+			server.StartTLS()
+			provider := newProvider()
+			provider.CABundle = nil
+
+			_, err := getToken(fake.NewClientBuilder().WithObjects(tokenSecret).Build(), provider)
+			Expect(err).To(HaveOccurred())
+			Expect(requests).To(BeEmpty())
+		})
+
+		It("Should return an UnauthorizedError when the token is rejected", func() {
+			server.StartTLS()
+
+			_, err := getToken(fake.NewClientBuilder().WithObjects(&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "webhook", Namespace: "default"},
+				Data:       map[string][]byte{"token": []byte("invalid")},
+			}).Build(), newProvider())
+			Expect(IsUnauthorized(err)).To(BeTrue())
+		})
+
+		It("Should not return the body of the response", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte("internal details"))
+			}
+			server.StartTLS()
+
+			_, err := getToken(fake.NewClientBuilder().WithObjects(tokenSecret).Build(), newProvider())
+			Expect(err).To(MatchError(ContainSubstring("500 Internal Server Error")))
+			Expect(err.Error()).NotTo(ContainSubstring("internal details"))
+		})
+
+		It("Should fail when the bearer token Secret doesn't exist", func() {
+			server.StartTLS()
+
+			_, err := getToken(fake.NewClientBuilder().Build(), newProvider())
+			Expect(err).To(MatchError(ContainSubstring(`getting Secret "webhook"`)))
+		})
+	})
+
+	Context("When validating the provider", func() {
+		It("Should only accept HTTPS endpoints", func() {
+			newRegistryCredentials := func(url string) *v1alpha1.RegistryCredentials {
+				return &v1alpha1.RegistryCredentials{Spec: v1alpha1.RegistryCredentialsSpec{
+					Provider: v1alpha1.RegistryProvider{WebhookProvider: &v1alpha1.WebhookProvider{URL: url, Registry: "registry.example.com"}},
+				}}
+			}
+			AllowedURLs = []string{"https://tokens.example.com", "http://tokens.example.com"}
+			Expect(Validate(newRegistryCredentials("https://tokens.example.com/registry"))).To(Succeed())
+			Expect(Validate(newRegistryCredentials("http://tokens.example.com/registry"))).NotTo(Succeed())
+		})
+
+		It("Should only accept the URLs allowed by the operator", func() {
+			newRegistryCredentials := func(url string) *v1alpha1.RegistryCredentials {
+				return &v1alpha1.RegistryCredentials{Spec: v1alpha1.RegistryCredentialsSpec{
+					Provider: v1alpha1.RegistryProvider{WebhookProvider: &v1alpha1.WebhookProvider{URL: url, Registry: "registry.example.com"}},
+				}}
+			}
+			Expect(Validate(newRegistryCredentials("https://tokens.example.com/registry"))).To(MatchError(ContainSubstring("allowed by the operator")))
+
+			AllowedURLs = []string{"https://tokens.example.com"}
+			Expect(Validate(newRegistryCredentials("https://tokens.example.com"))).To(Succeed())
+			Expect(Validate(newRegistryCredentials("https://tokens.example.com/registry"))).To(Succeed())
+			Expect(Validate(newRegistryCredentials("https://tokens.example.com.evil.com/registry"))).NotTo(Succeed())
+			Expect(Validate(newRegistryCredentials("https://tokens.example.com@evil.com/registry"))).NotTo(Succeed())
+			Expect(Validate(newRegistryCredentials("https://metadata.internal/registry"))).NotTo(Succeed())
+		})
+
+		It("Should not send requests to URLs that aren't allowed anymore", func() {
+			server.StartTLS()
+			provider := newProvider()
+			AllowedURLs = nil
+
+			_, err := getToken(fake.NewClientBuilder().WithObjects(tokenSecret).Build(), provider)
+			Expect(err).To(MatchError(ContainSubstring("allowed by the operator")))
+			Expect(requests).To(BeEmpty())
+		})
+	})
+})
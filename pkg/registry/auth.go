@@ -0,0 +1,61 @@
+package registry
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+)
+
+type dockerConfigJSON struct {
+	Auths map[string]dockerConfigEntry `json:"auths"`
+}
+
+type dockerConfigEntry struct {
+	Auth     string `json:"auth"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// AuthFor returns the auth of the content of a kubernetes.io/dockerconfigjson
+// Secret for the image, as the base64 encoded username and password. Like the
+// kubelet, the entry whose host or prefix is the longest match of the image is
+// used. It returns an empty auth when no entry matches.
+func AuthFor(dockerConfig []byte, ref Reference) (string, error) {
+	config := dockerConfigJSON{}
+	if err := json.Unmarshal(dockerConfig, &config); err != nil {
+		return "", err
+	}
+
+	name := ref.Name()
+	auth := ""
+	longest := -1
+	for key, entry := range config.Auths {
+		prefix := normalizeAuthKey(key)
+		if name != prefix && !strings.HasPrefix(name, prefix+"/") {
+			continue
+		}
+		if len(prefix) <= longest {
+			continue
+		}
+		longest = len(prefix)
+		auth = entry.Auth
+		if auth == "" && entry.Username != "" {
+			auth = base64.StdEncoding.EncodeToString([]byte(entry.Username + ":" + entry.Password))
+		}
+	}
+
+	return auth, nil
+}
+
+// normalizeAuthKey returns the host or prefix of a dockerconfigjson entry,
+// which can be a URL like https://index.docker.io/v1/
+func normalizeAuthKey(key string) string {
+	key = strings.TrimPrefix(strings.TrimPrefix(key, "https://"), "http://")
+	key = strings.TrimSuffix(key, "/")
+	key = strings.TrimSuffix(strings.TrimSuffix(key, "/v1"), "/v2")
+	if key == "index.docker.io" || key == dockerHubEndpoint {
+		return DockerHubRegistry
+	}
+
+	return key
+}
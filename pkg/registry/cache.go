@@ -0,0 +1,73 @@
+package registry
+
+import (
+	"sync"
+	"time"
+)
+
+// maxCacheEntries bounds the number of entries of a Cache
+const maxCacheEntries = 10000
+
+// Cache keeps the results of the requests to the registries for a TTL
+type Cache struct {
+	TTL time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	Value     interface{}
+	ExpiresAt time.Time
+}
+
+// NewCache returns a cache whose entries expire after the TTL, or after the
+// default TTL when the TTL isn't positive
+func NewCache(ttl, defaultTTL time.Duration) *Cache {
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+
+	return &Cache{
+		TTL:     ttl,
+		entries: map[string]cacheEntry{},
+	}
+}
+
+// Get returns the value of the key, if it hasn't expired
+func (c *Cache) Get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.ExpiresAt) {
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	return entry.Value, true
+}
+
+// Set sets the value of the key. Expired entries are dropped when the cache is
+// full, and all of them if it is still full.
+func (c *Cache) Set(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = map[string]cacheEntry{}
+	}
+	if len(c.entries) >= maxCacheEntries {
+		now := time.Now()
+		for k, entry := range c.entries {
+			if now.After(entry.ExpiresAt) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= maxCacheEntries {
+			c.entries = map[string]cacheEntry{}
+		}
+	}
+	c.entries[key] = cacheEntry{Value: value, ExpiresAt: time.Now().Add(c.TTL)}
+}
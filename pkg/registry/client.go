@@ -0,0 +1,383 @@
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxManifestSize bounds the size of the manifests read from the
+	// registries
+	maxManifestSize = 4 << 20
+
+	// defaultTokenExpiry is the lifetime of the bearer tokens that don't
+	// report it, as defined by the token authentication specification
+	defaultTokenExpiry = 60 * time.Second
+)
+
+// manifestMediaTypes are the manifest formats accepted from the registries
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// Descriptor describes the content of a manifest or a blob
+type Descriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+// Error is returned for the unsuccessful responses of the registry
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// IsNotFound returns whether the error is a response of the registry for a
+// manifest or a blob that doesn't exist
+func IsNotFound(err error) bool {
+	var registryErr *Error
+	return errors.As(err, &registryErr) && registryErr.StatusCode == http.StatusNotFound
+}
+
+// IsUnauthorized returns whether the error is a response of the registry
+// rejecting the credentials
+func IsUnauthorized(err error) bool {
+	var registryErr *Error
+	return errors.As(err, &registryErr) && (registryErr.StatusCode == http.StatusUnauthorized || registryErr.StatusCode == http.StatusForbidden)
+}
+
+// Client is a client of the read operations of the Docker Registry HTTP API
+// V2, which is also the OCI distribution API. It authenticates with basic
+// auth or with the bearer tokens of the token authentication specification,
+// as the registry challenges. The bearer tokens are cached until they expire.
+type Client struct {
+	HTTPClient *http.Client
+
+	mu     sync.Mutex
+	tokens map[string]bearerToken
+}
+
+type bearerToken struct {
+	Token     string
+	ExpiresAt time.Time
+}
+
+// NewClient returns a client sending the requests with the given HTTP client,
+// or the default one when nil
+func NewClient(httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &Client{
+		HTTPClient: httpClient,
+		tokens:     map[string]bearerToken{},
+	}
+}
+
+// Head returns the descriptor of the manifest of the image. auth is the base64
+// encoded username and password, or empty for anonymous access.
+func (c *Client) Head(ctx context.Context, ref Reference, auth string) (*Descriptor, error) {
+	resp, err := c.do(ctx, http.MethodHead, ref, "manifests/"+ref.Identifier(), auth)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	return &Descriptor{
+		MediaType: resp.Header.Get("Content-Type"),
+		Digest:    resp.Header.Get("Docker-Content-Digest"),
+		Size:      resp.ContentLength,
+	}, nil
+}
+
+// GetManifest returns the descriptor and the content of the manifest of the
+// image. The content is verified when the image is referenced by digest.
+func (c *Client) GetManifest(ctx context.Context, ref Reference, auth string) (*Descriptor, []byte, error) {
+	resp, err := c.do(ctx, http.MethodGet, ref, "manifests/"+ref.Identifier(), auth)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	content, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxManifestSize+1))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(content) > maxManifestSize {
+		return nil, nil, fmt.Errorf("manifest of %s exceeds %d bytes", ref, maxManifestSize)
+	}
+	digest := Digest(content)
+	if ref.Digest != "" && ref.Digest != digest {
+		return nil, nil, fmt.Errorf("digest of the manifest of %s doesn't match, got %s", ref, digest)
+	}
+
+	return &Descriptor{
+		MediaType: resp.Header.Get("Content-Type"),
+		Digest:    digest,
+		Size:      int64(len(content)),
+	}, content, nil
+}
+
+// GetBlob returns the content of the blob of the repository of the image,
+// after verifying its digest. Blobs larger than maxSize are rejected.
+func (c *Client) GetBlob(ctx context.Context, ref Reference, digest string, maxSize int64, auth string) ([]byte, error) {
+	resp, err := c.do(ctx, http.MethodGet, ref, "blobs/"+digest, auth)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	content, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > maxSize {
+		return nil, fmt.Errorf("blob %s of %s exceeds %d bytes", digest, ref.Name(), maxSize)
+	}
+	if Digest(content) != digest {
+		return nil, fmt.Errorf("digest of the blob %s of %s doesn't match", digest, ref.Name())
+	}
+
+	return content, nil
+}
+
+// Resolve returns the digest of the manifest of the image. Registries that
+// don't report the digest in the HEAD responses are asked for the manifest.
+func (c *Client) Resolve(ctx context.Context, ref Reference, auth string) (string, error) {
+	if ref.Digest != "" {
+		return ref.Digest, nil
+	}
+
+	descriptor, err := c.Head(ctx, ref, auth)
+	if err != nil {
+		return "", err
+	}
+	if descriptor.Digest != "" {
+		return descriptor.Digest, nil
+	}
+	descriptor, _, err = c.GetManifest(ctx, ref, auth)
+	if err != nil {
+		return "", err
+	}
+
+	return descriptor.Digest, nil
+}
+
+// Digest returns the sha256 digest of the content
+func Digest(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// do sends the request to the path of the repository of the image, answering
+// the authentication challenge of the registry if needed.
+func (c *Client) do(ctx context.Context, method string, ref Reference, path string, auth string) (*http.Response, error) {
+	u := fmt.Sprintf("https://%s/v2/%s/%s", ref.endpoint(), ref.Repository, path)
+	scope := fmt.Sprintf("repository:%s:pull", ref.Repository)
+	tokenKey := strings.Join([]string{ref.endpoint(), scope, auth}, "\x00")
+
+	authorization := ""
+	if token, ok := c.getToken(tokenKey); ok {
+		authorization = "Bearer " + token
+	}
+	resp, err := c.send(ctx, method, u, authorization)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		scheme, params := parseChallenge(challenge)
+		switch strings.ToLower(scheme) {
+		case "basic":
+			if auth == "" {
+				return nil, &Error{StatusCode: http.StatusUnauthorized, Message: fmt.Sprintf("%s %s requires credentials", method, u)}
+			}
+			authorization = "Basic " + auth
+		case "bearer":
+			if params["scope"] == "" {
+				params["scope"] = scope
+			}
+			token, err := c.fetchToken(ctx, params, auth)
+			if err != nil {
+				return nil, err
+			}
+			c.setToken(tokenKey, *token)
+			authorization = "Bearer " + token.Token
+		default:
+			return nil, &Error{StatusCode: http.StatusUnauthorized, Message: fmt.Sprintf("%s %s returned an unsupported challenge %q", method, u, challenge)}
+		}
+		if resp, err = c.send(ctx, method, u, authorization); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := checkResponse(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (c *Client) send(ctx context.Context, method, u, authorization string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	return c.HTTPClient.Do(req)
+}
+
+// fetchToken gets a bearer token from the realm of the challenge, presenting
+// the credentials when there are
+func (c *Client) fetchToken(ctx context.Context, params map[string]string, auth string) (*bearerToken, error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || realm.Host == "" {
+		return nil, fmt.Errorf("invalid realm %q in the challenge of the registry", params["realm"])
+	}
+	query := realm.Query()
+	for _, key := range []string{"service", "scope"} {
+		if params[key] != "" {
+			query.Set(key, params[key])
+		}
+	}
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if auth != "" {
+		req.Header.Set("Authorization", "Basic "+auth)
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp); err != nil {
+		return nil, err
+	}
+
+	body := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxManifestSize)).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decoding token of %s: %w", realm.Redacted(), err)
+	}
+	token := bearerToken{Token: body.Token, ExpiresAt: time.Now().Add(defaultTokenExpiry)}
+	if token.Token == "" {
+		token.Token = body.AccessToken
+	}
+	if body.ExpiresIn > 0 {
+		token.ExpiresAt = time.Now().Add(time.Duration(body.ExpiresIn) * time.Second)
+	}
+
+	return &token, nil
+}
+
+func (c *Client) getToken(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	token, ok := c.tokens[key]
+	if !ok || time.Now().After(token.ExpiresAt) {
+		return "", false
+	}
+
+	return token.Token, true
+}
+
+func (c *Client) setToken(key string, token bearerToken) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.tokens == nil {
+		c.tokens = map[string]bearerToken{}
+	}
+	// Drop the expired tokens, so the map doesn't grow with the repositories
+	now := time.Now()
+	for k, t := range c.tokens {
+		if now.After(t.ExpiresAt) {
+			delete(c.tokens, k)
+		}
+	}
+	c.tokens[key] = token
+}
+
+// checkResponse returns an Error for the unsuccessful responses, without the
+// body of the response, as the errors are reported in the conditions of the
+// RegistryCredentials and the admission responses
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	return &Error{
+		StatusCode: resp.StatusCode,
+		Message:    fmt.Sprintf("%s %s returned %s", resp.Request.Method, resp.Request.URL.Redacted(), resp.Status),
+	}
+}
+
+// parseChallenge returns the scheme and the parameters of a WWW-Authenticate
+// header, like Bearer realm="https://auth.docker.io/token",service="registry.docker.io"
+func parseChallenge(challenge string) (string, map[string]string) {
+	params := map[string]string{}
+	parts := strings.SplitN(strings.TrimSpace(challenge), " ", 2)
+	if len(parts) < 2 {
+		return parts[0], params
+	}
+
+	rest := parts[1]
+	for rest != "" {
+		rest = strings.TrimLeft(rest, " ,")
+		i := strings.Index(rest, "=")
+		if i < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:i]))
+		rest = rest[i+1:]
+		value := ""
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else if end := strings.Index(rest, ","); end >= 0 {
+			value, rest = rest[:end], rest[end:]
+		} else {
+			value, rest = rest, ""
+		}
+		params[key] = value
+	}
+
+	return parts[0], params
+}
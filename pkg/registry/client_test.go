@@ -0,0 +1,84 @@
+package registry_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/astrokube/registry-controller/pkg/registry"
+	"github.com/astrokube/registry-controller/pkg/registry/registrytest"
+)
+
+var _ = Describe("Client", func() {
+	var (
+		server *registrytest.Server
+		client *registry.Client
+	)
+
+	BeforeEach(func() {
+		server = registrytest.NewServer("user", "password")
+		client = registry.NewClient(server.Client())
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	reference := func(image string) registry.Reference {
+		ref, err := registry.ParseReference(server.Host() + "/" + image)
+		Expect(err).NotTo(HaveOccurred())
+		return ref
+	}
+
+	Context("When the credentials are valid", func() {
+		It("Should resolve the digest of a tag", func() {
+			digest := server.PushImage("team/app", "1.0")
+
+			resolved, err := client.Resolve(context.Background(), reference("team/app:1.0"), server.Auth())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resolved).To(Equal(digest))
+		})
+
+		It("Should verify the content of the manifests referenced by digest", func() {
+			digest := server.PushImage("team/app", "1.0")
+
+			descriptor, content, err := client.GetManifest(context.Background(), reference("team/app@"+digest), server.Auth())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(descriptor.Digest).To(Equal(digest))
+			Expect(registry.Digest(content)).To(Equal(digest))
+		})
+
+		It("Should return a not found error for missing tags", func() {
+			_, err := client.Head(context.Background(), reference("team/app:missing"), server.Auth())
+			Expect(registry.IsNotFound(err)).To(BeTrue())
+		})
+	})
+
+	Context("When the credentials are invalid", func() {
+		It("Should return an unauthorized error", func() {
+			server.PushImage("team/app", "1.0")
+
+			_, err := client.Head(context.Background(), reference("team/app:1.0"), "invalid")
+			Expect(registry.IsUnauthorized(err)).To(BeTrue())
+		})
+	})
+
+	Context("When selecting the credentials of an image", func() {
+		It("Should use the longest matching entry of the dockerconfigjson", func() {
+			dockerConfig := []byte(`{"auths":{"https://index.docker.io/v1/":{"auth":"aHVi"},"harbor.example.com":{"auth":"aGFyYm9y"},"harbor.example.com/dockerhub":{"username":"mirror","password":"secret"}}}`)
+			authFor := func(image string) string {
+				ref, err := registry.ParseReference(image)
+				Expect(err).NotTo(HaveOccurred())
+				auth, err := registry.AuthFor(dockerConfig, ref)
+				Expect(err).NotTo(HaveOccurred())
+				return auth
+			}
+
+			Expect(authFor("nginx")).To(Equal("aHVi"))
+			Expect(authFor("harbor.example.com/library/app:1")).To(Equal("aGFyYm9y"))
+			Expect(authFor("harbor.example.com/dockerhub/library/nginx")).To(Equal("bWlycm9yOnNlY3JldA=="))
+			Expect(authFor("quay.io/org/app")).To(BeEmpty())
+		})
+	})
+})
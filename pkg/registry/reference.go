@@ -0,0 +1,122 @@
+package registry
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// DockerHubRegistry is the registry of the images without registry, like
+	// nginx or bitnami/redis
+	DockerHubRegistry = "docker.io"
+
+	// dockerHubEndpoint is the host serving the registry API of Docker Hub
+	dockerHubEndpoint = "registry-1.docker.io"
+)
+
+// digestRegexp matches the digests of the content addressable references
+var digestRegexp = regexp.MustCompile(`^[a-z0-9]+(?:[.+_-][a-z0-9]+)*:[a-zA-Z0-9=_-]+$`)
+
+// Reference is a reference to an image in a registry
+type Reference struct {
+	// Registry is the host of the registry, with its port if any
+	Registry string
+	// Repository is the path of the repository in the registry
+	Repository string
+	// Tag is the tag of the image, if any
+	Tag string
+	// Digest is the digest of the image, if any
+	Digest string
+}
+
+// ParseReference parses an image like the container runtime resolves it:
+// images without registry are pulled from Docker Hub, the official images of
+// Docker Hub are in the library namespace and the default tag is latest.
+func ParseReference(image string) (Reference, error) {
+	ref := Reference{}
+	name := image
+	if i := strings.Index(name, "@"); i >= 0 {
+		ref.Digest = name[i+1:]
+		name = name[:i]
+		if !digestRegexp.MatchString(ref.Digest) {
+			return ref, fmt.Errorf("invalid digest in image %q", image)
+		}
+	}
+	if i := strings.LastIndex(name, ":"); i >= 0 && !strings.Contains(name[i+1:], "/") {
+		ref.Tag = name[i+1:]
+		name = name[:i]
+	}
+
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) == 1 || (!strings.ContainsAny(parts[0], ".:") && parts[0] != "localhost") {
+		parts = []string{DockerHubRegistry, name}
+	}
+	if parts[0] == "index.docker.io" {
+		parts[0] = DockerHubRegistry
+	}
+	if parts[0] == DockerHubRegistry && !strings.Contains(parts[1], "/") {
+		parts[1] = "library/" + parts[1]
+	}
+	ref.Registry = parts[0]
+	ref.Repository = parts[1]
+
+	if ref.Repository == "" || ref.Repository != strings.ToLower(ref.Repository) {
+		return ref, fmt.Errorf("invalid repository in image %q", image)
+	}
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = "latest"
+	}
+
+	return ref, nil
+}
+
+// Name returns the registry and the repository of the reference
+func (r Reference) Name() string {
+	return r.Registry + "/" + r.Repository
+}
+
+// Identifier returns the digest of the reference, or its tag if it doesn't
+// have a digest
+func (r Reference) Identifier() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+
+	return r.Tag
+}
+
+// String returns the normalized image of the reference
+func (r Reference) String() string {
+	image := r.Name()
+	if r.Tag != "" {
+		image += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		image += "@" + r.Digest
+	}
+
+	return image
+}
+
+// endpoint returns the host serving the registry API
+func (r Reference) endpoint() string {
+	if r.Registry == DockerHubRegistry {
+		return dockerHubEndpoint
+	}
+
+	return r.Registry
+}
+
+// TrimTagAndDigest returns the image without its tag and digest, keeping the
+// rest of the image as written
+func TrimTagAndDigest(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i >= 0 && !strings.Contains(image[i+1:], "/") {
+		image = image[:i]
+	}
+
+	return image
+}
@@ -0,0 +1,30 @@
+package registry_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/astrokube/registry-controller/pkg/registry"
+)
+
+var _ = Describe("Reference", func() {
+	It("Should parse the images like the container runtime", func() {
+		ref, err := registry.ParseReference("nginx")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ref).To(Equal(registry.Reference{Registry: "docker.io", Repository: "library/nginx", Tag: "latest"}))
+
+		ref, err = registry.ParseReference("registry:5000/team/app:1.0@sha256:abc")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ref).To(Equal(registry.Reference{Registry: "registry:5000", Repository: "team/app", Tag: "1.0", Digest: "sha256:abc"}))
+		Expect(ref.Identifier()).To(Equal("sha256:abc"))
+
+		_, err = registry.ParseReference("Invalid/App")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should trim the tag and the digest of the images", func() {
+		Expect(registry.TrimTagAndDigest("nginx:1")).To(Equal("nginx"))
+		Expect(registry.TrimTagAndDigest("registry:5000/app")).To(Equal("registry:5000/app"))
+		Expect(registry.TrimTagAndDigest("registry:5000/app:1@sha256:abc")).To(Equal("registry:5000/app"))
+	})
+})
@@ -0,0 +1,196 @@
+// Package registrytest provides an in-process registry implementing the read
+// operations of the Docker Registry HTTP API V2, for testing.
+package registrytest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/astrokube/registry-controller/pkg/registry"
+)
+
+// token is the bearer token issued by the token endpoint of the Server
+const token = "registrytest-token"
+
+// Server is a registry serving the manifests and blobs pushed to it. When a
+// username is set, the requests must be authenticated with a bearer token
+// issued for its credentials, like Docker Hub or Harbor.
+type Server struct {
+	*httptest.Server
+	Username string
+	Password string
+
+	mu        sync.Mutex
+	manifests map[string]manifest
+	blobs     map[string][]byte
+	requests  map[string]int
+}
+
+type manifest struct {
+	MediaType string
+	Content   []byte
+}
+
+// NewServer starts a TLS registry. Use its Client to trust its certificate.
+func NewServer(username, password string) *Server {
+	s := &Server{
+		Username:  username,
+		Password:  password,
+		manifests: map[string]manifest{},
+		blobs:     map[string][]byte{},
+		requests:  map[string]int{},
+	}
+	s.Server = httptest.NewTLSServer(http.HandlerFunc(s.serveHTTP))
+
+	return s
+}
+
+// Host returns the host of the registry, to be used in the images
+func (s *Server) Host() string {
+	return strings.TrimPrefix(s.URL, "https://")
+}
+
+// Auth returns the base64 encoded credentials of the registry
+func (s *Server) Auth() string {
+	return base64.StdEncoding.EncodeToString([]byte(s.Username + ":" + s.Password))
+}
+
+// DockerConfigJSON returns the content of a kubernetes.io/dockerconfigjson
+// Secret with the credentials of the registry
+func (s *Server) DockerConfigJSON() []byte {
+	data, _ := json.Marshal(map[string]interface{}{
+		"auths": map[string]interface{}{
+			s.Host(): map[string]string{"auth": s.Auth()},
+		},
+	})
+
+	return data
+}
+
+// PushManifest stores the manifest in the repository with the tag, if any, and
+// its digest. It returns the digest.
+func (s *Server) PushManifest(repository, tag, mediaType string, content []byte) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	digest := registry.Digest(content)
+	s.manifests[repository+"@"+digest] = manifest{MediaType: mediaType, Content: content}
+	if tag != "" {
+		s.manifests[repository+":"+tag] = manifest{MediaType: mediaType, Content: content}
+	}
+
+	return digest
+}
+
+// PushBlob stores the blob in the repository and returns its digest
+func (s *Server) PushBlob(repository string, content []byte) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	digest := registry.Digest(content)
+	s.blobs[repository+"@"+digest] = content
+
+	return digest
+}
+
+// PushImage stores an image with an empty config and no layers in the
+// repository with the tag, and returns the digest of its manifest
+func (s *Server) PushImage(repository, tag string) string {
+	config := []byte("{}")
+	content, _ := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     "application/vnd.oci.image.manifest.v1+json",
+		"config": registry.Descriptor{
+			MediaType: "application/vnd.oci.image.config.v1+json",
+			Digest:    s.PushBlob(repository, config),
+			Size:      int64(len(config)),
+		},
+		"layers": []registry.Descriptor{},
+	})
+
+	return s.PushManifest(repository, tag, "application/vnd.oci.image.manifest.v1+json", content)
+}
+
+// DeleteTag removes the tag from the repository
+func (s *Server) DeleteTag(repository, tag string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.manifests, repository+":"+tag)
+}
+
+// Requests returns the number of requests to the manifest of the repository
+// with the tag or digest
+func (s *Server) Requests(repository, reference string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests[repository+"/manifests/"+reference]
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/token" {
+		username, password, ok := r.BasicAuth()
+		if s.Username != "" && (!ok || username != s.Username || password != s.Password) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"token": token, "expires_in": 300})
+		return
+	}
+
+	if !strings.HasPrefix(r.URL.Path, "/v2/") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if s.Username != "" && r.Header.Get("Authorization") != "Bearer "+token {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registrytest"`, s.URL))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/v2/")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i := strings.LastIndex(path, "/manifests/"); i >= 0 {
+		repository, reference := path[:i], path[i+len("/manifests/"):]
+		s.requests[repository+"/manifests/"+reference]++
+		key := repository + ":" + reference
+		if strings.Contains(reference, ":") {
+			key = repository + "@" + reference
+		}
+		m, ok := s.manifests[key]
+		if !ok {
+			writeError(w, http.StatusNotFound, "MANIFEST_UNKNOWN")
+			return
+		}
+		w.Header().Set("Content-Type", m.MediaType)
+		w.Header().Set("Docker-Content-Digest", registry.Digest(m.Content))
+		w.Header().Set("Content-Length", fmt.Sprint(len(m.Content)))
+		if r.Method != http.MethodHead {
+			w.Write(m.Content)
+		}
+		return
+	}
+	if i := strings.LastIndex(path, "/blobs/"); i >= 0 {
+		blob, ok := s.blobs[path[:i]+"@"+path[i+len("/blobs/"):]]
+		if !ok {
+			writeError(w, http.StatusNotFound, "BLOB_UNKNOWN")
+			return
+		}
+		w.Write(blob)
+		return
+	}
+
+	w.WriteHeader(http.StatusNotFound)
+}
+
+func writeError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"errors": []map[string]string{{"code": code, "message": strings.ToLower(strings.ReplaceAll(code, "_", " "))}},
+	})
+}
@@ -0,0 +1,110 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracerName  = "github.com/astrokube/registry-controller"
+	serviceName = "registry-operator"
+)
+
+// Tracer returns the tracer used by the operator. Spans are discarded until a
+// tracer provider is set up.
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// SetupOTLP sets up a global tracer provider that exports the spans to the
+// OTLP HTTP endpoint. The provider must be shut down to flush the spans.
+func SetupOTLP(ctx context.Context, endpoint string, insecure bool, sampleRatio float64) (*sdktrace.TracerProvider, error) {
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(endpoint)}
+	if insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return Setup(sdktrace.NewBatchSpanProcessor(exporter), sampleRatio), nil
+}
+
+// Setup sets up a global tracer provider that sends the spans to the given
+// processor. Tests can use a simple processor with an in-memory exporter. The
+// provider must be shut down to flush the spans.
+func Setup(processor sdktrace.SpanProcessor, sampleRatio float64) *sdktrace.TracerProvider {
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(processor),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return provider
+}
+
+// RecordError records the error in the span and marks it as failed.
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// TraceID returns the ID of the trace in the context, or an empty string if
+// the context has no sampled span.
+func TraceID(ctx context.Context) string {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() || !spanContext.IsSampled() {
+		return ""
+	}
+
+	return spanContext.TraceID().String()
+}
+
+// InstrumentAWSHandlers adds a span to every request made by an AWS SDK
+// client. The span is a child of the span in the context of the request, so
+// the context must be set with the WithContext methods of the clients.
+func InstrumentAWSHandlers(handlers *request.Handlers) {
+	handlers.Validate.PushFrontNamed(request.NamedHandler{
+		Name: "tracing.Start",
+		Fn: func(r *request.Request) {
+			ctx, _ := Tracer().Start(r.Context(), fmt.Sprintf("%s.%s", r.ClientInfo.ServiceName, r.Operation.Name),
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(
+					attribute.String("aws.service", r.ClientInfo.ServiceName),
+					attribute.String("aws.operation", r.Operation.Name),
+					attribute.String("aws.region", aws.StringValue(r.Config.Region)),
+				),
+			)
+			r.SetContext(ctx)
+		},
+	})
+	handlers.Complete.PushBackNamed(request.NamedHandler{
+		Name: "tracing.End",
+		Fn: func(r *request.Request) {
+			span := trace.SpanFromContext(r.Context())
+			if r.HTTPResponse != nil {
+				span.SetAttributes(attribute.Int("http.status_code", r.HTTPResponse.StatusCode))
+			}
+			RecordError(span, r.Error)
+			span.End()
+		},
+	})
+}
@@ -0,0 +1,174 @@
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+
+	registryv1alpha1 "github.com/astrokube/registry-controller/api/v1alpha1"
+	"github.com/astrokube/registry-controller/pkg/metrics"
+	"github.com/astrokube/registry-controller/pkg/registry"
+)
+
+// DefaultDigestCacheTTL is the default time the digests resolved from the
+// image tags are cached
+const DefaultDigestCacheTTL = 5 * time.Minute
+
+// containerImage is the image of a container of a Pod spec
+type containerImage struct {
+	Container string
+	Image     *string
+}
+
+// containerImages returns the images of the containers of the spec
+func containerImages(spec *corev1.PodSpec) []containerImage {
+	images := []containerImage{}
+	for i := range spec.InitContainers {
+		images = append(images, containerImage{Container: spec.InitContainers[i].Name, Image: &spec.InitContainers[i].Image})
+	}
+	for i := range spec.Containers {
+		images = append(images, containerImage{Container: spec.Containers[i].Name, Image: &spec.Containers[i].Image})
+	}
+	for i := range spec.EphemeralContainers {
+		images = append(images, containerImage{Container: spec.EphemeralContainers[i].Name, Image: &spec.EphemeralContainers[i].Image})
+	}
+
+	return images
+}
+
+// changedContainerImages returns the images of the containers of the spec
+// that are new or whose image is different in the old spec
+func changedContainerImages(old, spec *corev1.PodSpec) []containerImage {
+	previous := map[string]string{}
+	for _, image := range containerImages(old) {
+		previous[image.Container] = *image.Image
+	}
+	changed := []containerImage{}
+	for _, image := range containerImages(spec) {
+		if previous[image.Container] != *image.Image {
+			changed = append(changed, image)
+		}
+	}
+
+	return changed
+}
+
+// pinDigests replaces the tags of the images matched by RegistryCredentials
+// with pinDigests, or with verifySignatures in the Namespaces that opted-in to
+// the verification of the signatures, by their digests, resolved with the
+// credentials of the RegistryCredentials, so the validating webhook verifies
+// the signatures of the digests that are pulled. If verifiedOnly is true, only
+// the images whose signatures are verified are pinned.
+// It returns the pinned images, and the reason to deny the Pod when a tag
+// can't be resolved and the failure policy of pinDigests is Fail.
+func (w *MutatePodWebhook) pinDigests(ctx context.Context, log logr.Logger, pod *corev1.Pod, namespace string, images []containerImage, verifiedOnly bool) ([]imageRewrite, string, error) {
+	registryCredentialsList, err := w.getRegistryCredentialsList(ctx, namespace)
+	if err != nil {
+		return nil, "", err
+	}
+	verifying, err := w.isSignatureVerificationEnabled(ctx, namespace)
+	if err != nil {
+		return nil, "", err
+	}
+	pinning := []registryv1alpha1.RegistryCredentials{}
+	for _, registryCredentials := range registryCredentialsList.Items {
+		if (verifying && registryCredentials.Spec.VerifySignatures != nil) || (registryCredentials.Spec.PinDigests != nil && !verifiedOnly) {
+			pinning = append(pinning, registryCredentials)
+		}
+	}
+	if len(pinning) == 0 {
+		return nil, "", nil
+	}
+
+	rewrites := []imageRewrite{}
+	denied := ""
+	for _, image := range images {
+		matches, err := matchRegistryCredentials([]string{*image.Image}, pinning)
+		if err != nil {
+			return nil, "", err
+		}
+		if len(matches) == 0 {
+			continue
+		}
+		registryCredentials := matches[0]
+
+		digest, err := w.resolveDigest(ctx, &registryCredentials, *image.Image)
+		if err != nil {
+			log.Info("Unable to resolve the digest of the image", "container", image.Container, "image", *image.Image, "registryCredentials", registryCredentials.ObjectMeta.Name, "error", err.Error())
+			if registryCredentials.Spec.PinDigests != nil && registryCredentials.Spec.PinDigests.FailurePolicy == registryv1alpha1.FailurePolicyFail {
+				if denied == "" {
+					denied = fmt.Sprintf("unable to resolve the digest of the image %q of the container %q: %v", *image.Image, image.Container, err)
+				}
+				continue
+			}
+			w.eventf(ctx, pod, corev1.EventTypeWarning, "DigestResolutionFailed", "Unable to resolve the digest of the image %q of the container %q, keeping its tag: %v", *image.Image, image.Container, err)
+			continue
+		}
+		if digest == "" {
+			continue
+		}
+
+		source := fmt.Sprintf("the pinDigests of the RegistryCredentials %q", registryCredentials.ObjectMeta.Name)
+		if verifying && registryCredentials.Spec.VerifySignatures != nil {
+			source = fmt.Sprintf("the verifySignatures of the RegistryCredentials %q", registryCredentials.ObjectMeta.Name)
+		}
+		rewritten := imageRewrite{
+			Container: image.Container,
+			Original:  *image.Image,
+			Image:     registry.TrimTagAndDigest(*image.Image) + "@" + digest,
+			Source:    source,
+		}
+		*image.Image = rewritten.Image
+		rewrites = append(rewrites, rewritten)
+		w.eventf(ctx, pod, corev1.EventTypeNormal, "ImagePinned", "Pinned image %q of the container %q to %q", rewritten.Original, image.Container, rewritten.Image)
+	}
+	if denied != "" {
+		return nil, denied, nil
+	}
+
+	return rewrites, "", nil
+}
+
+// resolveDigest returns the digest of the image, or an empty digest if the
+// image is already referenced by digest. The digests are cached by
+// RegistryCredentials, so the digests resolved with the credentials of a
+// Namespace aren't disclosed to other Namespaces.
+func (w *MutatePodWebhook) resolveDigest(ctx context.Context, registryCredentials *registryv1alpha1.RegistryCredentials, image string) (string, error) {
+	ref, err := registry.ParseReference(image)
+	if err != nil {
+		return "", err
+	}
+	if ref.Digest != "" {
+		return "", nil
+	}
+
+	key := registryCredentials.ObjectMeta.Namespace + "/" + registryCredentials.ObjectMeta.Name + "/" + ref.String()
+	if digest, ok := w.digests.Get(key); ok {
+		w.countDigestResolution(ctx, "cached")
+		return digest.(string), nil
+	}
+
+	auth, err := w.getRegistryAuth(ctx, registryCredentials, ref)
+	if err != nil {
+		w.countDigestResolution(ctx, "error")
+		return "", err
+	}
+	digest, err := w.registryClient().Resolve(ctx, ref, auth)
+	if err != nil {
+		w.countDigestResolution(ctx, "error")
+		return "", err
+	}
+	w.digests.Set(key, digest)
+	w.countDigestResolution(ctx, "resolved")
+
+	return digest, nil
+}
+
+func (w *MutatePodWebhook) countDigestResolution(ctx context.Context, result string) {
+	if !isDryRun(ctx) {
+		metrics.DigestResolutions.WithLabelValues(result).Inc()
+	}
+}
@@ -0,0 +1,96 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	registryv1alpha1 "github.com/astrokube/registry-controller/api/v1alpha1"
+	"github.com/astrokube/registry-controller/pkg/registry"
+	"github.com/astrokube/registry-controller/pkg/registry/registrytest"
+)
+
+var _ = Describe("Digest pinning", func() {
+	var server *registrytest.Server
+
+	BeforeEach(func() {
+		server = registrytest.NewServer("user", "password")
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	newPinningWebhook := func(failurePolicy registryv1alpha1.FailurePolicy) *MutatePodWebhook {
+		registryCredentials := newRegistryCredentials("private", registryv1alpha1.RegistryCredentialsAuthenticated, "^"+regexp.QuoteMeta(server.Host()))
+		registryCredentials.Spec.PinDigests = &registryv1alpha1.PinDigests{FailurePolicy: failurePolicy}
+		w := newMutatePodWebhook(registryCredentials, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "private", Namespace: namespace},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data:       map[string][]byte{corev1.DockerConfigJsonKey: server.DockerConfigJSON()},
+		})
+		w.Registry = registry.NewClient(server.Client())
+
+		return w
+	}
+
+	Context("When the tag exists", func() {
+		It("Should pin the image to its digest and cache it", func() {
+			digest := server.PushImage("team/app", "1.0")
+			w := newPinningWebhook("")
+
+			resp := w.Handle(context.Background(), newPodRequest(newPod(server.Host()+"/team/app:1.0", "quay.io/other/app:1")))
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(patchedPaths(resp)).To(ConsistOf("/spec/containers/0/image", "/spec/imagePullSecrets", "/metadata/annotations"))
+			for _, patch := range resp.Patches {
+				switch patch.Path {
+				case "/spec/containers/0/image":
+					Expect(patch.Value).To(Equal(server.Host() + "/team/app@" + digest))
+				case "/metadata/annotations":
+					originals := map[string]string{}
+					Expect(json.Unmarshal([]byte(patch.Value.(map[string]interface{})[OriginalImagesAnnotation].(string)), &originals)).To(Succeed())
+					Expect(originals).To(HaveKeyWithValue("container", server.Host()+"/team/app:1.0"))
+				}
+			}
+			Expect(w.Recorder.(*record.FakeRecorder).Events).To(Receive(ContainSubstring("ImagePinned")))
+
+			resp = w.Handle(context.Background(), newPodRequest(newPod(server.Host()+"/team/app:1.0")))
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(server.Requests("team/app", "1.0")).To(Equal(1))
+		})
+
+		It("Should not resolve the images already pinned", func() {
+			digest := server.PushImage("team/app", "1.0")
+			w := newPinningWebhook("")
+
+			resp := w.Handle(context.Background(), newPodRequest(newPod(server.Host()+"/team/app@"+digest)))
+			Expect(patchedPaths(resp)).To(ConsistOf("/spec/imagePullSecrets"))
+			Expect(server.Requests("team/app", digest)).To(BeZero())
+		})
+	})
+
+	Context("When the tag can't be resolved", func() {
+		It("Should deny the Pod if the failure policy is Fail", func() {
+			w := newPinningWebhook(registryv1alpha1.FailurePolicyFail)
+
+			resp := w.Handle(context.Background(), newPodRequest(newPod(server.Host()+"/team/app:missing")))
+			Expect(resp.Allowed).To(BeFalse())
+			Expect(string(resp.Result.Reason)).To(ContainSubstring("unable to resolve the digest"))
+		})
+
+		It("Should keep the tag if the failure policy is Ignore", func() {
+			w := newPinningWebhook(registryv1alpha1.FailurePolicyIgnore)
+
+			resp := w.Handle(context.Background(), newPodRequest(newPod(server.Host()+"/team/app:missing")))
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(patchedPaths(resp)).To(ConsistOf("/spec/imagePullSecrets"))
+			Expect(w.Recorder.(*record.FakeRecorder).Events).To(Receive(ContainSubstring("DigestResolutionFailed")))
+		})
+	})
+})
@@ -0,0 +1,199 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	registryv1alpha1 "github.com/astrokube/registry-controller/api/v1alpha1"
+)
+
+// OriginalImagesAnnotation is the Pod annotation where the original images of
+// the rewritten containers are recorded, as a JSON object with the container
+// names as keys
+const OriginalImagesAnnotation = "registry.astrokube.com/original-images"
+
+// imageRewriteRule rewrites the images in the From prefix to the To prefix
+type imageRewriteRule struct {
+	From string
+	To   string
+	// Source describes where the rule is defined, for the Events
+	Source string
+}
+
+// imageRewrite is an image of a container rewritten by a rule
+type imageRewrite struct {
+	Container string
+	Original  string
+	Image     string
+	Source    string
+}
+
+// trimImagePrefix removes the optional trailing /* of the prefixes of the
+// ImageRewritePolicy rules, like docker.io/*
+func trimImagePrefix(prefix string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(prefix, "*"), "/")
+}
+
+// policyRewriteRules returns the rules of the ImageRewritePolicies that select
+// the Namespace with the given labels. Policies are sorted by name, so the
+// result doesn't depend on the order of the list.
+func policyRewriteRules(log logr.Logger, policies []registryv1alpha1.ImageRewritePolicy, namespaceLabels map[string]string) []imageRewriteRule {
+	sort.Slice(policies, func(i, j int) bool {
+		return policies[i].ObjectMeta.Name < policies[j].ObjectMeta.Name
+	})
+
+	rules := []imageRewriteRule{}
+	for _, policy := range policies {
+		if policy.Spec.NamespaceSelector != nil {
+			selector, err := metav1.LabelSelectorAsSelector(policy.Spec.NamespaceSelector)
+			if err != nil {
+				log.Error(err, "Invalid namespaceSelector, ignoring ImageRewritePolicy", "imageRewritePolicy", policy.ObjectMeta.Name)
+				continue
+			}
+			if !selector.Matches(labels.Set(namespaceLabels)) {
+				continue
+			}
+		}
+		for _, rule := range policy.Spec.Rules {
+			from := trimImagePrefix(rule.From)
+			if from == "" {
+				continue
+			}
+			rules = append(rules, imageRewriteRule{
+				From:   from,
+				To:     trimImagePrefix(rule.To),
+				Source: fmt.Sprintf("the ImageRewritePolicy %q", policy.ObjectMeta.Name),
+			})
+		}
+	}
+
+	return rules
+}
+
+// rewriteImages rewrites the images of the init, regular and ephemeral
+// containers matching the From prefix of a rule. Rules are matched against the
+// normalized images, so docker.io matches nginx. The rule with the longest
+// matching prefix is applied, and the first one on ties. It returns the
+// rewritten images.
+func rewriteImages(spec *corev1.PodSpec, rules []imageRewriteRule) []imageRewrite {
+	rewrites := []imageRewrite{}
+	rewrite := func(container string, image *string) {
+		normalized := normalizeImage(*image)
+		var match *imageRewrite
+		longest := 0
+		for _, rule := range rules {
+			if len(rule.From) <= longest || !hasImagePrefix(normalized, rule.From) {
+				continue
+			}
+			longest = len(rule.From)
+			match = &imageRewrite{
+				Container: container,
+				Original:  *image,
+				Image:     rule.To + strings.TrimPrefix(normalized, rule.From),
+				Source:    rule.Source,
+			}
+		}
+		if match != nil && match.Image != *image {
+			*image = match.Image
+			rewrites = append(rewrites, *match)
+		}
+	}
+
+	for i := range spec.InitContainers {
+		rewrite(spec.InitContainers[i].Name, &spec.InitContainers[i].Image)
+	}
+	for i := range spec.Containers {
+		rewrite(spec.Containers[i].Name, &spec.Containers[i].Image)
+	}
+	for i := range spec.EphemeralContainers {
+		rewrite(spec.EphemeralContainers[i].Name, &spec.EphemeralContainers[i].Image)
+	}
+
+	return rewrites
+}
+
+// rewritePodImages rewrites the images of the Pod spec with the mirrors of the
+// RegistryCredentials of the Namespace and the rules of the
+// ImageRewritePolicies selecting it. Pods and Namespaces that opted-out of
+// the injection are not rewritten either. It returns the rewritten images.
+func (w *MutatePodWebhook) rewritePodImages(ctx context.Context, log logr.Logger, obj runtime.Object, namespace string, meta *metav1.ObjectMeta, spec *corev1.PodSpec) ([]imageRewrite, error) {
+	if isInjectionDisabled(meta.Labels, meta.Annotations) {
+		return nil, nil
+	}
+	ns, err := w.getNamespace(ctx, namespace)
+	if err != nil {
+		log.Error(err, "Unable to get Namespace")
+		return nil, err
+	}
+	if isInjectionDisabled(ns.ObjectMeta.Labels, ns.ObjectMeta.Annotations) {
+		return nil, nil
+	}
+
+	registryCredentialsList, err := w.getRegistryCredentialsList(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+	policies, err := w.getImageRewritePolicyList(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rules := append(mirrorRewriteRules(registryCredentialsList.Items), policyRewriteRules(log, policies.Items, ns.ObjectMeta.Labels)...)
+
+	rewrites := rewriteImages(spec, rules)
+	for _, rewritten := range rewrites {
+		log.Info("Rewrote image", "container", rewritten.Container, "image", rewritten.Original, "rewritten", rewritten.Image, "source", rewritten.Source)
+		w.eventf(ctx, obj, corev1.EventTypeNormal, "ImageRewritten", "Rewrote image %q of the container %q to %q, as defined by %s", rewritten.Original, rewritten.Container, rewritten.Image, rewritten.Source)
+	}
+
+	return rewrites, nil
+}
+
+// recordOriginalImages adds the original images of the rewritten containers
+// to the OriginalImagesAnnotation, keeping the ones already recorded.
+func recordOriginalImages(meta *metav1.ObjectMeta, rewrites []imageRewrite) error {
+	if len(rewrites) == 0 {
+		return nil
+	}
+
+	originals := map[string]string{}
+	if value, ok := meta.Annotations[OriginalImagesAnnotation]; ok {
+		if err := json.Unmarshal([]byte(value), &originals); err != nil {
+			originals = map[string]string{}
+		}
+	}
+	for _, rewritten := range rewrites {
+		if _, ok := originals[rewritten.Container]; !ok {
+			originals[rewritten.Container] = rewritten.Original
+		}
+	}
+	value, err := json.Marshal(originals)
+	if err != nil {
+		return err
+	}
+	if meta.Annotations == nil {
+		meta.Annotations = map[string]string{}
+	}
+	meta.Annotations[OriginalImagesAnnotation] = string(value)
+
+	return nil
+}
+
+func (w *MutatePodWebhook) getImageRewritePolicyList(ctx context.Context) (*registryv1alpha1.ImageRewritePolicyList, error) {
+	list := &registryv1alpha1.ImageRewritePolicyList{}
+	err := w.Client.List(ctx, list)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+
+	return list, nil
+}
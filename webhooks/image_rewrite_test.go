@@ -0,0 +1,145 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	registryv1alpha1 "github.com/astrokube/registry-controller/api/v1alpha1"
+)
+
+var _ = Describe("ImageRewritePolicy", func() {
+	const ecrMirror = "123.dkr.ecr.eu-west-1.amazonaws.com/dockerhub"
+
+	newImageRewritePolicy := func(name string, selector *metav1.LabelSelector, rules ...registryv1alpha1.ImageRewriteRule) *registryv1alpha1.ImageRewritePolicy {
+		return &registryv1alpha1.ImageRewritePolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: registryv1alpha1.ImageRewritePolicySpec{
+				NamespaceSelector: selector,
+				Rules:             rules,
+			},
+		}
+	}
+	newNamespace := func(labels map[string]string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace, Labels: labels}}
+	}
+	dockerHubRule := registryv1alpha1.ImageRewriteRule{From: "docker.io/*", To: ecrMirror + "/*"}
+	mirrorSelector := &metav1.LabelSelector{MatchLabels: map[string]string{"mirror": "ecr"}}
+
+	patchedValues := func(resp admission.Response) map[string]interface{} {
+		values := map[string]interface{}{}
+		for _, patch := range resp.Patches {
+			values[patch.Path] = patch.Value
+		}
+
+		return values
+	}
+
+	Context("When the policy selects the Namespace", func() {
+		It("Should rewrite the images and inject the secrets of the rewritten images", func() {
+			w := newMutatePodWebhook(
+				newNamespace(map[string]string{"mirror": "ecr"}),
+				newImageRewritePolicy("dockerhub", mirrorSelector, dockerHubRule),
+				newRegistryCredentials("ecr", registryv1alpha1.RegistryCredentialsAuthenticated, `^123\.dkr\.ecr`),
+			)
+			pod := newPod("nginx:1")
+			pod.Spec.InitContainers = []corev1.Container{{Name: "init", Image: "quay.io/app/init:1"}}
+
+			resp := w.Handle(context.Background(), newPodRequest(pod))
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(patchedPaths(resp)).To(ConsistOf("/spec/containers/0/image", "/spec/imagePullSecrets", "/metadata/annotations"))
+			values := patchedValues(resp)
+			Expect(values["/spec/containers/0/image"]).To(Equal(ecrMirror + "/library/nginx:1"))
+			Expect(values["/spec/imagePullSecrets"]).To(Equal([]interface{}{map[string]interface{}{"name": "ecr"}}))
+
+			annotations := values["/metadata/annotations"].(map[string]interface{})
+			originals := map[string]string{}
+			Expect(json.Unmarshal([]byte(annotations[OriginalImagesAnnotation].(string)), &originals)).To(Succeed())
+			Expect(originals).To(Equal(map[string]string{"container": "nginx:1"}))
+			Expect(w.Recorder.(*record.FakeRecorder).Events).To(Receive(ContainSubstring(`the ImageRewritePolicy "dockerhub"`)))
+		})
+
+		It("Should apply the rule with the longest matching prefix", func() {
+			w := newMutatePodWebhook(
+				newNamespace(nil),
+				newImageRewritePolicy("dockerhub", nil, dockerHubRule),
+				newImageRewritePolicy("bitnami", nil, registryv1alpha1.ImageRewriteRule{From: "docker.io/bitnami", To: "harbor.example.com/bitnami"}),
+			)
+
+			resp := w.Handle(context.Background(), newPodRequest(newPod("bitnami/redis:6")))
+			Expect(patchedValues(resp)["/spec/containers/0/image"]).To(Equal("harbor.example.com/bitnami/redis:6"))
+		})
+	})
+
+	Context("When the policy doesn't select the Namespace", func() {
+		It("Should not rewrite the images", func() {
+			w := newMutatePodWebhook(
+				newNamespace(map[string]string{"mirror": "harbor"}),
+				newImageRewritePolicy("dockerhub", mirrorSelector, dockerHubRule),
+			)
+
+			resp := w.Handle(context.Background(), newPodRequest(newPod("nginx:1")))
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Patches).To(BeEmpty())
+		})
+	})
+
+	Context("When the Namespace opted-out of the injection", func() {
+		It("Should not rewrite the images", func() {
+			w := newMutatePodWebhook(
+				newNamespace(map[string]string{InjectKey: "false"}),
+				newImageRewritePolicy("dockerhub", nil, dockerHubRule),
+			)
+
+			resp := w.Handle(context.Background(), newPodRequest(newPod("nginx:1")))
+			Expect(resp.Patches).To(BeEmpty())
+		})
+	})
+
+	Context("When adding ephemeral containers to a Pod", func() {
+		It("Should rewrite the images of the added containers only", func() {
+			w := newMutatePodWebhook(
+				newNamespace(nil),
+				newImageRewritePolicy("dockerhub", nil, dockerHubRule),
+			)
+			oldPod := newPod(ecrMirror + "/library/nginx:1")
+			oldPod.Spec.EphemeralContainers = []corev1.EphemeralContainer{{
+				EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: "existing", Image: "busybox"},
+			}}
+			pod := oldPod.DeepCopy()
+			pod.Spec.EphemeralContainers = append(pod.Spec.EphemeralContainers, corev1.EphemeralContainer{
+				EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: "debugger", Image: "busybox"},
+			})
+			req := newPodRequest(pod)
+			req.Operation = admissionv1.Update
+			req.SubResource = "ephemeralcontainers"
+			req.Kind = metav1.GroupVersionKind{Version: "v1", Kind: "Pod"}
+			raw, err := json.Marshal(oldPod)
+			Expect(err).NotTo(HaveOccurred())
+			req.OldObject = runtime.RawExtension{Raw: raw}
+
+			resp := w.Handle(context.Background(), req)
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(patchedPaths(resp)).To(ConsistOf("/spec/ephemeralContainers/1/image"))
+			Expect(resp.Patches[0].Value).To(Equal(ecrMirror + "/library/busybox"))
+		})
+	})
+
+	Context("When reading the rules", func() {
+		It("Should trim the trailing wildcards", func() {
+			rules := policyRewriteRules(logf.Log, []registryv1alpha1.ImageRewritePolicy{*newImageRewritePolicy("dockerhub", nil, dockerHubRule)}, nil)
+			Expect(rules).To(HaveLen(1))
+			Expect(rules[0].From).To(Equal("docker.io"))
+			Expect(rules[0].To).To(Equal(ecrMirror))
+		})
+	})
+})
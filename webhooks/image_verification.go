@@ -0,0 +1,229 @@
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	registryv1alpha1 "github.com/astrokube/registry-controller/api/v1alpha1"
+	"github.com/astrokube/registry-controller/pkg/metrics"
+	"github.com/astrokube/registry-controller/pkg/registry"
+	"github.com/astrokube/registry-controller/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// VerifyImagesKey is the Namespace label used to opt-in to the
+	// verification of the images of the Pods. Set it to "deny" to deny the
+	// Pods with images that can't be pulled, or to "warn" to only return
+	// admission warnings.
+	VerifyImagesKey = "registry.astrokube.com/verify-images"
+
+	// VerifyImagesDeny denies the Pods with images that can't be pulled
+	VerifyImagesDeny = "deny"
+	// VerifyImagesWarn returns admission warnings for the images that can't
+	// be pulled
+	VerifyImagesWarn = "warn"
+
+	// DefaultImageVerificationCacheTTL is the default time the results of
+	// the verification of the images are cached
+	DefaultImageVerificationCacheTTL = 30 * time.Second
+)
+
+// ValidateImagesWebhook verifies that the images of the Pods matched by a
+// RegistryCredentials exist and can be pulled with its credentials, by
+// requesting the manifests to the registry. It reuses the selection logic of
+// the MutatePodWebhook.
+type ValidateImagesWebhook struct {
+	Log        logr.Logger
+	PodWebhook *MutatePodWebhook
+	// CacheTTL is the time the results of the verification are cached.
+	// Defaults to DefaultImageVerificationCacheTTL.
+	CacheTTL time.Duration
+	decoder  *admission.Decoder
+	cache    *registry.Cache
+}
+
+// imageCheck is the result of the verification of an image. The problem is
+// empty when the image can be pulled. Checks that couldn't be completed are
+// never denied.
+type imageCheck struct {
+	Problem  string
+	Complete bool
+}
+
+// cachedCheck returns the cached result of the check of the key, or runs the
+// check. Only the complete results are cached, so the checks that failed
+// because of transient errors are retried in the next admission.
+func cachedCheck(cache *registry.Cache, key string, check func() imageCheck) imageCheck {
+	if cached, ok := cache.Get(key); ok {
+		return cached.(imageCheck)
+	}
+	result := check()
+	if result.Complete {
+		cache.Set(key, result)
+	}
+
+	return result
+}
+
+//+kubebuilder:webhook:path=/validate-pod-images,mutating=false,failurePolicy=ignore,sideEffects=None,admissionReviewVersions=v1,groups=core,resources=pods;pods/ephemeralcontainers,verbs=create;update,versions=v1,name=validate-pod-images.registry.astrokube.io
+
+// SetupWithManager registers the webhook in the manager.
+func (w *ValidateImagesWebhook) SetupWithManager(mgr ctrl.Manager) error {
+	if w.PodWebhook == nil {
+		return fmt.Errorf("the image verification webhook requires the Pod webhook")
+	}
+	w.cache = registry.NewCache(w.CacheTTL, DefaultImageVerificationCacheTTL)
+	mgr.GetWebhookServer().Register("/validate-pod-images", WithRequestTimeout(&webhook.Admission{Handler: w}))
+
+	return nil
+}
+
+func (w *ValidateImagesWebhook) Handle(ctx context.Context, req admission.Request) admission.Response {
+	ctx, span := tracing.Tracer().Start(ctx, "ValidateImagesWebhook.Handle", trace.WithAttributes(
+		attribute.String("namespace", req.Namespace),
+		attribute.String("name", req.Name),
+		attribute.String("operation", string(req.Operation)),
+		attribute.String("subresource", req.SubResource),
+	))
+	defer span.End()
+
+	log := w.Log.WithValues("pod", req.Name)
+	ctx = withDryRun(ctx, req)
+
+	// The images of existing Pods are only verified when ephemeral
+	// containers are added
+	if req.Operation == admissionv1.Update && req.SubResource != "ephemeralcontainers" {
+		return admission.Allowed("")
+	}
+
+	images := []string{}
+	if req.Kind.Kind == "EphemeralContainers" {
+		ephemeralContainers := &corev1.EphemeralContainers{}
+		if err := w.decoder.Decode(req, ephemeralContainers); err != nil {
+			log.Error(err, "Unable to decode request")
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		for _, container := range ephemeralContainers.EphemeralContainers {
+			images = append(images, container.Image)
+		}
+	} else {
+		pod := &corev1.Pod{}
+		if err := w.decoder.Decode(req, pod); err != nil {
+			log.Error(err, "Unable to decode request")
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if req.SubResource == "ephemeralcontainers" {
+			images = podImages(&corev1.PodSpec{EphemeralContainers: pod.Spec.EphemeralContainers})
+		} else {
+			images = podImages(&pod.Spec)
+		}
+	}
+
+	namespace, err := w.PodWebhook.getNamespace(ctx, req.Namespace)
+	if err != nil {
+		log.Error(err, "Unable to get Namespace")
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	mode := strings.ToLower(namespace.ObjectMeta.Labels[VerifyImagesKey])
+	if mode != VerifyImagesDeny && mode != VerifyImagesWarn {
+		return admission.Allowed("image verification not enabled for the Namespace")
+	}
+
+	registryCredentialsList, err := w.PodWebhook.getRegistryCredentialsList(ctx, req.Namespace)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	denied := []string{}
+	warnings := []string{}
+	checked := map[string]bool{}
+	for _, image := range images {
+		if checked[image] {
+			continue
+		}
+		checked[image] = true
+		matches, err := matchRegistryCredentials([]string{image}, registryCredentialsList.Items)
+		if err != nil {
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+		if len(matches) == 0 {
+			continue
+		}
+
+		check := w.checkImage(ctx, &matches[0], image)
+		if check.Problem == "" {
+			continue
+		}
+		log.Info("Image verification failed", "image", image, "registryCredentials", matches[0].ObjectMeta.Name, "problem", check.Problem)
+		if mode == VerifyImagesDeny && check.Complete {
+			denied = append(denied, check.Problem)
+		} else {
+			warnings = append(warnings, check.Problem)
+		}
+	}
+
+	if len(denied) > 0 {
+		resp := admission.Denied(strings.Join(denied, "; "))
+		resp.Warnings = warnings
+		return resp
+	}
+	resp := admission.Allowed("")
+	resp.Warnings = warnings
+
+	return resp
+}
+
+// checkImage requests the manifest of the image with the credentials of the
+// RegistryCredentials. The results are cached by RegistryCredentials.
+func (w *ValidateImagesWebhook) checkImage(ctx context.Context, registryCredentials *registryv1alpha1.RegistryCredentials, image string) imageCheck {
+	ref, err := registry.ParseReference(image)
+	if err != nil {
+		return imageCheck{Problem: fmt.Sprintf("invalid image %q: %v", image, err), Complete: true}
+	}
+
+	key := registryCredentials.ObjectMeta.Namespace + "/" + registryCredentials.ObjectMeta.Name + "/" + ref.String()
+
+	return cachedCheck(w.cache, key, func() imageCheck {
+		check := imageCheck{Complete: true}
+		result := "pullable"
+		auth, err := w.PodWebhook.getRegistryAuth(ctx, registryCredentials, ref)
+		if err == nil {
+			_, err = w.PodWebhook.registryClient().Head(ctx, ref, auth)
+		}
+		switch {
+		case err == nil:
+		case registry.IsNotFound(err):
+			check.Problem = fmt.Sprintf("image %q doesn't exist", image)
+			result = "not_found"
+		case registry.IsUnauthorized(err):
+			check.Problem = fmt.Sprintf("the credentials of the RegistryCredentials %q can't pull the image %q", registryCredentials.ObjectMeta.Name, image)
+			result = "unauthorized"
+		default:
+			check = imageCheck{Problem: fmt.Sprintf("unable to verify the image %q: %v", image, err)}
+			result = "error"
+		}
+		if !isDryRun(ctx) {
+			metrics.ImageVerifications.WithLabelValues(result).Inc()
+		}
+
+		return check
+	})
+}
+
+func (w *ValidateImagesWebhook) InjectDecoder(d *admission.Decoder) error {
+	w.decoder = d
+	return nil
+}
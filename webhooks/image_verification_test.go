@@ -0,0 +1,112 @@
+package webhooks
+
+import (
+	"context"
+	"regexp"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	registryv1alpha1 "github.com/astrokube/registry-controller/api/v1alpha1"
+	"github.com/astrokube/registry-controller/pkg/registry"
+	"github.com/astrokube/registry-controller/pkg/registry/registrytest"
+)
+
+var _ = Describe("ValidateImagesWebhook", func() {
+	var server *registrytest.Server
+
+	BeforeEach(func() {
+		server = registrytest.NewServer("user", "password")
+		server.PushImage("team/app", "1.0")
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	newValidateImagesWebhook := func(mode string, dockerConfig []byte) *ValidateImagesWebhook {
+		decoder, err := admission.NewDecoder(scheme)
+		Expect(err).NotTo(HaveOccurred())
+
+		podWebhook := newMutatePodWebhook(
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace, Labels: map[string]string{VerifyImagesKey: mode}}},
+			newRegistryCredentials("private", registryv1alpha1.RegistryCredentialsAuthenticated, "^"+regexp.QuoteMeta(server.Host())),
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "private", Namespace: namespace},
+				Type:       corev1.SecretTypeDockerConfigJson,
+				Data:       map[string][]byte{corev1.DockerConfigJsonKey: dockerConfig},
+			},
+		)
+		podWebhook.Registry = registry.NewClient(server.Client())
+		w := &ValidateImagesWebhook{Log: logf.Log, PodWebhook: podWebhook, cache: registry.NewCache(0, DefaultImageVerificationCacheTTL)}
+		Expect(w.InjectDecoder(decoder)).To(Succeed())
+
+		return w
+	}
+
+	Context("When the images exist", func() {
+		It("Should allow the Pod and cache the result", func() {
+			w := newValidateImagesWebhook(VerifyImagesDeny, server.DockerConfigJSON())
+
+			for i := 0; i < 2; i++ {
+				resp := w.Handle(context.Background(), newPodRequest(newPod(server.Host()+"/team/app:1.0", "quay.io/other/app:1")))
+				Expect(resp.Allowed).To(BeTrue())
+				Expect(resp.Warnings).To(BeEmpty())
+			}
+			Expect(server.Requests("team/app", "1.0")).To(Equal(1))
+		})
+	})
+
+	Context("When an image doesn't exist", func() {
+		It("Should deny the Pod in deny mode", func() {
+			w := newValidateImagesWebhook(VerifyImagesDeny, server.DockerConfigJSON())
+
+			resp := w.Handle(context.Background(), newPodRequest(newPod(server.Host()+"/team/app:typo")))
+			Expect(resp.Allowed).To(BeFalse())
+			Expect(string(resp.Result.Reason)).To(ContainSubstring("doesn't exist"))
+		})
+
+		It("Should return a warning in warn mode", func() {
+			w := newValidateImagesWebhook(VerifyImagesWarn, server.DockerConfigJSON())
+
+			resp := w.Handle(context.Background(), newPodRequest(newPod(server.Host()+"/team/app:typo")))
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Warnings).To(ConsistOf(ContainSubstring("doesn't exist")))
+		})
+	})
+
+	Context("When the credentials can't pull the image", func() {
+		It("Should deny the Pod in deny mode", func() {
+			w := newValidateImagesWebhook(VerifyImagesDeny, []byte(`{"auths":{"`+server.Host()+`":{"auth":"aW52YWxpZDppbnZhbGlk"}}}`))
+
+			resp := w.Handle(context.Background(), newPodRequest(newPod(server.Host()+"/team/app:1.0")))
+			Expect(resp.Allowed).To(BeFalse())
+			Expect(string(resp.Result.Reason)).To(ContainSubstring(`RegistryCredentials "private" can't pull`))
+		})
+	})
+
+	Context("When the registry can't be reached", func() {
+		It("Should only return a warning in deny mode", func() {
+			w := newValidateImagesWebhook(VerifyImagesDeny, server.DockerConfigJSON())
+			server.Close()
+
+			resp := w.Handle(context.Background(), newPodRequest(newPod(server.Host()+"/team/app:1.0")))
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Warnings).To(ConsistOf(ContainSubstring("unable to verify")))
+		})
+	})
+
+	Context("When the Namespace didn't opt-in", func() {
+		It("Should not verify the images", func() {
+			w := newValidateImagesWebhook("", server.DockerConfigJSON())
+
+			resp := w.Handle(context.Background(), newPodRequest(newPod(server.Host()+"/team/app:typo")))
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(server.Requests("team/app", "typo")).To(BeZero())
+		})
+	})
+})
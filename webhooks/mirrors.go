@@ -0,0 +1,67 @@
+package webhooks
+
+import (
+	"fmt"
+	"strings"
+
+	registryv1alpha1 "github.com/astrokube/registry-controller/api/v1alpha1"
+)
+
+// dockerHubHost is the host of the Docker Hub images without registry, like
+// nginx or bitnami/redis
+const dockerHubHost = "docker.io"
+
+// normalizeImage returns the image with its registry, like the container
+// runtime resolves it: images without registry are pulled from Docker Hub, and
+// the official images of Docker Hub are in the library namespace.
+func normalizeImage(image string) string {
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 1 || (!strings.ContainsAny(parts[0], ".:") && parts[0] != "localhost") {
+		parts = []string{dockerHubHost, image}
+	}
+	if parts[0] == "index.docker.io" {
+		parts[0] = dockerHubHost
+	}
+	if parts[0] == dockerHubHost && !strings.Contains(parts[1], "/") {
+		parts[1] = "library/" + parts[1]
+	}
+
+	return parts[0] + "/" + parts[1]
+}
+
+// hasImagePrefix returns whether the image is in the host or the repository
+// prefix
+func hasImagePrefix(image, prefix string) bool {
+	return strings.HasPrefix(image, prefix+"/")
+}
+
+// matchMirrors returns whether the image is served by any of the mirrors
+func matchMirrors(image string, mirrors []registryv1alpha1.Mirror) bool {
+	for _, mirror := range mirrors {
+		if hasImagePrefix(image, mirror.Prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// mirrorRewriteRules returns the rules to rewrite the images of the upstreams
+// of the mirrors of the RegistryCredentials to the mirrors
+func mirrorRewriteRules(registryCredentialsList []registryv1alpha1.RegistryCredentials) []imageRewriteRule {
+	rules := []imageRewriteRule{}
+	for _, registryCredentials := range registryCredentialsList {
+		for _, mirror := range registryCredentials.Spec.Mirrors {
+			if mirror.Upstream == "" {
+				continue
+			}
+			rules = append(rules, imageRewriteRule{
+				From:   mirror.Upstream,
+				To:     mirror.Prefix,
+				Source: fmt.Sprintf("a mirror of the RegistryCredentials %q", registryCredentials.ObjectMeta.Name),
+			})
+		}
+	}
+
+	return rules
+}
@@ -0,0 +1,81 @@
+package webhooks
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/astrokube/registry-controller/pkg/metrics"
+)
+
+// InjectionMode defines how the webhooks apply the secrets of the selected
+// RegistryCredentials
+type InjectionMode string
+
+const (
+	// InjectionModeEnforce injects the secrets in the Pods
+	InjectionModeEnforce InjectionMode = "enforce"
+	// InjectionModeAudit records the secrets that would be injected as Pod
+	// annotations, Events and metrics without injecting them
+	InjectionModeAudit InjectionMode = "audit"
+
+	// InjectionModeKey is the Namespace annotation used to override the
+	// injection mode of the webhooks
+	InjectionModeKey = "registry.astrokube.com/injection-mode"
+
+	// AuditSecretsAnnotation is the Pod annotation where the secrets that
+	// would be injected are recorded in audit mode
+	AuditSecretsAnnotation = "registry.astrokube.com/audit-secrets"
+)
+
+// ParseInjectionMode returns the InjectionMode with the given name.
+func ParseInjectionMode(mode string) (InjectionMode, error) {
+	switch InjectionMode(mode) {
+	case InjectionModeEnforce, InjectionModeAudit:
+		return InjectionMode(mode), nil
+	default:
+		return "", fmt.Errorf("invalid injection mode %q", mode)
+	}
+}
+
+type dryRunKey struct{}
+
+// withDryRun stores in the context whether the admission request is a dry
+// run, so no side effects are made while handling it.
+func withDryRun(ctx context.Context, req admission.Request) context.Context {
+	return context.WithValue(ctx, dryRunKey{}, req.DryRun != nil && *req.DryRun)
+}
+
+func isDryRun(ctx context.Context) bool {
+	dryRun, _ := ctx.Value(dryRunKey{}).(bool)
+	return dryRun
+}
+
+// eventf records an Event unless the admission request is a dry run.
+func (w *MutatePodWebhook) eventf(ctx context.Context, obj runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	if isDryRun(ctx) {
+		return
+	}
+	w.Recorder.Eventf(obj, eventtype, reason, messageFmt, args...)
+}
+
+// countSkipped counts an admission request where the injection was skipped,
+// unless the admission request is a dry run.
+func (w *MutatePodWebhook) countSkipped(ctx context.Context, obj runtime.Object, reason string) {
+	if isDryRun(ctx) {
+		return
+	}
+	metrics.SkippedInjections.WithLabelValues(objectKind(obj), reason).Inc()
+}
+
+// objectKind returns the kind of the object of an admission request. Pods
+// decoded without type information are considered Pods.
+func objectKind(obj runtime.Object) string {
+	if kind := obj.GetObjectKind().GroupVersionKind().Kind; kind != "" {
+		return kind
+	}
+
+	return "Pod"
+}
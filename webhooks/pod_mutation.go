@@ -4,32 +4,111 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
-	"regexp"
 	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
 
+	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
 	registryv1alpha1 "github.com/astrokube/registry-controller/api/v1alpha1"
+	"github.com/astrokube/registry-controller/pkg/metrics"
+	"github.com/astrokube/registry-controller/pkg/registry"
+	"github.com/astrokube/registry-controller/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	admissionv1 "k8s.io/api/admission/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 )
 
+const (
+	// DefaultReadinessTimeout is the default maximum time to wait for the
+	// RegistryCredentials used by a Pod to finish their authentication process
+	DefaultReadinessTimeout = 5 * time.Second
+
+	// TraceIDAnnotation is the Pod annotation where the ID of the trace of its
+	// admission is recorded when tracing is enabled
+	TraceIDAnnotation = "registry.astrokube.com/trace-id"
+
+	// readinessTimeoutMargin is the time reserved to build the response once
+	// the admission request deadline is reached
+	readinessTimeoutMargin = 500 * time.Millisecond
+)
+
 type MutatePodWebhook struct {
-	Client   client.Client
-	Log      logr.Logger
-	Recorder record.EventRecorder
-	decoder  *admission.Decoder
+	Client client.Client
+	// APIReader is used to read Pods without caching them. If not set, the
+	// Client is used.
+	APIReader client.Reader
+	Log       logr.Logger
+	Recorder  record.EventRecorder
+	// Mode is the default injection mode, that can be overridden per
+	// Namespace with the InjectionModeKey annotation. Defaults to enforce.
+	Mode InjectionMode
+	// ReadinessTimeout is the maximum time to wait for the matching
+	// RegistryCredentials to be authenticated. It is always bounded by the
+	// timeout of the admission request.
+	ReadinessTimeout time.Duration
+	// Registry is the client of the registries used to resolve the digests of
+	// the images. If not set, a client trusting the system CAs is used.
+	Registry *registry.Client
+	// DigestCacheTTL is the time the resolved digests are cached. Defaults to
+	// DefaultDigestCacheTTL.
+	DigestCacheTTL time.Duration
+	// SignatureCacheTTL is the time the results of the verification of the
+	// image signatures are cached. Defaults to DefaultSignatureCacheTTL.
+	SignatureCacheTTL time.Duration
+	decoder           *admission.Decoder
+	notifier          *readinessNotifier
+	digests           *registry.Cache
+	signatures        *registry.Cache
 }
 
-//+kubebuilder:webhook:path=/mutate-pod,mutating=true,failurePolicy=ignore,sideEffects=None,admissionReviewVersions=v1,groups=core,resources=pods,verbs=create;update,versions=v1,name=mutate-pod.registry.astrokube.io
+//+kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get
+//+kubebuilder:rbac:groups=registry.astrokube.com,resources=imagerewritepolicies,verbs=get;list;watch
+//+kubebuilder:webhook:path=/mutate-pod,mutating=true,failurePolicy=ignore,sideEffects=NoneOnDryRun,admissionReviewVersions=v1,groups=core,resources=pods;pods/ephemeralcontainers,verbs=create;update,versions=v1,name=mutate-pod.registry.astrokube.io
+
+// SetupWithManager registers the webhook in the manager and subscribes it to
+// the RegistryCredentials informer.
+func (w *MutatePodWebhook) SetupWithManager(mgr ctrl.Manager) error {
+	informer, err := mgr.GetCache().GetInformer(context.Background(), &registryv1alpha1.RegistryCredentials{})
+	if err != nil {
+		return err
+	}
+	w.notifier = newReadinessNotifier()
+	informer.AddEventHandler(w.notifier)
+	w.digests = registry.NewCache(w.DigestCacheTTL, DefaultDigestCacheTTL)
+	w.signatures = registry.NewCache(w.SignatureCacheTTL, DefaultSignatureCacheTTL)
+
+	mgr.GetWebhookServer().Register("/mutate-pod", WithRequestTimeout(&webhook.Admission{Handler: w}))
+
+	return nil
+}
 
 func (w *MutatePodWebhook) Handle(ctx context.Context, req admission.Request) admission.Response {
+	ctx, span := tracing.Tracer().Start(ctx, "MutatePodWebhook.Handle", trace.WithAttributes(
+		attribute.String("namespace", req.Namespace),
+		attribute.String("name", req.Name),
+		attribute.String("operation", string(req.Operation)),
+		attribute.String("subresource", req.SubResource),
+	))
+	defer span.End()
+
 	log := w.Log.WithValues("pod", req.Name)
+	ctx = withDryRun(ctx, req)
+
+	if req.SubResource == "ephemeralcontainers" {
+		return w.handleEphemeralContainers(ctx, log, req)
+	}
 
 	// Get Pod
 	pod := &corev1.Pod{}
@@ -38,40 +117,64 @@ func (w *MutatePodWebhook) Handle(ctx context.Context, req admission.Request) ad
 		log.Error(err, "Unable to decode request")
 		return admission.Errored(http.StatusBadRequest, err)
 	}
-
-	// Get Pod images
-	images := []string{}
-	for _, container := range pod.Spec.InitContainers {
-		images = append(images, container.Image)
+	// Pods created by controllers may not have the namespace set yet
+	namespace := pod.ObjectMeta.Namespace
+	if namespace == "" {
+		namespace = req.Namespace
 	}
-	for _, container := range pod.Spec.Containers {
-		images = append(images, container.Image)
+
+	// The image pull secrets of existing Pods can't be changed
+	if req.Operation == admissionv1.Update {
+		return w.handleUpdate(ctx, log, req, pod, namespace)
 	}
 
-	// Wait 10 seconds for RegistryCredentials authentication process
-	for i := 0; i < 10; i++ {
-		if !w.isReadyForInjection(log, pod) {
-			time.Sleep(1 * time.Second)
-		} else {
-			break
+	mode, err := w.getInjectionMode(ctx, namespace)
+	if err != nil {
+		log.Error(err, "Unable to get Namespace")
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	var skipped string
+	if mode == InjectionModeAudit {
+		skipped, err = w.auditPod(ctx, log, pod, namespace)
+	} else {
+		// Images are only rewritten in Pods, so the workloads keep the images
+		// of their manifests
+		var rewrites []imageRewrite
+		if rewrites, err = w.rewritePodImages(ctx, log, pod, namespace, &pod.ObjectMeta, &pod.Spec); err == nil {
+			err = recordOriginalImages(&pod.ObjectMeta, rewrites)
+		}
+		if err == nil {
+			skipped, err = w.injectPodSpec(ctx, log, pod, namespace, &pod.ObjectMeta, &pod.Spec, true)
 		}
 	}
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
 
-	// Get secrets to inject in the pod
-	secretsToAdd := []string{}
-	for _, image := range images {
-		ecrSecrets, err := w.getSecretNamesForRegistryCredentials(image, pod.ObjectMeta.Namespace)
-		if err != nil {
-			return admission.Errored(http.StatusInternalServerError, err)
-		}
-		secretsToAdd = append(secretsToAdd, ecrSecrets...)
+	// Pin the tags after injecting the secrets, so the RegistryCredentials
+	// are authenticated. The images matched by RegistryCredentials with
+	// verifySignatures are pinned even if the injection is skipped, so the
+	// validating webhook verifies the digests that are pulled.
+	pinned, denied, err := w.pinDigests(ctx, log, pod, namespace, containerImages(&pod.Spec), mode == InjectionModeAudit || skipped != "")
+	if err == nil {
+		err = recordOriginalImages(&pod.ObjectMeta, pinned)
+	}
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if denied != "" {
+		return admission.Denied(denied)
+	}
+	if skipped != "" && len(pinned) == 0 {
+		return admission.Allowed(skipped)
 	}
 
-	// Inject secrets
-	for _, secret := range secretsToAdd {
-		pod.Spec.ImagePullSecrets = append(pod.Spec.ImagePullSecrets, corev1.LocalObjectReference{
-			Name: secret,
-		})
+	// Correlate the Pod with the trace of its admission
+	if traceID := tracing.TraceID(ctx); traceID != "" {
+		if pod.ObjectMeta.Annotations == nil {
+			pod.ObjectMeta.Annotations = map[string]string{}
+		}
+		pod.ObjectMeta.Annotations[TraceIDAnnotation] = traceID
 	}
 
 	// Return the injected pod
@@ -83,63 +186,414 @@ func (w *MutatePodWebhook) Handle(ctx context.Context, req admission.Request) ad
 	return admission.PatchResponseFromRaw(req.Object.Raw, marshalledPod)
 }
 
-func (w *MutatePodWebhook) InjectDecoder(d *admission.Decoder) error {
-	w.decoder = d
-	return nil
-}
+// handleUpdate handles the updates of the Pods. The image pull secrets can't
+// be added anymore, so only the missing ones are reported, but the changed
+// images matched by RegistryCredentials with verifySignatures are pinned.
+func (w *MutatePodWebhook) handleUpdate(ctx context.Context, log logr.Logger, req admission.Request, pod *corev1.Pod, namespace string) admission.Response {
+	oldPod := &corev1.Pod{}
+	if len(req.OldObject.Raw) > 0 {
+		if err := w.decoder.DecodeRaw(req.OldObject, oldPod); err != nil {
+			log.Error(err, "Unable to decode request")
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+	}
+	pinned, denied, err := w.pinDigests(ctx, log, pod, namespace, changedContainerImages(&oldPod.Spec, &pod.Spec), true)
+	if err == nil {
+		err = recordOriginalImages(&pod.ObjectMeta, pinned)
+	}
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if denied != "" {
+		return admission.Denied(denied)
+	}
 
-func (w *MutatePodWebhook) getSecretNamesForRegistryCredentials(image, namespace string) ([]string, error) {
-	registryCredentialsList, err := w.getRegistryCredentialsList(namespace)
+	resp := w.reportMissingSecrets(ctx, log, pod, namespace, &pod.ObjectMeta, &pod.Spec)
+	if len(pinned) == 0 || !resp.Allowed {
+		return resp
+	}
+
+	marshalledPod, err := json.Marshal(pod)
 	if err != nil {
-		return nil, err
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	patched := admission.PatchResponseFromRaw(req.Object.Raw, marshalledPod)
+	patched.Result = resp.Result
+
+	return patched
+}
+
+// ephemeralContainersRequest is a decoded request to the ephemeralcontainers
+// subresource of a Pod
+type ephemeralContainersRequest struct {
+	// Pod is the Pod with the requested ephemeral containers
+	Pod *corev1.Pod
+	// Object is the object of the request, an EphemeralContainers or a Pod,
+	// that shares the ephemeral containers with the Pod
+	Object runtime.Object
+	// Added are the indexes of the ephemeral containers added by the request
+	Added []int
+}
+
+// addedImages returns the images of the added ephemeral containers
+func (r *ephemeralContainersRequest) addedImages() []containerImage {
+	images := []containerImage{}
+	for _, index := range r.Added {
+		container := &r.Pod.Spec.EphemeralContainers[index]
+		images = append(images, containerImage{Container: container.Name, Image: &container.Image})
 	}
 
-	secretNames := []string{}
+	return images
+}
 
-	for _, registryCredentials := range registryCredentialsList.Items {
-		for _, imageSelector := range registryCredentials.Spec.ImageSelector.MatchRegexp {
-			match, err := regexp.Match(imageSelector, []byte(image))
-			if err != nil {
-				return nil, err
+// decodeEphemeralContainers decodes a request to the ephemeralcontainers
+// subresource. Depending on the Kubernetes version, the object of the request
+// is an EphemeralContainers or a Pod. It returns the status code of the
+// response when the request can't be decoded.
+func (w *MutatePodWebhook) decodeEphemeralContainers(ctx context.Context, log logr.Logger, req admission.Request) (*ephemeralContainersRequest, int32, error) {
+	pod := &corev1.Pod{}
+	var obj runtime.Object = pod
+	existing := map[string]bool{}
+	if req.Kind.Kind == "EphemeralContainers" {
+		ephemeralContainers := &corev1.EphemeralContainers{}
+		if err := w.decoder.Decode(req, ephemeralContainers); err != nil {
+			log.Error(err, "Unable to decode request")
+			return nil, http.StatusBadRequest, err
+		}
+		if err := w.reader().Get(ctx, types.NamespacedName{Name: req.Name, Namespace: req.Namespace}, pod); err != nil {
+			log.Error(err, "Unable to get Pod")
+			return nil, http.StatusInternalServerError, err
+		}
+		for _, container := range pod.Spec.EphemeralContainers {
+			existing[container.Name] = true
+		}
+		pod.Spec.EphemeralContainers = ephemeralContainers.EphemeralContainers
+		obj = ephemeralContainers
+	} else {
+		if err := w.decoder.Decode(req, pod); err != nil {
+			log.Error(err, "Unable to decode request")
+			return nil, http.StatusBadRequest, err
+		}
+		if len(req.OldObject.Raw) > 0 {
+			oldPod := &corev1.Pod{}
+			if err := w.decoder.DecodeRaw(req.OldObject, oldPod); err != nil {
+				log.Error(err, "Unable to decode request")
+				return nil, http.StatusBadRequest, err
 			}
-			if match {
-				secretNames = append(secretNames, registryCredentials.ObjectMeta.Name)
+			for _, container := range oldPod.Spec.EphemeralContainers {
+				existing[container.Name] = true
 			}
 		}
-		for _, imageSelector := range registryCredentials.Spec.ImageSelector.MatchEquals {
-			imageWithoutTag := strings.Split(image, ":")[0]
-			if imageSelector == imageWithoutTag {
-				secretNames = append(secretNames, registryCredentials.ObjectMeta.Name)
-			}
+	}
+
+	decoded := &ephemeralContainersRequest{Pod: pod, Object: obj}
+	for i, container := range pod.Spec.EphemeralContainers {
+		if !existing[container.Name] {
+			decoded.Added = append(decoded.Added, i)
 		}
 	}
 
-	return secretNames, nil
+	return decoded, 0, nil
 }
 
-func (w *MutatePodWebhook) getRegistryCredentialsList(namespace string) (*registryv1alpha1.RegistryCredentialsList, error) {
-	list := &registryv1alpha1.RegistryCredentialsList{}
-	err := w.Client.List(context.TODO(), list, &client.ListOptions{Namespace: namespace})
-	if err != nil && !errors.IsNotFound(err) {
-		return nil, err
+// handleEphemeralContainers handles the requests to the ephemeralcontainers
+// subresource of the Pods. The images of the added ephemeral containers are
+// rewritten and pinned like the ones of new Pods, but the original images
+// can't be recorded because the Pod metadata can't be changed.
+func (w *MutatePodWebhook) handleEphemeralContainers(ctx context.Context, log logr.Logger, req admission.Request) admission.Response {
+	decoded, status, err := w.decodeEphemeralContainers(ctx, log, req)
+	if err != nil {
+		return admission.Errored(status, err)
 	}
+	pod := decoded.Pod
 
-	return list, nil
+	// Rewrite the images of the added ephemeral containers only, as the
+	// existing ones can't be changed
+	added := &corev1.PodSpec{}
+	for _, index := range decoded.Added {
+		added.EphemeralContainers = append(added.EphemeralContainers, pod.Spec.EphemeralContainers[index])
+	}
+	rewrites, err := w.rewritePodImages(ctx, log, pod, req.Namespace, &pod.ObjectMeta, added)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	for i, index := range decoded.Added {
+		pod.Spec.EphemeralContainers[index].Image = added.EphemeralContainers[i].Image
+	}
+
+	pinned, denied, err := w.pinDigests(ctx, log, pod, req.Namespace, decoded.addedImages(), true)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if denied != "" {
+		return admission.Denied(denied)
+	}
+
+	resp := w.reportMissingSecrets(ctx, log, pod, req.Namespace, &pod.ObjectMeta, &pod.Spec)
+	if len(rewrites)+len(pinned) == 0 || !resp.Allowed {
+		return resp
+	}
+
+	marshalled, err := json.Marshal(decoded.Object)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	patched := admission.PatchResponseFromRaw(req.Object.Raw, marshalled)
+	patched.Result = resp.Result
+	patched.Warnings = resp.Warnings
+
+	return patched
+}
+
+func (w *MutatePodWebhook) InjectDecoder(d *admission.Decoder) error {
+	w.decoder = d
+	return nil
+}
+
+// injectPodSpec injects the secrets of the selected RegistryCredentials in the
+// Pod spec. Events are recorded on the given object, that can be a
+// Pod or a workload with a Pod template. If wait is true, it waits for the selected
+// RegistryCredentials to finish their authentication process. It returns the
+// reason when the injection is skipped.
+func (w *MutatePodWebhook) injectPodSpec(ctx context.Context, log logr.Logger, obj runtime.Object, namespace string, meta *metav1.ObjectMeta, spec *corev1.PodSpec, wait bool) (string, error) {
+	secrets, skipped, err := w.getMissingSecrets(ctx, log, obj, namespace, meta, spec, wait)
+	if err != nil || skipped != "" {
+		return skipped, err
+	}
+
+	// Inject secrets
+	for _, secret := range secrets {
+		spec.ImagePullSecrets = append(spec.ImagePullSecrets, corev1.LocalObjectReference{
+			Name: secret,
+		})
+	}
+	if !isDryRun(ctx) {
+		metrics.Injections.WithLabelValues(objectKind(obj)).Add(float64(len(secrets)))
+	}
+
+	return "", nil
+}
+
+// auditPod records the secrets that would be injected in the Pod as an
+// annotation, an Event and a metric, without injecting them. It doesn't wait
+// for the authentication process to not delay the creation of the Pods. It
+// returns the reason when the injection is skipped.
+func (w *MutatePodWebhook) auditPod(ctx context.Context, log logr.Logger, pod *corev1.Pod, namespace string) (string, error) {
+	secrets, skipped, err := w.getMissingSecrets(ctx, log, pod, namespace, &pod.ObjectMeta, &pod.Spec, false)
+	if err != nil || skipped != "" {
+		return skipped, err
+	}
+	if len(secrets) == 0 {
+		return "", nil
+	}
+
+	log.Info("Audit mode, secrets not injected", "secrets", secrets)
+	if pod.ObjectMeta.Annotations == nil {
+		pod.ObjectMeta.Annotations = map[string]string{}
+	}
+	pod.ObjectMeta.Annotations[AuditSecretsAnnotation] = strings.Join(secrets, ",")
+	w.eventf(ctx, pod, corev1.EventTypeNormal, "AuditInjection", "Audit mode, the image pull secrets %q would be injected", strings.Join(secrets, ","))
+	if !isDryRun(ctx) {
+		for _, secret := range secrets {
+			metrics.AuditedInjections.WithLabelValues(namespace, secret).Inc()
+		}
+	}
+
+	return "", nil
+}
+
+// reportMissingSecrets records an Event in the Pod when it lacks the secrets of
+// the selected RegistryCredentials. It is used when the image pull secrets of
+// the Pod can't be changed anymore, like when ephemeral containers are added.
+func (w *MutatePodWebhook) reportMissingSecrets(ctx context.Context, log logr.Logger, pod *corev1.Pod, namespace string, meta *metav1.ObjectMeta, spec *corev1.PodSpec) admission.Response {
+	secrets, skipped, err := w.getMissingSecrets(ctx, log, pod, namespace, meta, spec, false)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if skipped != "" {
+		return admission.Allowed(skipped)
+	}
+	if len(secrets) == 0 {
+		return admission.Allowed("")
+	}
+
+	log.Info("Unable to inject secrets in an existing Pod", "secrets", secrets)
+	w.eventf(ctx, pod, corev1.EventTypeWarning, "MissingImagePullSecrets", "The image pull secrets %q of the matching RegistryCredentials can't be added to an existing Pod, recreate the Pod to inject them", strings.Join(secrets, ","))
+
+	return admission.Allowed("image pull secrets can't be added to an existing Pod")
 }
 
-func (w *MutatePodWebhook) isReadyForInjection(log logr.Logger, pod *corev1.Pod) bool {
-	registryCredentialsList, err := w.getRegistryCredentialsList(pod.ObjectMeta.Namespace)
+// getMissingSecrets returns the secrets of the selected RegistryCredentials
+// that are not yet in the Pod spec. It returns the reason when the injection is skipped.
+func (w *MutatePodWebhook) getMissingSecrets(ctx context.Context, log logr.Logger, obj runtime.Object, namespace string, meta *metav1.ObjectMeta, spec *corev1.PodSpec, wait bool) ([]string, string, error) {
+	// Skip Pods that opted-out of the injection
+	if isInjectionDisabled(meta.Labels, meta.Annotations) {
+		log.V(1).Info("Injection disabled for the Pod")
+		w.countSkipped(ctx, obj, "disabled_pod")
+		return nil, "injection disabled for the Pod", nil
+	}
+	disabled, err := w.isInjectionDisabledForNamespace(ctx, namespace)
+	if err != nil {
+		log.Error(err, "Unable to get Namespace")
+		return nil, "", err
+	}
+	if disabled {
+		log.V(1).Info("Injection disabled for the Namespace")
+		w.countSkipped(ctx, obj, "disabled_namespace")
+		return nil, "injection disabled for the Namespace", nil
+	}
+
+	registryCredentialsList, err := w.getRegistryCredentialsList(ctx, namespace)
 	if err != nil {
-		log.Error(err, "Unable to get RegistryCredentials list")
-		return false
+		return nil, "", err
+	}
+
+	// Get Pod images
+	images := podImages(spec)
+	matches, err := selectRegistryCredentials(meta.Annotations, images, registryCredentialsList.Items)
+	if err != nil {
+		return nil, "", err
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.StringSlice("registry_credentials", registryCredentialsNames(matches)))
+	if names := requestedRegistryCredentials(meta.Annotations); names != nil {
+		for _, name := range missingRegistryCredentials(names, matches) {
+			w.eventf(ctx, obj, corev1.EventTypeWarning, "Creating pod", "The requested RegistryCredentials %q doesn't exist", name)
+		}
+	}
+
+	// Wait for the matching RegistryCredentials authentication process
+	if pending := pendingRegistryCredentials(matches); wait && len(pending) > 0 {
+		matches = w.waitForRegistryCredentials(ctx, log, obj, namespace, meta.Annotations, images, matches, pending)
+	}
+
+	secrets := []string{}
+	found := map[string]bool{}
+	for _, secret := range spec.ImagePullSecrets {
+		found[secret.Name] = true
+	}
+	for _, registryCredentials := range matches {
+		if found[registryCredentials.ObjectMeta.Name] {
+			continue
+		}
+		found[registryCredentials.ObjectMeta.Name] = true
+		secrets = append(secrets, registryCredentials.ObjectMeta.Name)
 	}
 
-	for _, registryCredentials := range registryCredentialsList.Items {
-		if registryCredentials.Status.State == registryv1alpha1.RegistryCredentialsAuthenticating || registryCredentials.Status.State == "" {
-			w.Recorder.Eventf(pod, corev1.EventTypeWarning, "Creating pod", "Waiting to create Pod will beacuse the authentication process is not finished for the RegistryCredentials \"%v\"", registryCredentials.ObjectMeta.Name)
+	return secrets, "", nil
+}
+
+// waitForRegistryCredentials waits until the pending RegistryCredentials finish
+// their authentication process, or the timeout expires, and returns the
+// RegistryCredentials matching the images at that moment.
+func (w *MutatePodWebhook) waitForRegistryCredentials(ctx context.Context, log logr.Logger, obj runtime.Object, namespace string, annotations map[string]string, images []string, matches []registryv1alpha1.RegistryCredentials, pending []types.NamespacedName) []registryv1alpha1.RegistryCredentials {
+	for _, key := range pending {
+		w.eventf(ctx, obj, corev1.EventTypeWarning, "Creating pod", "Waiting to create Pod because the authentication process is not finished for the RegistryCredentials %q", key.Name)
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "waitForRegistryCredentials")
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, w.readinessTimeout(ctx))
+	defer cancel()
+
+	isReady := func() bool {
+		registryCredentialsList, err := w.getRegistryCredentialsList(ctx, namespace)
+		if err != nil {
+			log.Error(err, "Unable to get RegistryCredentials list")
 			return false
 		}
+		current, err := selectRegistryCredentials(annotations, images, registryCredentialsList.Items)
+		if err != nil {
+			log.Error(err, "Unable to match RegistryCredentials")
+			return false
+		}
+		matches = current
+		return len(pendingRegistryCredentials(matches)) == 0
+	}
+
+	start := time.Now()
+	result := "ready"
+	if w.notifier == nil || !w.notifier.wait(ctx, pending, isReady) {
+		log.Info("Timeout waiting for RegistryCredentials", "pending", pending, "waited", time.Since(start).String())
+		result = "timeout"
+	}
+	span.SetAttributes(attribute.String("result", result))
+	metrics.ReadinessWait.WithLabelValues(result).Observe(time.Since(start).Seconds())
+
+	return matches
+}
+
+// readinessTimeout returns the time to wait for RegistryCredentials, bounded
+// by the deadline of the admission request.
+func (w *MutatePodWebhook) readinessTimeout(ctx context.Context) time.Duration {
+	timeout := w.ReadinessTimeout
+	if timeout <= 0 {
+		timeout = DefaultReadinessTimeout
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if remaining := time.Until(deadline) - readinessTimeoutMargin; remaining < timeout {
+			timeout = remaining
+		}
+	}
+	if timeout < 0 {
+		return 0
+	}
+
+	return timeout
+}
+
+// reader returns the reader used to get objects that are not cached, like
+// Pods.
+func (w *MutatePodWebhook) reader() client.Reader {
+	if w.APIReader != nil {
+		return w.APIReader
+	}
+
+	return w.Client
+}
+
+func (w *MutatePodWebhook) isInjectionDisabledForNamespace(ctx context.Context, name string) (bool, error) {
+	namespace, err := w.getNamespace(ctx, name)
+	if err != nil {
+		return false, err
+	}
+
+	return isInjectionDisabled(namespace.ObjectMeta.Labels, namespace.ObjectMeta.Annotations), nil
+}
+
+// getInjectionMode returns the injection mode of the Namespace, or the default
+// mode if the Namespace doesn't override it.
+func (w *MutatePodWebhook) getInjectionMode(ctx context.Context, name string) (InjectionMode, error) {
+	namespace, err := w.getNamespace(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	if mode, err := ParseInjectionMode(namespace.ObjectMeta.Annotations[InjectionModeKey]); err == nil {
+		return mode, nil
+	}
+	if w.Mode == "" {
+		return InjectionModeEnforce, nil
 	}
 
-	return true
+	return w.Mode, nil
+}
+
+// getNamespace returns the Namespace with the given name, or an empty
+// Namespace if it doesn't exist.
+func (w *MutatePodWebhook) getNamespace(ctx context.Context, name string) (*corev1.Namespace, error) {
+	namespace := &corev1.Namespace{}
+	if err := w.Client.Get(ctx, types.NamespacedName{Name: name}, namespace); err != nil {
+		return namespace, client.IgnoreNotFound(err)
+	}
+
+	return namespace, nil
+}
+
+func (w *MutatePodWebhook) getRegistryCredentialsList(ctx context.Context, namespace string) (*registryv1alpha1.RegistryCredentialsList, error) {
+	list := &registryv1alpha1.RegistryCredentialsList{}
+	err := w.Client.List(ctx, list, &client.ListOptions{Namespace: namespace})
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+
+	return list, nil
 }
@@ -0,0 +1,333 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	registryv1alpha1 "github.com/astrokube/registry-controller/api/v1alpha1"
+	"github.com/astrokube/registry-controller/pkg/registry"
+)
+
+const namespace = "default"
+
+func newRegistryCredentials(name string, state registryv1alpha1.RegistryCredentialsState, selector ...string) *registryv1alpha1.RegistryCredentials {
+	return &registryv1alpha1.RegistryCredentials{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: registryv1alpha1.RegistryCredentialsSpec{
+			ImageSelector: registryv1alpha1.ImageSelector{
+				MatchRegexp: selector,
+			},
+		},
+		Status: registryv1alpha1.RegistryCredentialsStatus{
+			State: state,
+		},
+	}
+}
+
+func newPodRequest(pod *corev1.Pod) admission.Request {
+	raw, err := json.Marshal(pod)
+	Expect(err).NotTo(HaveOccurred())
+
+	return admission.Request{
+		AdmissionRequest: admissionv1.AdmissionRequest{
+			Operation: admissionv1.Create,
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+	}
+}
+
+func newPod(images ...string) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pod",
+			Namespace: namespace,
+		},
+	}
+	for _, image := range images {
+		pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: "container", Image: image})
+	}
+
+	return pod
+}
+
+func newMutatePodWebhook(objects ...client.Object) *MutatePodWebhook {
+	decoder, err := admission.NewDecoder(scheme)
+	Expect(err).NotTo(HaveOccurred())
+
+	w := &MutatePodWebhook{
+		Client:           fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build(),
+		Log:              logf.Log,
+		Recorder:         record.NewFakeRecorder(100),
+		ReadinessTimeout: 5 * time.Second,
+		notifier:         newReadinessNotifier(),
+		digests:          registry.NewCache(0, DefaultDigestCacheTTL),
+		signatures:       registry.NewCache(0, DefaultSignatureCacheTTL),
+	}
+	Expect(w.InjectDecoder(decoder)).To(Succeed())
+
+	return w
+}
+
+func patchedPaths(resp admission.Response) []string {
+	paths := []string{}
+	for _, patch := range resp.Patches {
+		paths = append(paths, patch.Path)
+	}
+
+	return paths
+}
+
+var _ = Describe("MutatePodWebhook", func() {
+
+	Context("When creating a Pod", func() {
+		It("Should inject the secrets of the matching RegistryCredentials", func() {
+			w := newMutatePodWebhook(
+				newRegistryCredentials("ecr", registryv1alpha1.RegistryCredentialsAuthenticated, `^123\.dkr\.ecr`),
+				newRegistryCredentials("other", registryv1alpha1.RegistryCredentialsAuthenticated, `^quay\.io`),
+			)
+
+			resp := w.Handle(context.Background(), newPodRequest(newPod("123.dkr.ecr.eu-west-1.amazonaws.com/app:1", "123.dkr.ecr.eu-west-1.amazonaws.com/sidecar:1")))
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Patches).To(HaveLen(1))
+			Expect(resp.Patches[0].Path).To(Equal("/spec/imagePullSecrets"))
+			Expect(resp.Patches[0].Value).To(Equal([]interface{}{map[string]interface{}{"name": "ecr"}}))
+		})
+
+		It("Should not wait for RegistryCredentials unrelated to the Pod images", func() {
+			w := newMutatePodWebhook(
+				newRegistryCredentials("ecr", registryv1alpha1.RegistryCredentialsAuthenticated, `^123\.dkr\.ecr`),
+				newRegistryCredentials("pending", registryv1alpha1.RegistryCredentialsAuthenticating, `^quay\.io`),
+			)
+
+			start := time.Now()
+			resp := w.Handle(context.Background(), newPodRequest(newPod("123.dkr.ecr.eu-west-1.amazonaws.com/app:1")))
+			Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+			Expect(patchedPaths(resp)).To(ConsistOf("/spec/imagePullSecrets"))
+		})
+
+		It("Should wait until the matching RegistryCredentials are authenticated", func() {
+			pending := newRegistryCredentials("ecr", registryv1alpha1.RegistryCredentialsAuthenticating, `^123\.dkr\.ecr`)
+			w := newMutatePodWebhook(pending)
+
+			go func() {
+				defer GinkgoRecover()
+				time.Sleep(200 * time.Millisecond)
+				updated := &registryv1alpha1.RegistryCredentials{}
+				Expect(w.Client.Get(context.Background(), types.NamespacedName{Name: "ecr", Namespace: namespace}, updated)).To(Succeed())
+				updated.Status.State = registryv1alpha1.RegistryCredentialsAuthenticated
+				Expect(w.Client.Update(context.Background(), updated)).To(Succeed())
+				w.notifier.OnUpdate(pending, updated)
+			}()
+
+			start := time.Now()
+			resp := w.Handle(context.Background(), newPodRequest(newPod("123.dkr.ecr.eu-west-1.amazonaws.com/app:1")))
+			Expect(time.Since(start)).To(BeNumerically("<", 2*time.Second))
+			Expect(patchedPaths(resp)).To(ConsistOf("/spec/imagePullSecrets"))
+		})
+
+		It("Should stop waiting when the admission request deadline is reached", func() {
+			w := newMutatePodWebhook(
+				newRegistryCredentials("ecr", registryv1alpha1.RegistryCredentialsAuthenticating, `^123\.dkr\.ecr`),
+			)
+
+			ctx, cancel := context.WithTimeout(context.Background(), readinessTimeoutMargin+200*time.Millisecond)
+			defer cancel()
+
+			start := time.Now()
+			resp := w.Handle(ctx, newPodRequest(newPod("123.dkr.ecr.eu-west-1.amazonaws.com/app:1")))
+			Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+			Expect(resp.Allowed).To(BeTrue())
+		})
+	})
+
+	Context("When the injection is disabled", func() {
+		It("Should not mutate Pods annotated to opt-out", func() {
+			w := newMutatePodWebhook(
+				newRegistryCredentials("ecr", registryv1alpha1.RegistryCredentialsAuthenticated, `^123\.dkr\.ecr`),
+			)
+			pod := newPod("123.dkr.ecr.eu-west-1.amazonaws.com/app:1")
+			pod.ObjectMeta.Annotations = map[string]string{InjectKey: "false"}
+
+			resp := w.Handle(context.Background(), newPodRequest(pod))
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Patches).To(BeEmpty())
+		})
+
+		It("Should not mutate Pods in Namespaces labeled to opt-out", func() {
+			w := newMutatePodWebhook(
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace, Labels: map[string]string{InjectKey: "false"}}},
+				newRegistryCredentials("ecr", registryv1alpha1.RegistryCredentialsAuthenticated, `^123\.dkr\.ecr`),
+			)
+
+			resp := w.Handle(context.Background(), newPodRequest(newPod("123.dkr.ecr.eu-west-1.amazonaws.com/app:1")))
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Patches).To(BeEmpty())
+		})
+	})
+
+	Context("When the Pod requests RegistryCredentials by name", func() {
+		It("Should inject only the requested RegistryCredentials", func() {
+			w := newMutatePodWebhook(
+				newRegistryCredentials("ecr", registryv1alpha1.RegistryCredentialsAuthenticated, `^123\.dkr\.ecr`),
+				newRegistryCredentials("quay", registryv1alpha1.RegistryCredentialsAuthenticated, `^quay\.io`),
+			)
+			pod := newPod("123.dkr.ecr.eu-west-1.amazonaws.com/app:1")
+			pod.ObjectMeta.Annotations = map[string]string{RegistryCredentialsAnnotation: "quay, missing"}
+
+			resp := w.Handle(context.Background(), newPodRequest(pod))
+			Expect(resp.Patches).To(HaveLen(1))
+			Expect(resp.Patches[0].Value).To(Equal([]interface{}{map[string]interface{}{"name": "quay"}}))
+			Expect(w.Recorder.(*record.FakeRecorder).Events).To(Receive(ContainSubstring("missing")))
+		})
+	})
+
+	Context("When adding ephemeral containers to a Pod", func() {
+		It("Should report the secrets that can't be injected", func() {
+			w := newMutatePodWebhook(
+				newRegistryCredentials("ecr", registryv1alpha1.RegistryCredentialsAuthenticated, `^123\.dkr\.ecr`),
+			)
+			pod := newPod("nginx:latest")
+			pod.Spec.EphemeralContainers = []corev1.EphemeralContainer{{
+				EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: "debugger", Image: "123.dkr.ecr.eu-west-1.amazonaws.com/debug:1"},
+			}}
+			req := newPodRequest(pod)
+			req.Operation = admissionv1.Update
+			req.SubResource = "ephemeralcontainers"
+			req.Kind = metav1.GroupVersionKind{Version: "v1", Kind: "Pod"}
+
+			resp := w.Handle(context.Background(), req)
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Patches).To(BeEmpty())
+			Expect(w.Recorder.(*record.FakeRecorder).Events).To(Receive(ContainSubstring("MissingImagePullSecrets")))
+		})
+	})
+
+	Context("When updating a Pod", func() {
+		It("Should not change the image pull secrets", func() {
+			w := newMutatePodWebhook(
+				newRegistryCredentials("ecr", registryv1alpha1.RegistryCredentialsAuthenticated, `^123\.dkr\.ecr`),
+			)
+			req := newPodRequest(newPod("123.dkr.ecr.eu-west-1.amazonaws.com/app:1"))
+			req.Operation = admissionv1.Update
+
+			resp := w.Handle(context.Background(), req)
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Patches).To(BeEmpty())
+		})
+	})
+
+	Context("When the injection mode is audit", func() {
+		It("Should record the secrets as an annotation without injecting them", func() {
+			w := newMutatePodWebhook(
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace, Annotations: map[string]string{InjectionModeKey: string(InjectionModeAudit)}}},
+				newRegistryCredentials("ecr", registryv1alpha1.RegistryCredentialsAuthenticated, `^123\.dkr\.ecr`),
+			)
+
+			resp := w.Handle(context.Background(), newPodRequest(newPod("123.dkr.ecr.eu-west-1.amazonaws.com/app:1")))
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Patches).To(HaveLen(1))
+			Expect(resp.Patches[0].Path).To(Equal("/metadata/annotations"))
+			Expect(resp.Patches[0].Value).To(Equal(map[string]interface{}{AuditSecretsAnnotation: "ecr"}))
+			Expect(w.Recorder.(*record.FakeRecorder).Events).To(Receive(ContainSubstring("AuditInjection")))
+		})
+	})
+
+	Context("When the admission request is a dry run", func() {
+		It("Should not record Events", func() {
+			w := newMutatePodWebhook(
+				newRegistryCredentials("ecr", registryv1alpha1.RegistryCredentialsAuthenticated, `^123\.dkr\.ecr`),
+			)
+			dryRun := true
+			pod := newPod("123.dkr.ecr.eu-west-1.amazonaws.com/app:1")
+			pod.ObjectMeta.Annotations = map[string]string{RegistryCredentialsAnnotation: "missing"}
+			req := newPodRequest(pod)
+			req.DryRun = &dryRun
+
+			resp := w.Handle(context.Background(), req)
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(w.Recorder.(*record.FakeRecorder).Events).NotTo(Receive())
+		})
+	})
+
+	Context("When the RegistryCredentials have mirrors", func() {
+		newMirroredRegistryCredentials := func(mirrors ...registryv1alpha1.Mirror) *registryv1alpha1.RegistryCredentials {
+			registryCredentials := newRegistryCredentials("harbor", registryv1alpha1.RegistryCredentialsAuthenticated, `^harbor\.example\.com/library/`)
+			registryCredentials.Spec.Mirrors = mirrors
+
+			return registryCredentials
+		}
+
+		It("Should inject the secrets in Pods pulling from a mirror", func() {
+			w := newMutatePodWebhook(newMirroredRegistryCredentials(registryv1alpha1.Mirror{Prefix: "harbor.example.com/dockerhub"}))
+
+			resp := w.Handle(context.Background(), newPodRequest(newPod("harbor.example.com/dockerhub/library/nginx:1")))
+			Expect(resp.Patches).To(HaveLen(1))
+			Expect(resp.Patches[0].Value).To(Equal([]interface{}{map[string]interface{}{"name": "harbor"}}))
+		})
+
+		It("Should rewrite the images of the upstream to the mirror", func() {
+			w := newMutatePodWebhook(newMirroredRegistryCredentials(
+				registryv1alpha1.Mirror{Prefix: "harbor.example.com/dockerhub", Upstream: "docker.io"},
+				registryv1alpha1.Mirror{Prefix: "harbor.example.com/bitnami", Upstream: "docker.io/bitnami"},
+			))
+			pod := newPod("nginx:1", "bitnami/redis:6", "quay.io/app:1")
+			pod.Spec.InitContainers = []corev1.Container{{Name: "init", Image: "docker.io/busybox"}}
+
+			resp := w.Handle(context.Background(), newPodRequest(pod))
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(patchedPaths(resp)).To(ConsistOf(
+				"/spec/initContainers/0/image",
+				"/spec/containers/0/image",
+				"/spec/containers/1/image",
+				"/spec/imagePullSecrets",
+				"/metadata/annotations",
+			))
+			images := map[string]interface{}{}
+			for _, patch := range resp.Patches {
+				images[patch.Path] = patch.Value
+			}
+			Expect(images["/spec/initContainers/0/image"]).To(Equal("harbor.example.com/dockerhub/library/busybox"))
+			Expect(images["/spec/containers/0/image"]).To(Equal("harbor.example.com/dockerhub/library/nginx:1"))
+			Expect(images["/spec/containers/1/image"]).To(Equal("harbor.example.com/bitnami/redis:6"))
+			Expect(w.Recorder.(*record.FakeRecorder).Events).To(Receive(ContainSubstring("ImageRewritten")))
+		})
+
+		It("Should not rewrite images without upstream rules", func() {
+			w := newMutatePodWebhook(newMirroredRegistryCredentials(registryv1alpha1.Mirror{Prefix: "harbor.example.com/dockerhub"}))
+
+			resp := w.Handle(context.Background(), newPodRequest(newPod("nginx:1")))
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Patches).To(BeEmpty())
+		})
+	})
+
+	Context("When normalizing images", func() {
+		It("Should resolve the Docker Hub images like the container runtime", func() {
+			Expect(normalizeImage("nginx")).To(Equal("docker.io/library/nginx"))
+			Expect(normalizeImage("bitnami/redis:6")).To(Equal("docker.io/bitnami/redis:6"))
+			Expect(normalizeImage("index.docker.io/nginx")).To(Equal("docker.io/library/nginx"))
+			Expect(normalizeImage("localhost/app")).To(Equal("localhost/app"))
+			Expect(normalizeImage("registry:5000/app")).To(Equal("registry:5000/app"))
+			Expect(normalizeImage("quay.io/org/app@sha256:abc")).To(Equal("quay.io/org/app@sha256:abc"))
+		})
+	})
+})
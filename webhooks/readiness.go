@@ -0,0 +1,122 @@
+package webhooks
+
+import (
+	"context"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+	toolscache "k8s.io/client-go/tools/cache"
+
+	registryv1alpha1 "github.com/astrokube/registry-controller/api/v1alpha1"
+)
+
+// readinessNotifier wakes up admission requests waiting for RegistryCredentials
+// to finish their authentication process. It is fed by the shared informer of
+// RegistryCredentials, so waiters are notified as soon as the status changes
+// instead of polling the API.
+type readinessNotifier struct {
+	mu      sync.Mutex
+	waiters map[types.NamespacedName][]chan struct{}
+}
+
+func newReadinessNotifier() *readinessNotifier {
+	return &readinessNotifier{
+		waiters: map[types.NamespacedName][]chan struct{}{},
+	}
+}
+
+// subscribe returns a channel that is closed the next time any of the given
+// RegistryCredentials changes. The returned function must be called to release
+// the subscription.
+func (n *readinessNotifier) subscribe(keys []types.NamespacedName) (<-chan struct{}, func()) {
+	ch := make(chan struct{})
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, key := range keys {
+		n.waiters[key] = append(n.waiters[key], ch)
+	}
+
+	return ch, func() {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		for _, key := range keys {
+			n.remove(key, ch)
+		}
+	}
+}
+
+func (n *readinessNotifier) remove(key types.NamespacedName, ch chan struct{}) {
+	waiters := n.waiters[key]
+	for i, waiter := range waiters {
+		if waiter == ch {
+			waiters = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(waiters) == 0 {
+		delete(n.waiters, key)
+	} else {
+		n.waiters[key] = waiters
+	}
+}
+
+func (n *readinessNotifier) notify(obj interface{}) {
+	if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	registryCredentials, ok := obj.(*registryv1alpha1.RegistryCredentials)
+	if !ok {
+		return
+	}
+	key := types.NamespacedName{Name: registryCredentials.Name, Namespace: registryCredentials.Namespace}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, ch := range n.waiters[key] {
+		// A channel can be shared by several keys, so it may already be closed
+		select {
+		case <-ch:
+		default:
+			close(ch)
+		}
+	}
+	delete(n.waiters, key)
+}
+
+// OnAdd implements toolscache.ResourceEventHandler
+func (n *readinessNotifier) OnAdd(obj interface{}) {
+	n.notify(obj)
+}
+
+// OnUpdate implements toolscache.ResourceEventHandler
+func (n *readinessNotifier) OnUpdate(oldObj, newObj interface{}) {
+	n.notify(newObj)
+}
+
+// OnDelete implements toolscache.ResourceEventHandler
+func (n *readinessNotifier) OnDelete(obj interface{}) {
+	n.notify(obj)
+}
+
+// wait blocks until isReady returns true or the context is done. isReady is
+// evaluated once before waiting and again after every change of the given
+// RegistryCredentials.
+func (n *readinessNotifier) wait(ctx context.Context, keys []types.NamespacedName, isReady func() bool) bool {
+	for {
+		// Subscribe before checking to not miss changes between both steps
+		changed, cancel := n.subscribe(keys)
+		if isReady() {
+			cancel()
+			return true
+		}
+
+		select {
+		case <-changed:
+			cancel()
+		case <-ctx.Done():
+			cancel()
+			return false
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package webhooks
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	registryv1alpha1 "github.com/astrokube/registry-controller/api/v1alpha1"
+	"github.com/astrokube/registry-controller/pkg/registry"
+)
+
+// defaultRegistryClient is used by the webhooks that don't set a registry
+// client
+var defaultRegistryClient = registry.NewClient(nil)
+
+// registryClient returns the client used to send requests to the registries
+func (w *MutatePodWebhook) registryClient() *registry.Client {
+	if w.Registry != nil {
+		return w.Registry
+	}
+
+	return defaultRegistryClient
+}
+
+// getRegistryAuth returns the auth for the image in the Secret generated for
+// the RegistryCredentials
+func (w *MutatePodWebhook) getRegistryAuth(ctx context.Context, registryCredentials *registryv1alpha1.RegistryCredentials, ref registry.Reference) (string, error) {
+	secret := &corev1.Secret{}
+	key := types.NamespacedName{Name: registryCredentials.ObjectMeta.Name, Namespace: registryCredentials.ObjectMeta.Namespace}
+	if err := w.Client.Get(ctx, key, secret); err != nil {
+		return "", fmt.Errorf("getting the Secret of the RegistryCredentials %q: %w", key.Name, err)
+	}
+
+	return registry.AuthFor(secret.Data[corev1.DockerConfigJsonKey], ref)
+}
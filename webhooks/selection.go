@@ -0,0 +1,180 @@
+package webhooks
+
+import (
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	registryv1alpha1 "github.com/astrokube/registry-controller/api/v1alpha1"
+)
+
+const (
+	// InjectKey is the label or annotation used in Namespaces and Pods to
+	// opt-out of the injection of secrets by setting it to "false"
+	InjectKey = "registry.astrokube.com/inject"
+
+	// RegistryCredentialsAnnotation is the Pod annotation used to request a
+	// comma separated list of RegistryCredentials by name instead of
+	// selecting them by image
+	RegistryCredentialsAnnotation = "registry.astrokube.com/registry-credentials"
+)
+
+// isInjectionDisabled returns true if the object opted-out of the injection
+// through its labels or annotations.
+func isInjectionDisabled(labels, annotations map[string]string) bool {
+	return strings.EqualFold(labels[InjectKey], "false") || strings.EqualFold(annotations[InjectKey], "false")
+}
+
+// requestedRegistryCredentials returns the names of the RegistryCredentials
+// requested explicitly in the Pod annotations, or nil if the Pod doesn't
+// request any.
+func requestedRegistryCredentials(annotations map[string]string) []string {
+	value, ok := annotations[RegistryCredentialsAnnotation]
+	if !ok {
+		return nil
+	}
+
+	names := []string{}
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// selectRegistryCredentials returns the RegistryCredentials to inject in the
+// Pod: the ones requested by name when the Pod sets the
+// RegistryCredentialsAnnotation, or the ones whose image selector matches any
+// of the images otherwise.
+func selectRegistryCredentials(annotations map[string]string, images []string, registryCredentialsList []registryv1alpha1.RegistryCredentials) ([]registryv1alpha1.RegistryCredentials, error) {
+	if names := requestedRegistryCredentials(annotations); names != nil {
+		return filterRegistryCredentials(names, registryCredentialsList), nil
+	}
+
+	return matchRegistryCredentials(images, registryCredentialsList)
+}
+
+// filterRegistryCredentials returns the RegistryCredentials with the given
+// names.
+func filterRegistryCredentials(names []string, registryCredentialsList []registryv1alpha1.RegistryCredentials) []registryv1alpha1.RegistryCredentials {
+	matches := []registryv1alpha1.RegistryCredentials{}
+
+	for _, registryCredentials := range registryCredentialsList {
+		for _, name := range names {
+			if registryCredentials.ObjectMeta.Name == name {
+				matches = append(matches, registryCredentials)
+				break
+			}
+		}
+	}
+
+	return matches
+}
+
+// missingRegistryCredentials returns the requested names not found in the
+// selected RegistryCredentials.
+func missingRegistryCredentials(names []string, registryCredentialsList []registryv1alpha1.RegistryCredentials) []string {
+	missing := []string{}
+
+	for _, name := range names {
+		found := false
+		for _, registryCredentials := range registryCredentialsList {
+			if registryCredentials.ObjectMeta.Name == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, name)
+		}
+	}
+
+	return missing
+}
+
+// podImages returns the images of all the containers in the Pod spec,
+// including the init and ephemeral containers.
+func podImages(spec *corev1.PodSpec) []string {
+	images := []string{}
+	for _, container := range spec.InitContainers {
+		images = append(images, container.Image)
+	}
+	for _, container := range spec.Containers {
+		images = append(images, container.Image)
+	}
+	for _, container := range spec.EphemeralContainers {
+		images = append(images, container.Image)
+	}
+
+	return images
+}
+
+// matchRegistryCredentials returns the RegistryCredentials whose image
+// selector or mirrors match any of the images.
+func matchRegistryCredentials(images []string, registryCredentialsList []registryv1alpha1.RegistryCredentials) ([]registryv1alpha1.RegistryCredentials, error) {
+	matches := []registryv1alpha1.RegistryCredentials{}
+
+	for _, registryCredentials := range registryCredentialsList {
+		for _, image := range images {
+			match, err := matchImage(image, registryCredentials.Spec.ImageSelector)
+			if err != nil {
+				return nil, err
+			}
+			if match || matchMirrors(image, registryCredentials.Spec.Mirrors) {
+				matches = append(matches, registryCredentials)
+				break
+			}
+		}
+	}
+
+	return matches, nil
+}
+
+func matchImage(image string, imageSelector registryv1alpha1.ImageSelector) (bool, error) {
+	for _, expression := range imageSelector.MatchRegexp {
+		match, err := regexp.MatchString(expression, image)
+		if err != nil {
+			return false, err
+		}
+		if match {
+			return true, nil
+		}
+	}
+	imageWithoutTag := strings.Split(image, ":")[0]
+	for _, name := range imageSelector.MatchEquals {
+		if name == imageWithoutTag {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func registryCredentialsNames(registryCredentialsList []registryv1alpha1.RegistryCredentials) []string {
+	names := []string{}
+	for _, registryCredentials := range registryCredentialsList {
+		names = append(names, registryCredentials.ObjectMeta.Name)
+	}
+
+	return names
+}
+
+// pendingRegistryCredentials returns the RegistryCredentials that haven't
+// finished their authentication process yet.
+func pendingRegistryCredentials(registryCredentialsList []registryv1alpha1.RegistryCredentials) []types.NamespacedName {
+	pending := []types.NamespacedName{}
+	for _, registryCredentials := range registryCredentialsList {
+		if registryCredentials.Status.State == registryv1alpha1.RegistryCredentialsAuthenticating || registryCredentials.Status.State == "" {
+			pending = append(pending, types.NamespacedName{
+				Name:      registryCredentials.ObjectMeta.Name,
+				Namespace: registryCredentials.ObjectMeta.Namespace,
+			})
+		}
+	}
+
+	return pending
+}
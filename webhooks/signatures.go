@@ -0,0 +1,258 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	registryv1alpha1 "github.com/astrokube/registry-controller/api/v1alpha1"
+	"github.com/astrokube/registry-controller/pkg/cosign"
+	"github.com/astrokube/registry-controller/pkg/metrics"
+	"github.com/astrokube/registry-controller/pkg/registry"
+	"github.com/astrokube/registry-controller/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// VerifySignaturesKey is the Namespace label used to opt-in to the
+	// verification of the signatures of the images of the Pods. Set it to
+	// "true" to verify the images matched by RegistryCredentials with
+	// verifySignatures.
+	VerifySignaturesKey = "registry.astrokube.com/verify-signatures"
+
+	// DefaultSignatureCacheTTL is the default time the results of the
+	// verification of the image signatures are cached
+	DefaultSignatureCacheTTL = 10 * time.Minute
+)
+
+// ValidateSignaturesWebhook verifies the cosign signatures of the images of
+// the Pods matched by RegistryCredentials with verifySignatures, in the
+// Namespaces labeled with registry.astrokube.com/verify-signatures=true. The
+// images are verified when the Pods are created, their images are changed or
+// ephemeral containers are added, even if the Namespace is in audit mode. The
+// MutatePodWebhook pins the tags of these images, so the verified digests are
+// the ones pulled, and the images that aren't pinned are rejected.
+type ValidateSignaturesWebhook struct {
+	Log        logr.Logger
+	PodWebhook *MutatePodWebhook
+	decoder    *admission.Decoder
+}
+
+//+kubebuilder:webhook:path=/validate-pod-signatures,mutating=false,failurePolicy=fail,sideEffects=None,admissionReviewVersions=v1,groups=core,resources=pods;pods/ephemeralcontainers,verbs=create;update,versions=v1,name=validate-pod-signatures.registry.astrokube.io
+
+// SetupWithManager registers the webhook in the manager.
+func (w *ValidateSignaturesWebhook) SetupWithManager(mgr ctrl.Manager) error {
+	if w.PodWebhook == nil {
+		return fmt.Errorf("the signature verification webhook requires the Pod webhook")
+	}
+	mgr.GetWebhookServer().Register("/validate-pod-signatures", WithRequestTimeout(&webhook.Admission{Handler: w}))
+
+	return nil
+}
+
+func (w *ValidateSignaturesWebhook) Handle(ctx context.Context, req admission.Request) admission.Response {
+	ctx, span := tracing.Tracer().Start(ctx, "ValidateSignaturesWebhook.Handle", trace.WithAttributes(
+		attribute.String("namespace", req.Namespace),
+		attribute.String("name", req.Name),
+		attribute.String("operation", string(req.Operation)),
+		attribute.String("subresource", req.SubResource),
+	))
+	defer span.End()
+
+	log := w.Log.WithValues("pod", req.Name)
+	ctx = withDryRun(ctx, req)
+
+	// Only the new images are verified, as the other ones were verified
+	// when they were admitted
+	var pod *corev1.Pod
+	var images []containerImage
+	if req.SubResource == "ephemeralcontainers" {
+		decoded, status, err := w.PodWebhook.decodeEphemeralContainers(ctx, log, req)
+		if err != nil {
+			return admission.Errored(status, err)
+		}
+		pod = decoded.Pod
+		images = decoded.addedImages()
+	} else {
+		pod = &corev1.Pod{}
+		if err := w.decoder.Decode(req, pod); err != nil {
+			log.Error(err, "Unable to decode request")
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		oldPod := &corev1.Pod{}
+		if req.Operation == admissionv1.Update && len(req.OldObject.Raw) > 0 {
+			if err := w.decoder.DecodeRaw(req.OldObject, oldPod); err != nil {
+				log.Error(err, "Unable to decode request")
+				return admission.Errored(http.StatusBadRequest, err)
+			}
+		}
+		images = changedContainerImages(&oldPod.Spec, &pod.Spec)
+	}
+	if len(images) == 0 {
+		return admission.Allowed("")
+	}
+	enabled, err := w.PodWebhook.isSignatureVerificationEnabled(ctx, req.Namespace)
+	if err != nil {
+		log.Error(err, "Unable to get Namespace")
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if !enabled {
+		return admission.Allowed("signature verification not enabled for the Namespace")
+	}
+
+	names := []string{}
+	for _, image := range images {
+		names = append(names, *image.Image)
+	}
+	denied, warnings, err := w.PodWebhook.verifySignatures(ctx, log, pod, req.Namespace, names)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if denied != "" {
+		resp := admission.Denied(denied)
+		resp.Warnings = warnings
+		return resp
+	}
+	resp := admission.Allowed("")
+	resp.Warnings = warnings
+
+	return resp
+}
+
+func (w *ValidateSignaturesWebhook) InjectDecoder(d *admission.Decoder) error {
+	w.decoder = d
+	return nil
+}
+
+// isSignatureVerificationEnabled returns whether the Namespace opted-in to the
+// verification of the signatures of the images
+func (w *MutatePodWebhook) isSignatureVerificationEnabled(ctx context.Context, name string) (bool, error) {
+	namespace, err := w.getNamespace(ctx, name)
+	if err != nil {
+		return false, err
+	}
+
+	return strings.ToLower(namespace.ObjectMeta.Labels[VerifySignaturesKey]) == "true", nil
+}
+
+// verifySignatures verifies the cosign signatures of the images matched by
+// RegistryCredentials with verifySignatures, with the credentials of the
+// RegistryCredentials. It returns the reason to deny the Pod, if any, and the
+// admission warnings.
+func (w *MutatePodWebhook) verifySignatures(ctx context.Context, log logr.Logger, pod *corev1.Pod, namespace string, images []string) (string, []string, error) {
+	registryCredentialsList, err := w.getRegistryCredentialsList(ctx, namespace)
+	if err != nil {
+		return "", nil, err
+	}
+	verifying := []registryv1alpha1.RegistryCredentials{}
+	for _, registryCredentials := range registryCredentialsList.Items {
+		if registryCredentials.Spec.VerifySignatures != nil {
+			verifying = append(verifying, registryCredentials)
+		}
+	}
+	if len(verifying) == 0 {
+		return "", nil, nil
+	}
+
+	denied := []string{}
+	warnings := []string{}
+	checked := map[string]bool{}
+	for _, image := range images {
+		if checked[image] {
+			continue
+		}
+		checked[image] = true
+		matches, err := matchRegistryCredentials([]string{image}, verifying)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(matches) == 0 {
+			continue
+		}
+		registryCredentials := matches[0]
+
+		check := w.verifySignature(ctx, &registryCredentials, image)
+		if check.Problem == "" {
+			continue
+		}
+		log.Info("Signature verification failed", "image", image, "registryCredentials", registryCredentials.ObjectMeta.Name, "problem", check.Problem)
+		policy := registryCredentials.Spec.VerifySignatures
+		if (check.Complete && policy.Action != registryv1alpha1.SignatureActionWarn) || (!check.Complete && policy.FailurePolicy == registryv1alpha1.FailurePolicyFail) {
+			denied = append(denied, check.Problem)
+			continue
+		}
+		warnings = append(warnings, check.Problem)
+		w.eventf(ctx, pod, corev1.EventTypeWarning, "SignatureVerificationFailed", "Admitted the image %q: %s", image, check.Problem)
+	}
+	if len(denied) > 0 {
+		return strings.Join(denied, "; "), warnings, nil
+	}
+
+	return "", warnings, nil
+}
+
+// verifySignature verifies the signatures of the image with the public keys
+// of the RegistryCredentials. The image must be referenced by digest, as the
+// signature of a tag doesn't apply to the images pushed to it afterwards. The
+// results are cached by RegistryCredentials, generation and digest, so changes
+// of the public keys are applied immediately.
+func (w *MutatePodWebhook) verifySignature(ctx context.Context, registryCredentials *registryv1alpha1.RegistryCredentials, image string) imageCheck {
+	ref, err := registry.ParseReference(image)
+	if err != nil {
+		return imageCheck{Problem: fmt.Sprintf("invalid image %q: %v", image, err), Complete: true}
+	}
+	digest := ref.Digest
+	if digest == "" {
+		w.countSignatureVerification(ctx, "unpinned")
+		return imageCheck{Problem: fmt.Sprintf("image %q isn't pinned to a digest, so its signature can't be verified", image), Complete: true}
+	}
+
+	key := fmt.Sprintf("%s/%s/%d/%s@%s", registryCredentials.ObjectMeta.Namespace, registryCredentials.ObjectMeta.Name, registryCredentials.ObjectMeta.Generation, ref.Name(), digest)
+
+	return cachedCheck(w.signatures, key, func() imageCheck {
+		keys, err := cosign.ParsePublicKeys(registryCredentials.Spec.VerifySignatures.PublicKeys)
+		if err != nil {
+			return imageCheck{Problem: fmt.Sprintf("invalid public keys in the RegistryCredentials %q: %v", registryCredentials.ObjectMeta.Name, err), Complete: true}
+		}
+
+		check := imageCheck{Complete: true}
+		result := "verified"
+		auth, err := w.getRegistryAuth(ctx, registryCredentials, ref)
+		if err == nil {
+			err = cosign.Verify(ctx, w.registryClient(), ref, digest, auth, keys)
+		}
+		switch {
+		case err == nil:
+		case errors.Is(err, cosign.ErrNoSignature):
+			check.Problem = fmt.Sprintf("image %q isn't signed", image)
+			result = "missing"
+		case errors.Is(err, cosign.ErrInvalidSignature):
+			check.Problem = fmt.Sprintf("image %q has no valid signature of the keys of the RegistryCredentials %q: %v", image, registryCredentials.ObjectMeta.Name, err)
+			result = "invalid"
+		default:
+			check = imageCheck{Problem: fmt.Sprintf("unable to verify the signature of the image %q: %v", image, err)}
+			result = "error"
+		}
+		w.countSignatureVerification(ctx, result)
+
+		return check
+	})
+}
+
+func (w *MutatePodWebhook) countSignatureVerification(ctx context.Context, result string) {
+	if !isDryRun(ctx) {
+		metrics.SignatureVerifications.WithLabelValues(result).Inc()
+	}
+}
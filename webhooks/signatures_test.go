@@ -0,0 +1,288 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"regexp"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	registryv1alpha1 "github.com/astrokube/registry-controller/api/v1alpha1"
+	"github.com/astrokube/registry-controller/pkg/cosign"
+	"github.com/astrokube/registry-controller/pkg/cosign/cosigntest"
+	"github.com/astrokube/registry-controller/pkg/registry"
+	"github.com/astrokube/registry-controller/pkg/registry/registrytest"
+)
+
+var _ = Describe("Signature verification", func() {
+	var (
+		server    *registrytest.Server
+		digest    string
+		key       *ecdsa.PrivateKey
+		publicKey string
+	)
+
+	BeforeEach(func() {
+		server = registrytest.NewServer("user", "password")
+		digest = server.PushImage("team/app", "1.0")
+		key, publicKey = cosigntest.GenerateKey()
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	// newVerifyingWebhook returns the webhook with the RegistryCredentials
+	// and the objects, in a Namespace that opted-in to the verification of
+	// the signatures unless a Namespace is given
+	newVerifyingWebhook := func(verifySignatures *registryv1alpha1.VerifySignatures, objects ...client.Object) *ValidateSignaturesWebhook {
+		labeled := false
+		for _, object := range objects {
+			if _, ok := object.(*corev1.Namespace); ok {
+				labeled = true
+			}
+		}
+		if !labeled {
+			objects = append(objects, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace, Labels: map[string]string{VerifySignaturesKey: "true"}}})
+		}
+		registryCredentials := newRegistryCredentials("private", registryv1alpha1.RegistryCredentialsAuthenticated, "^"+regexp.QuoteMeta(server.Host()))
+		registryCredentials.Spec.VerifySignatures = verifySignatures
+		podWebhook := newMutatePodWebhook(append(objects, registryCredentials, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "private", Namespace: namespace},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data:       map[string][]byte{corev1.DockerConfigJsonKey: server.DockerConfigJSON()},
+		})...)
+		podWebhook.Registry = registry.NewClient(server.Client())
+
+		decoder, err := admission.NewDecoder(scheme)
+		Expect(err).NotTo(HaveOccurred())
+		w := &ValidateSignaturesWebhook{Log: logf.Log, PodWebhook: podWebhook}
+		Expect(w.InjectDecoder(decoder)).To(Succeed())
+
+		return w
+	}
+
+	newUpdateRequest := func(oldPod, pod *corev1.Pod) admission.Request {
+		raw, err := json.Marshal(oldPod)
+		Expect(err).NotTo(HaveOccurred())
+		req := newPodRequest(pod)
+		req.Operation = admissionv1.Update
+		req.OldObject = runtime.RawExtension{Raw: raw}
+
+		return req
+	}
+
+	patchedImage := func(resp admission.Response, path string) string {
+		for _, patch := range resp.Patches {
+			if patch.Path == path {
+				return patch.Value.(string)
+			}
+		}
+
+		return ""
+	}
+
+	Context("When the image is signed with one of the keys", func() {
+		It("Should admit the Pod and cache the result by digest", func() {
+			cosigntest.Sign(server, "team/app", digest, key)
+			w := newVerifyingWebhook(&registryv1alpha1.VerifySignatures{PublicKeys: []string{publicKey}})
+
+			for i := 0; i < 2; i++ {
+				resp := w.Handle(context.Background(), newPodRequest(newPod(server.Host()+"/team/app@"+digest, "quay.io/other/app:1")))
+				Expect(resp.Allowed).To(BeTrue())
+				Expect(resp.Warnings).To(BeEmpty())
+			}
+			Expect(server.Requests("team/app", cosign.SignatureTag(digest))).To(Equal(1))
+		})
+
+		It("Should pin the tags in the Pod webhook without pinDigests", func() {
+			cosigntest.Sign(server, "team/app", digest, key)
+			w := newVerifyingWebhook(&registryv1alpha1.VerifySignatures{PublicKeys: []string{publicKey}})
+
+			resp := w.PodWebhook.Handle(context.Background(), newPodRequest(newPod(server.Host()+"/team/app:1.0")))
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(patchedImage(resp, "/spec/containers/0/image")).To(Equal(server.Host() + "/team/app@" + digest))
+
+			resp = w.Handle(context.Background(), newPodRequest(newPod(server.Host()+"/team/app@"+digest)))
+			Expect(resp.Allowed).To(BeTrue())
+		})
+
+		It("Should pin the tags of the Pods that opted-out of the injection", func() {
+			w := newVerifyingWebhook(&registryv1alpha1.VerifySignatures{PublicKeys: []string{publicKey}})
+			pod := newPod(server.Host() + "/team/app:1.0")
+			pod.ObjectMeta.Annotations = map[string]string{InjectKey: "false"}
+
+			resp := w.PodWebhook.Handle(context.Background(), newPodRequest(pod))
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(patchedImage(resp, "/spec/containers/0/image")).To(Equal(server.Host() + "/team/app@" + digest))
+			Expect(patchedPaths(resp)).NotTo(ContainElement("/spec/imagePullSecrets"))
+		})
+
+		It("Should pin the tags in audit mode", func() {
+			w := newVerifyingWebhook(
+				&registryv1alpha1.VerifySignatures{PublicKeys: []string{publicKey}},
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+					Name:        namespace,
+					Labels:      map[string]string{VerifySignaturesKey: "true"},
+					Annotations: map[string]string{InjectionModeKey: string(InjectionModeAudit)},
+				}},
+			)
+
+			resp := w.PodWebhook.Handle(context.Background(), newPodRequest(newPod(server.Host()+"/team/app:1.0")))
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(patchedImage(resp, "/spec/containers/0/image")).To(Equal(server.Host() + "/team/app@" + digest))
+		})
+
+		It("Should pin the changed tags when the Pod is updated", func() {
+			w := newVerifyingWebhook(&registryv1alpha1.VerifySignatures{PublicKeys: []string{publicKey}})
+
+			resp := w.PodWebhook.Handle(context.Background(), newUpdateRequest(newPod("nginx:1"), newPod(server.Host()+"/team/app:1.0")))
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(patchedImage(resp, "/spec/containers/0/image")).To(Equal(server.Host() + "/team/app@" + digest))
+		})
+	})
+
+	Context("When the image isn't pinned to a digest", func() {
+		It("Should deny the Pod even if it opted-out of the injection", func() {
+			cosigntest.Sign(server, "team/app", digest, key)
+			w := newVerifyingWebhook(&registryv1alpha1.VerifySignatures{PublicKeys: []string{publicKey}})
+			pod := newPod(server.Host() + "/team/app:1.0")
+			pod.ObjectMeta.Labels = map[string]string{InjectKey: "false"}
+
+			resp := w.Handle(context.Background(), newPodRequest(pod))
+			Expect(resp.Allowed).To(BeFalse())
+			Expect(string(resp.Result.Reason)).To(ContainSubstring("isn't pinned to a digest"))
+		})
+	})
+
+	Context("When the Namespace didn't opt-in to the verification", func() {
+		It("Should neither pin nor verify the images", func() {
+			w := newVerifyingWebhook(
+				&registryv1alpha1.VerifySignatures{PublicKeys: []string{publicKey}},
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}},
+			)
+
+			resp := w.PodWebhook.Handle(context.Background(), newPodRequest(newPod(server.Host()+"/team/app:1.0")))
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(patchedImage(resp, "/spec/containers/0/image")).To(BeEmpty())
+
+			resp = w.Handle(context.Background(), newPodRequest(newPod(server.Host()+"/team/app:1.0")))
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(server.Requests("team/app", cosign.SignatureTag(digest))).To(Equal(0))
+		})
+	})
+
+	Context("When the image isn't signed", func() {
+		It("Should deny the Pod by default", func() {
+			w := newVerifyingWebhook(&registryv1alpha1.VerifySignatures{PublicKeys: []string{publicKey}})
+
+			resp := w.Handle(context.Background(), newPodRequest(newPod(server.Host()+"/team/app@"+digest)))
+			Expect(resp.Allowed).To(BeFalse())
+			Expect(string(resp.Result.Reason)).To(ContainSubstring("isn't signed"))
+		})
+
+		It("Should deny the Pod in audit mode", func() {
+			w := newVerifyingWebhook(
+				&registryv1alpha1.VerifySignatures{PublicKeys: []string{publicKey}},
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+					Name:        namespace,
+					Labels:      map[string]string{VerifySignaturesKey: "true"},
+					Annotations: map[string]string{InjectionModeKey: string(InjectionModeAudit)},
+				}},
+			)
+
+			resp := w.Handle(context.Background(), newPodRequest(newPod(server.Host()+"/team/app@"+digest)))
+			Expect(resp.Allowed).To(BeFalse())
+		})
+
+		It("Should return a warning if the action is Warn", func() {
+			w := newVerifyingWebhook(&registryv1alpha1.VerifySignatures{
+				PublicKeys: []string{publicKey},
+				Action:     registryv1alpha1.SignatureActionWarn,
+			})
+
+			resp := w.Handle(context.Background(), newPodRequest(newPod(server.Host()+"/team/app@"+digest)))
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Warnings).To(ConsistOf(ContainSubstring("isn't signed")))
+			Expect(w.PodWebhook.Recorder.(*record.FakeRecorder).Events).To(Receive(ContainSubstring("SignatureVerificationFailed")))
+		})
+
+		It("Should deny the updates that change the image", func() {
+			w := newVerifyingWebhook(&registryv1alpha1.VerifySignatures{PublicKeys: []string{publicKey}})
+
+			resp := w.Handle(context.Background(), newUpdateRequest(newPod("nginx:1"), newPod(server.Host()+"/team/app@"+digest)))
+			Expect(resp.Allowed).To(BeFalse())
+			Expect(string(resp.Result.Reason)).To(ContainSubstring("isn't signed"))
+		})
+
+		It("Should admit the updates that don't change the image", func() {
+			w := newVerifyingWebhook(&registryv1alpha1.VerifySignatures{PublicKeys: []string{publicKey}})
+			pod := newPod(server.Host() + "/team/app@" + digest)
+
+			resp := w.Handle(context.Background(), newUpdateRequest(pod, pod))
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(server.Requests("team/app", cosign.SignatureTag(digest))).To(BeZero())
+		})
+
+		It("Should deny the added ephemeral containers", func() {
+			w := newVerifyingWebhook(&registryv1alpha1.VerifySignatures{PublicKeys: []string{publicKey}})
+			oldPod := newPod("nginx:1")
+			pod := newPod("nginx:1")
+			pod.Spec.EphemeralContainers = []corev1.EphemeralContainer{{
+				EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: "debugger", Image: server.Host() + "/team/app@" + digest},
+			}}
+			req := newUpdateRequest(oldPod, pod)
+			req.SubResource = "ephemeralcontainers"
+			req.Kind = metav1.GroupVersionKind{Version: "v1", Kind: "Pod"}
+
+			resp := w.Handle(context.Background(), req)
+			Expect(resp.Allowed).To(BeFalse())
+			Expect(string(resp.Result.Reason)).To(ContainSubstring("isn't signed"))
+		})
+	})
+
+	Context("When the image is signed with another key", func() {
+		It("Should deny the Pod", func() {
+			other, _ := cosigntest.GenerateKey()
+			cosigntest.Sign(server, "team/app", digest, other)
+			w := newVerifyingWebhook(&registryv1alpha1.VerifySignatures{PublicKeys: []string{publicKey}})
+
+			resp := w.Handle(context.Background(), newPodRequest(newPod(server.Host()+"/team/app@"+digest)))
+			Expect(resp.Allowed).To(BeFalse())
+			Expect(string(resp.Result.Reason)).To(ContainSubstring(`no valid signature of the keys of the RegistryCredentials "private"`))
+		})
+	})
+
+	Context("When the signatures can't be verified", func() {
+		It("Should return a warning if the failure policy is Ignore", func() {
+			w := newVerifyingWebhook(&registryv1alpha1.VerifySignatures{PublicKeys: []string{publicKey}})
+			server.Close()
+
+			resp := w.Handle(context.Background(), newPodRequest(newPod(server.Host()+"/team/app@"+digest)))
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Warnings).To(ConsistOf(ContainSubstring("unable to verify the signature")))
+		})
+
+		It("Should deny the Pod if the failure policy is Fail", func() {
+			w := newVerifyingWebhook(&registryv1alpha1.VerifySignatures{
+				PublicKeys:    []string{publicKey},
+				FailurePolicy: registryv1alpha1.FailurePolicyFail,
+			})
+			server.Close()
+
+			resp := w.Handle(context.Background(), newPodRequest(newPod(server.Host()+"/team/app@"+digest)))
+			Expect(resp.Allowed).To(BeFalse())
+			Expect(string(resp.Result.Reason)).To(ContainSubstring("unable to verify the signature"))
+		})
+	})
+})
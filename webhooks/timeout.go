@@ -0,0 +1,39 @@
+package webhooks
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/runtime/inject"
+)
+
+// requestTimeoutHandler bounds the context of admission requests with the
+// timeout sent by the API server in the "timeout" query parameter, so handlers
+// never wait longer than the API server is willing to.
+type requestTimeoutHandler struct {
+	handler http.Handler
+}
+
+// WithRequestTimeout wraps an admission webhook to honor the timeout of the
+// admission request.
+func WithRequestTimeout(handler http.Handler) http.Handler {
+	return &requestTimeoutHandler{handler: handler}
+}
+
+func (h *requestTimeoutHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	timeout, err := time.ParseDuration(req.URL.Query().Get("timeout"))
+	if err != nil || timeout <= 0 {
+		h.handler.ServeHTTP(rw, req)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	defer cancel()
+	h.handler.ServeHTTP(rw, req.WithContext(ctx))
+}
+
+// InjectFunc forwards the injection of dependencies to the wrapped webhook.
+func (h *requestTimeoutHandler) InjectFunc(f inject.Func) error {
+	return f(h.handler)
+}
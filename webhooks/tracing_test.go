@@ -0,0 +1,48 @@
+package webhooks
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	registryv1alpha1 "github.com/astrokube/registry-controller/api/v1alpha1"
+	"github.com/astrokube/registry-controller/pkg/tracing"
+)
+
+var _ = Describe("MutatePodWebhook tracing", func() {
+
+	var exporter *tracetest.InMemoryExporter
+
+	BeforeEach(func() {
+		exporter = tracetest.NewInMemoryExporter()
+		tracing.Setup(sdktrace.NewSimpleSpanProcessor(exporter), 1)
+	})
+
+	AfterEach(func() {
+		otel.SetTracerProvider(trace.NewNoopTracerProvider())
+	})
+
+	It("Should trace the admission and annotate the Pod with the trace ID", func() {
+		w := newMutatePodWebhook(
+			newRegistryCredentials("ecr", registryv1alpha1.RegistryCredentialsAuthenticated, `^123\.dkr\.ecr`),
+		)
+
+		resp := w.Handle(context.Background(), newPodRequest(newPod("123.dkr.ecr.eu-west-1.amazonaws.com/app:1")))
+		Expect(resp.Allowed).To(BeTrue())
+
+		spans := exporter.GetSpans()
+		Expect(spans).To(HaveLen(1))
+		Expect(spans[0].Name).To(Equal("MutatePodWebhook.Handle"))
+		Expect(patchedPaths(resp)).To(ConsistOf("/spec/imagePullSecrets", "/metadata/annotations"))
+		for _, patch := range resp.Patches {
+			if patch.Path == "/metadata/annotations" {
+				Expect(patch.Value).To(Equal(map[string]interface{}{TraceIDAnnotation: spans[0].SpanContext.TraceID().String()}))
+			}
+		}
+	})
+})
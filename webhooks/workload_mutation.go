@@ -0,0 +1,188 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-logr/logr"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/astrokube/registry-controller/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// InjectWorkloadsKey is the Namespace label used to opt-in to the injection of
+// secrets in the Pod templates of the workloads by setting it to "true"
+const InjectWorkloadsKey = "registry.astrokube.com/inject-workloads"
+
+// podTemplatePaths contains the path to the Pod template of every supported
+// workload kind
+var podTemplatePaths = map[string][]string{
+	"Deployment":  {"spec", "template"},
+	"StatefulSet": {"spec", "template"},
+	"DaemonSet":   {"spec", "template"},
+	"ReplicaSet":  {"spec", "template"},
+	"Job":         {"spec", "template"},
+	"CronJob":     {"spec", "jobTemplate", "spec", "template"},
+}
+
+// MutateWorkloadWebhook injects the secrets of the RegistryCredentials in the
+// Pod templates of the workloads, so they are visible in the workload specs.
+// It reuses the selection logic of the MutatePodWebhook.
+type MutateWorkloadWebhook struct {
+	Log        logr.Logger
+	PodWebhook *MutatePodWebhook
+}
+
+//+kubebuilder:webhook:path=/mutate-workload,mutating=true,failurePolicy=ignore,sideEffects=NoneOnDryRun,admissionReviewVersions=v1,groups=apps;batch,resources=deployments;statefulsets;daemonsets;replicasets;jobs;cronjobs,verbs=create;update,versions=v1;v1beta1,name=mutate-workload.registry.astrokube.io
+
+// SetupWithManager registers the webhook in the manager.
+func (w *MutateWorkloadWebhook) SetupWithManager(mgr ctrl.Manager) error {
+	if w.PodWebhook == nil {
+		return fmt.Errorf("the workload webhook requires the Pod webhook")
+	}
+	mgr.GetWebhookServer().Register("/mutate-workload", WithRequestTimeout(&webhook.Admission{Handler: w}))
+
+	return nil
+}
+
+func (w *MutateWorkloadWebhook) Handle(ctx context.Context, req admission.Request) admission.Response {
+	ctx, span := tracing.Tracer().Start(ctx, "MutateWorkloadWebhook.Handle", trace.WithAttributes(
+		attribute.String("kind", req.Kind.Kind),
+		attribute.String("namespace", req.Namespace),
+		attribute.String("name", req.Name),
+	))
+	defer span.End()
+
+	log := w.Log.WithValues("kind", req.Kind.Kind, "name", req.Name)
+	ctx = withDryRun(ctx, req)
+
+	templatePath, ok := podTemplatePaths[req.Kind.Kind]
+	if !ok {
+		return admission.Allowed(fmt.Sprintf("kind %v not supported", req.Kind.Kind))
+	}
+	// The Pod template of the Jobs is immutable, so patching it would make
+	// the API server reject every update of the Job
+	if req.Kind.Kind == "Job" && req.Operation == admissionv1.Update {
+		return admission.Allowed("the Pod template of the Jobs is immutable")
+	}
+
+	// Get workload
+	workload := &unstructured.Unstructured{}
+	if err := json.Unmarshal(req.Object.Raw, &workload.Object); err != nil {
+		log.Error(err, "Unable to decode request")
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	namespace := workload.GetNamespace()
+	if namespace == "" {
+		namespace = req.Namespace
+	}
+
+	// Skip ReplicaSets managed by Deployments, their templates must be equal
+	// to the Deployment template, which is already injected
+	if isManagedByDeployment(workload) {
+		w.PodWebhook.countSkipped(ctx, workload, "managed_by_deployment")
+		return admission.Allowed("workload managed by a Deployment")
+	}
+
+	// Skip workloads that opted-out of the injection
+	if isInjectionDisabled(workload.GetLabels(), workload.GetAnnotations()) {
+		w.PodWebhook.countSkipped(ctx, workload, "disabled_workload")
+		return admission.Allowed("injection disabled for the workload")
+	}
+	enabled, err := w.isWorkloadInjectionEnabledForNamespace(ctx, namespace)
+	if err != nil {
+		log.Error(err, "Unable to get Namespace")
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if !enabled {
+		w.PodWebhook.countSkipped(ctx, workload, "not_enabled_namespace")
+		return admission.Allowed("workload injection not enabled for the Namespace")
+	}
+	// In audit mode the secrets are only recorded when the Pods are created
+	mode, err := w.PodWebhook.getInjectionMode(ctx, namespace)
+	if err != nil {
+		log.Error(err, "Unable to get Namespace")
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if mode == InjectionModeAudit {
+		return admission.Allowed("audit mode")
+	}
+
+	// Get Pod template
+	rawTemplate, found, err := unstructured.NestedMap(workload.Object, templatePath...)
+	if err != nil {
+		log.Error(err, "Unable to get Pod template")
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if !found {
+		return admission.Allowed("Pod template not found")
+	}
+	template := &corev1.PodTemplateSpec{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(rawTemplate, template); err != nil {
+		log.Error(err, "Unable to decode Pod template")
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	// The secrets only need to exist when the Pods are created, so there is
+	// no need to wait for the authentication process
+	skipped, err := w.PodWebhook.injectPodSpec(ctx, log, workload, namespace, &template.ObjectMeta, &template.Spec, false)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if skipped != "" {
+		return admission.Allowed(skipped)
+	}
+	if len(template.Spec.ImagePullSecrets) == 0 {
+		return admission.Allowed("no secrets to inject")
+	}
+
+	// Only the image pull secrets are patched, so fields unknown to this
+	// version of the API are kept untouched
+	imagePullSecrets := []interface{}{}
+	for _, secret := range template.Spec.ImagePullSecrets {
+		imagePullSecrets = append(imagePullSecrets, map[string]interface{}{"name": secret.Name})
+	}
+	path := append(append([]string{}, templatePath...), "spec", "imagePullSecrets")
+	if err := unstructured.SetNestedSlice(workload.Object, imagePullSecrets, path...); err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	// Return the injected workload
+	marshalledWorkload, err := json.Marshal(workload.Object)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshalledWorkload)
+}
+
+func (w *MutateWorkloadWebhook) isWorkloadInjectionEnabledForNamespace(ctx context.Context, name string) (bool, error) {
+	namespace, err := w.PodWebhook.getNamespace(ctx, name)
+	if err != nil {
+		return false, err
+	}
+
+	return strings.EqualFold(namespace.ObjectMeta.Labels[InjectWorkloadsKey], "true"), nil
+}
+
+func isManagedByDeployment(workload *unstructured.Unstructured) bool {
+	for _, owner := range workload.GetOwnerReferences() {
+		if owner.Controller != nil && *owner.Controller && owner.Kind == "Deployment" {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,143 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admissionv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	registryv1alpha1 "github.com/astrokube/registry-controller/api/v1alpha1"
+)
+
+func newWorkloadRequest(kind string, obj interface{}) admission.Request {
+	raw, err := json.Marshal(obj)
+	Expect(err).NotTo(HaveOccurred())
+
+	return admission.Request{
+		AdmissionRequest: admissionv1.AdmissionRequest{
+			Operation: admissionv1.Create,
+			Kind:      metav1.GroupVersionKind{Kind: kind},
+			Namespace: namespace,
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+	}
+}
+
+func newPodTemplate(image string) corev1.PodTemplateSpec {
+	return corev1.PodTemplateSpec{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "container", Image: image}},
+		},
+	}
+}
+
+func newMutateWorkloadWebhook(objects ...client.Object) *MutateWorkloadWebhook {
+	return &MutateWorkloadWebhook{
+		Log:        logf.Log,
+		PodWebhook: newMutatePodWebhook(objects...),
+	}
+}
+
+var _ = Describe("MutateWorkloadWebhook", func() {
+
+	var registryCredentials *registryv1alpha1.RegistryCredentials
+
+	BeforeEach(func() {
+		registryCredentials = newRegistryCredentials("ecr", registryv1alpha1.RegistryCredentialsAuthenticating, `^123\.dkr\.ecr`)
+	})
+
+	Context("When the Namespace enables the workload injection", func() {
+		var ns *corev1.Namespace
+
+		BeforeEach(func() {
+			ns = &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace, Labels: map[string]string{InjectWorkloadsKey: "true"}}}
+		})
+
+		It("Should inject the secrets in the Deployment template", func() {
+			w := newMutateWorkloadWebhook(ns, registryCredentials)
+			deployment := &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: namespace},
+				Spec:       appsv1.DeploymentSpec{Template: newPodTemplate("123.dkr.ecr.eu-west-1.amazonaws.com/app:1")},
+			}
+
+			resp := w.Handle(context.Background(), newWorkloadRequest("Deployment", deployment))
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Patches).To(HaveLen(1))
+			Expect(resp.Patches[0].Path).To(Equal("/spec/template/spec/imagePullSecrets"))
+			Expect(resp.Patches[0].Value).To(Equal([]interface{}{map[string]interface{}{"name": "ecr"}}))
+		})
+
+		It("Should inject the secrets in the CronJob job template", func() {
+			w := newMutateWorkloadWebhook(ns, registryCredentials)
+			cronJob := &batchv1beta1.CronJob{
+				ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: namespace},
+				Spec: batchv1beta1.CronJobSpec{
+					JobTemplate: batchv1beta1.JobTemplateSpec{},
+				},
+			}
+			cronJob.Spec.JobTemplate.Spec.Template = newPodTemplate("123.dkr.ecr.eu-west-1.amazonaws.com/app:1")
+
+			resp := w.Handle(context.Background(), newWorkloadRequest("CronJob", cronJob))
+			Expect(patchedPaths(resp)).To(ConsistOf("/spec/jobTemplate/spec/template/spec/imagePullSecrets"))
+		})
+
+		It("Should not mutate the template of existing Jobs", func() {
+			w := newMutateWorkloadWebhook(ns, registryCredentials)
+			job := &batchv1.Job{
+				ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: namespace, Labels: map[string]string{"updated": "true"}},
+				Spec:       batchv1.JobSpec{Template: newPodTemplate("123.dkr.ecr.eu-west-1.amazonaws.com/app:1")},
+			}
+
+			req := newWorkloadRequest("Job", job)
+			resp := w.Handle(context.Background(), req)
+			Expect(patchedPaths(resp)).To(ConsistOf("/spec/template/spec/imagePullSecrets"))
+
+			req.Operation = admissionv1.Update
+			resp = w.Handle(context.Background(), req)
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Patches).To(BeEmpty())
+		})
+
+		It("Should skip ReplicaSets managed by Deployments", func() {
+			w := newMutateWorkloadWebhook(ns, registryCredentials)
+			controller := true
+			replicaSet := &appsv1.ReplicaSet{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:            "app",
+					Namespace:       namespace,
+					OwnerReferences: []metav1.OwnerReference{{Kind: "Deployment", Name: "app", Controller: &controller}},
+				},
+				Spec: appsv1.ReplicaSetSpec{Template: newPodTemplate("123.dkr.ecr.eu-west-1.amazonaws.com/app:1")},
+			}
+
+			resp := w.Handle(context.Background(), newWorkloadRequest("ReplicaSet", replicaSet))
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Patches).To(BeEmpty())
+		})
+	})
+
+	Context("When the Namespace doesn't enable the workload injection", func() {
+		It("Should not mutate the workload", func() {
+			w := newMutateWorkloadWebhook(registryCredentials)
+			deployment := &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: namespace},
+				Spec:       appsv1.DeploymentSpec{Template: newPodTemplate("123.dkr.ecr.eu-west-1.amazonaws.com/app:1")},
+			}
+
+			resp := w.Handle(context.Background(), newWorkloadRequest("Deployment", deployment))
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Patches).To(BeEmpty())
+		})
+	})
+})